@@ -1,52 +1,97 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/asankov/shortener/internal/auth"
+	"github.com/asankov/shortener/internal/cache"
 	"github.com/asankov/shortener/internal/config"
 	"github.com/asankov/shortener/internal/dynamo"
 	"github.com/asankov/shortener/internal/inmemory"
+	"github.com/asankov/shortener/internal/ratelimit"
 	"github.com/asankov/shortener/internal/shortener"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/exp/slog"
 )
 
 func main() {
 	if err := run(); err != nil {
-		slog.Error("error while running shortener", err)
+		// The usage is already printed for --help.
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		slog.Error("error while running shortener", "error", err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
-
-	config, err := config.NewFromEnv()
+	config, flags, err := config.Load(os.Args[1:])
 	if err != nil {
 		return err
 	}
+	if flags.PrintConfig {
+		return config.Print(os.Stdout)
+	}
 
-	db, idGenerator, userService, authenticator, configService, err := initFromConfig(config)
+	db, idGenerator, userService, authenticator, configService, idempotencyStore, err := initFromConfig(config)
 	if err != nil {
 		return err
 	}
 
-	shortener, err := shortener.New(config, db, idGenerator, userService, authenticator, configService)
+	shortener, err := shortener.New(config, db, idGenerator, userService, authenticator, configService, idempotencyStore)
 	if err != nil {
 		return err
 	}
+	shortener.WatchConfig(flags.ConfigFile, reloadConfig)
+
+	if config.RateLimitStore == "redis" || config.LinkCacheShared {
+		client := redis.NewClient(&redis.Options{Addr: config.RedisAddress})
+		defer client.Close()
+
+		if config.RateLimitStore == "redis" {
+			shortener.SetRateLimiter(ratelimit.NewRedis(client))
+		}
+		if config.LinkCacheShared {
+			shortener.SetSharedCache(cache.NewRedis(client, "shortener:links:"))
+		}
+	}
+
+	// Kubernetes sends SIGTERM to the pods that are being stopped, e.g. during a rollout.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	return shortener.Start(ctx)
+}
 
-	return shortener.Start()
+// reloadConfig loads the config from the same sources it was loaded from at startup.
+func reloadConfig() (*config.Config, error) {
+	config, _, err := config.Load(os.Args[1:])
+	return config, err
 }
 
-func initFromConfig(config *config.Config) (shortener.Database, shortener.IDGenerator, shortener.UserService, shortener.Authenticator, shortener.ConfigService, error) {
+func initFromConfig(config *config.Config) (shortener.Database, shortener.IDGenerator, shortener.UserService, shortener.Authenticator, shortener.ConfigService, shortener.IdempotencyStore, error) {
 	authenticator := auth.NewAutheniticator(config.Secret)
 
 	if config.UseInMemoryDB {
 		db := inmemory.NewDB()
 
-		return db, db, db, authenticator, db, nil
+		return db, db, db, authenticator, db, db, nil
 	}
-	db, err := dynamo.New()
+	db, err := dynamo.New(dynamo.Options{
+		Region:           config.AWSRegion,
+		LinksTable:       config.LinksTable,
+		UsersTable:       config.UsersTable,
+		IdempotencyTable: config.IdempotencyTable,
+	})
 	if err != nil {
-		return nil, nil, nil, authenticator, nil, err
+		return nil, nil, nil, authenticator, nil, nil, err
 	}
 
-	return db, db, db, authenticator, db, nil
+	return db, db, db, authenticator, db, db, nil
 }
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/oapi-codegen/runtime"
@@ -16,6 +17,100 @@ const (
 	JWTScopes = "JWT.Scopes"
 )
 
+// Defines values for BatchCreateLinkResultStatus.
+const (
+	BatchStatusAborted  BatchCreateLinkResultStatus = "aborted"
+	BatchStatusConflict BatchCreateLinkResultStatus = "conflict"
+	BatchStatusCreated  BatchCreateLinkResultStatus = "created"
+	BatchStatusFailed   BatchCreateLinkResultStatus = "failed"
+	BatchStatusInvalid  BatchCreateLinkResultStatus = "invalid"
+)
+
+// Defines values for LinkState.
+const (
+	LinkStateActive    LinkState = "active"
+	LinkStateExhausted LinkState = "exhausted"
+	LinkStateExpired   LinkState = "expired"
+	LinkStateOffHours  LinkState = "off-hours"
+	LinkStateScheduled LinkState = "scheduled"
+)
+
+// Defines values for PassthroughQueryPrecedence.
+const (
+	QueryPrecedenceDestination PassthroughQueryPrecedence = "destination"
+	QueryPrecedenceIncoming    PassthroughQueryPrecedence = "incoming"
+)
+
+// Defines values for RecurrenceDays.
+const (
+	Friday    RecurrenceDays = "friday"
+	Monday    RecurrenceDays = "monday"
+	Saturday  RecurrenceDays = "saturday"
+	Sunday    RecurrenceDays = "sunday"
+	Thursday  RecurrenceDays = "thursday"
+	Tuesday   RecurrenceDays = "tuesday"
+	Wednesday RecurrenceDays = "wednesday"
+)
+
+// Defines values for RedirectType.
+const (
+	RedirectTypeFound             RedirectType = "302"
+	RedirectTypeMetaRefresh       RedirectType = "meta-refresh"
+	RedirectTypeMovedPermanently  RedirectType = "301"
+	RedirectTypePermanentRedirect RedirectType = "308"
+	RedirectTypeTemporaryRedirect RedirectType = "307"
+)
+
+// Defines values for ScheduleInactive.
+const (
+	InactiveFallback    ScheduleInactive = "fallback"
+	InactiveHoldingPage ScheduleInactive = "holding-page"
+	InactiveNotFound    ScheduleInactive = "not-found"
+)
+
+// Defines values for TargetingRuleDevices.
+const (
+	DeviceDesktop TargetingRuleDevices = "desktop"
+	DeviceMobile  TargetingRuleDevices = "mobile"
+	DeviceTablet  TargetingRuleDevices = "tablet"
+)
+
+// Defines values for TargetingRulePlatforms.
+const (
+	PlatformAndroid TargetingRulePlatforms = "android"
+	PlatformIOS     TargetingRulePlatforms = "ios"
+	PlatformLinux   TargetingRulePlatforms = "linux"
+	PlatformMacOS   TargetingRulePlatforms = "macos"
+	PlatformWindows TargetingRulePlatforms = "windows"
+)
+
+// Defines values for GetLinkQrCodeParamsFormat.
+const (
+	QRFormatPNG GetLinkQrCodeParamsFormat = "png"
+	QRFormatSVG GetLinkQrCodeParamsFormat = "svg"
+)
+
+// Defines values for GetLinkQrCodeParamsLevel.
+const (
+	QRLevelHigh     GetLinkQrCodeParamsLevel = "high"
+	QRLevelLow      GetLinkQrCodeParamsLevel = "low"
+	QRLevelMedium   GetLinkQrCodeParamsLevel = "medium"
+	QRLevelQuartile GetLinkQrCodeParamsLevel = "quartile"
+)
+
+// Defines values for AggregateLinkMetricsParamsGroupBy.
+const (
+	GroupByCampaign AggregateLinkMetricsParamsGroupBy = "campaign"
+	GroupByTag      AggregateLinkMetricsParamsGroupBy = "tag"
+)
+
+// Defines values for ExportLinksParamsFormat.
+const (
+	ExportFormatCSV    ExportLinksParamsFormat = "csv"
+	ExportFormatJSON   ExportLinksParamsFormat = "json"
+	ExportFormatNDJSON ExportLinksParamsFormat = "ndjson"
+)
+
 // AdminLoginRequest defines model for AdminLoginRequest.
 type AdminLoginRequest struct {
 	Password string `json:"password"`
@@ -27,28 +122,500 @@ type AdminLoginResponse struct {
 	Token string `json:"token"`
 }
 
+// AggregateLinkMetricsResponse defines model for AggregateLinkMetricsResponse.
+type AggregateLinkMetricsResponse struct {
+	Groups []LinkMetricsGroup `json:"groups"`
+}
+
+// BatchCreateLinkResult defines model for BatchCreateLinkResult.
+type BatchCreateLinkResult struct {
+	Error *string                  `json:"error,omitempty"`
+	ID    *string                  `json:"id,omitempty"`
+	Link  *CreateShortLinkResponse `json:"link,omitempty"`
+
+	// Status `created` - the link was created.
+	// `conflict` - a link with the same ID already exists.
+	// `invalid` - the link is not valid.
+	// `aborted` - the link is valid, but was not created because other links of the atomic batch failed.
+	// `failed` - the link was not created because of an internal error.
+	Status BatchCreateLinkResultStatus `json:"status"`
+}
+
+// BatchCreateLinkResultStatus `created` - the link was created.
+// `conflict` - a link with the same ID already exists.
+// `invalid` - the link is not valid.
+// `aborted` - the link is valid, but was not created because other links of the atomic batch failed.
+// `failed` - the link was not created because of an internal error.
+type BatchCreateLinkResultStatus string
+
+// BatchCreateLinksRequest defines model for BatchCreateLinksRequest.
+type BatchCreateLinksRequest struct {
+	// Atomic Whether the links are created all or nothing, in a single transaction
+	Atomic *bool                    `json:"atomic,omitempty"`
+	Links  []CreateShortLinkRequest `json:"links"`
+}
+
+// BatchCreateLinksResponse defines model for BatchCreateLinksResponse.
+type BatchCreateLinksResponse struct {
+	Results []BatchCreateLinkResult `json:"results"`
+}
+
 // CreateShortLinkRequest defines model for CreateShortLinkRequest.
 type CreateShortLinkRequest struct {
-	ID  *string `json:"id,omitempty"`
-	URL string  `json:"url"`
+	// DeleteWhenExhausted Whether the link is deleted once it reaches `max_clicks`.
+	DeleteWhenExhausted *bool `json:"delete_when_exhausted,omitempty"`
+
+	// Destinations URLs the traffic of the link is split between by weight, for visitors that match none of the targeting rules.
+	// Returning visitors are sent to the same destination.
+	Destinations *[]Destination `json:"destinations,omitempty"`
+	ID           *string        `json:"id,omitempty"`
+
+	// Interstitial Whether the visitors are shown a page with the destination before being redirected to it
+	Interstitial *bool `json:"interstitial,omitempty"`
+
+	// MaxClicks The number of clicks after which the link stops working. Zero means that the link is not limited.
+	MaxClicks *int `json:"max_clicks,omitempty"`
+
+	// Passthrough Controls which parts of the incoming request are passed to the destination of the link
+	Passthrough *Passthrough `json:"passthrough,omitempty"`
+
+	// Password The password required to follow the link. An empty password removes the protection.
+	Password *string `json:"password,omitempty"`
+
+	// RedirectType How the visitors of the link are sent to its destination.
+	// `301`, `302`, `307` and `308` redirect with the respective status code.
+	// `meta-refresh` serves an HTML page that redirects via a meta refresh tag and JavaScript.
+	RedirectType *RedirectType `json:"redirect_type,omitempty"`
+
+	// ReuseExisting Whether to return the oldest existing link of the user with the same destination and the same settings, instead of creating a new one.
+	// URLs that differ only in the case of the scheme and the host, the default port, the fragment or the order of the query parameters
+	// have the same destination. The destination includes the `utm` parameters of the request.
+	// The settings, e.g. the redirect type, the password, the schedule and the maximum number of clicks, must be the same as the ones of the request,
+	// and so must the ID, if one is requested.
+	// Supported only when creating a single link.
+	ReuseExisting *bool `json:"reuse_existing,omitempty"`
+
+	// Schedule Controls when the link resolves to its destination
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+
+	// Targeting Rules that send visitors to different destinations, evaluated in order.
+	// Visitors that match none of the rules are sent to `url`.
+	Targeting *[]TargetingRule `json:"targeting,omitempty"`
+	URL       string           `json:"url"`
+
+	// Utm UTM parameters that are added to the query of the destination.
+	// UTM parameters already present in the destination are replaced.
+	Utm *UTM `json:"utm,omitempty"`
 }
 
 // CreateShortLinkResponse defines model for CreateShortLinkResponse.
 type CreateShortLinkResponse struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// DeleteWhenExhausted Whether the link is deleted once it reaches `max_clicks`.
+	DeleteWhenExhausted *bool `json:"delete_when_exhausted,omitempty"`
+
+	// Destinations URLs the traffic of the link is split between by weight, for visitors that match none of the targeting rules.
+	// Returning visitors are sent to the same destination.
+	Destinations *[]Destination `json:"destinations,omitempty"`
+	ID           string         `json:"id"`
+
+	// Interstitial Whether the visitors are shown a page with the destination before being redirected to it
+	Interstitial bool `json:"interstitial"`
+
+	// MaxClicks The number of clicks after which the link stops working. Zero means that the link is not limited.
+	MaxClicks *int `json:"max_clicks,omitempty"`
+
+	// Owner The email of the user that created the link
+	Owner *string `json:"owner,omitempty"`
+
+	// Passthrough Controls which parts of the incoming request are passed to the destination of the link
+	Passthrough       *Passthrough `json:"passthrough,omitempty"`
+	PasswordProtected bool         `json:"password_protected"`
+
+	// RedirectType How the visitors of the link are sent to its destination.
+	// `301`, `302`, `307` and `308` redirect with the respective status code.
+	// `meta-refresh` serves an HTML page that redirects via a meta refresh tag and JavaScript.
+	RedirectType RedirectType `json:"redirect_type"`
+
+	// Schedule Controls when the link resolves to its destination
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+
+	// Targeting Rules that send visitors to different destinations, evaluated in order.
+	// Visitors that match none of the rules are sent to `url`.
+	Targeting *[]TargetingRule `json:"targeting,omitempty"`
+	URL       string           `json:"url"`
+
+	// Utm UTM parameters that are added to the query of the destination.
+	// UTM parameters already present in the destination are replaced.
+	Utm *UTM `json:"utm,omitempty"`
+}
+
+// Destination defines model for Destination.
+type Destination struct {
+	// Id Identifies the destination in the metrics
 	ID  string `json:"id"`
 	URL string `json:"url"`
+
+	// Weight The relative share of the traffic sent to this destination
+	Weight int `json:"weight"`
+}
+
+// DuplicateLinkGroup Links of the same user with the same destination
+type DuplicateLinkGroup struct {
+	// Links The IDs of the links, starting from the oldest one
+	Links []string `json:"links"`
+	Owner string   `json:"owner"`
+
+	// Url The normalized destination of the links
+	URL string `json:"url"`
+}
+
+// DuplicateLinksResponse defines model for DuplicateLinksResponse.
+type DuplicateLinksResponse struct {
+	Groups []DuplicateLinkGroup `json:"groups"`
 }
 
 // GetLinkMetricsResponse defines model for GetLinkMetricsResponse.
 type GetLinkMetricsResponse struct {
+	// Health The result of the last check of the destination of the link
+	Health  *LinkHealth `json:"health,omitempty"`
 	ID      string      `json:"id"`
 	Metrics LinkMetrics `json:"metrics"`
-	URL     string      `json:"url"`
+
+	// State Whether the link resolves to its destination at the moment, and if not, why
+	State LinkState `json:"state"`
+	Tags  *[]string `json:"tags,omitempty"`
+	URL   string    `json:"url"`
+
+	// Utm UTM parameters that are added to the query of the destination.
+	// UTM parameters already present in the destination are replaced.
+	Utm *UTM `json:"utm,omitempty"`
+}
+
+// ImportLinkRow A single link to import
+type ImportLinkRow struct {
+	// Expiry The time the link stops being active
+	Expiry *time.Time `json:"expiry,omitempty"`
+
+	// Id The ID of the link. If not set, one is generated.
+	ID   *string   `json:"id,omitempty"`
+	Tags *[]string `json:"tags,omitempty"`
+	URL  string    `json:"url"`
+}
+
+// ImportLinksResponse defines model for ImportLinksResponse.
+type ImportLinksResponse struct {
+	Errors []ImportRowError `json:"errors"`
+
+	// Failed The number of rows that were not imported
+	Failed int `json:"failed"`
+
+	// Imported The number of links that were created
+	Imported int `json:"imported"`
+}
+
+// ImportRowError defines model for ImportRowError.
+type ImportRowError struct {
+	Error string  `json:"error"`
+	ID    *string `json:"id,omitempty"`
+
+	// Row The number of the row, starting from 1. The header of CSV input is not counted.
+	Row int `json:"row"`
+}
+
+// LinkHealth The result of the last check of the destination of the link
+type LinkHealth struct {
+	Broken        bool      `json:"broken"`
+	CheckedAt     time.Time `json:"checked_at"`
+	Error         *string   `json:"error,omitempty"`
+	LatencyMs     int64     `json:"latency_ms"`
+	RedirectChain *[]string `json:"redirect_chain,omitempty"`
+	StatusCode    int       `json:"status_code"`
 }
 
 // LinkMetrics defines model for LinkMetrics.
 type LinkMetrics struct {
 	Clicks int `json:"clicks"`
+
+	// QrScans The clicks that came from scanning a tracked QR code of the link
+	QRScans int `json:"qr_scans"`
+
+	// RemainingClicks How many more times the link can be followed, for links with `max_clicks`
+	RemainingClicks *int `json:"remaining_clicks,omitempty"`
+
+	// Variants The clicks per destination ID, for links that split their traffic
+	Variants *map[string]int `json:"variants,omitempty"`
+}
+
+// LinkMetricsGroup The combined metrics of all links with the same UTM campaign or tag
+type LinkMetricsGroup struct {
+	// Key The UTM campaign or tag
+	Key string `json:"key"`
+
+	// Links The number of links in the group
+	Links   int         `json:"links"`
+	Metrics LinkMetrics `json:"metrics"`
+}
+
+// LinkState Whether the link resolves to its destination at the moment, and if not, why
+type LinkState string
+
+// ListLinksResponse defines model for ListLinksResponse.
+type ListLinksResponse struct {
+	Links []GetLinkMetricsResponse `json:"links"`
+}
+
+// Passthrough Controls which parts of the incoming request are passed to the destination of the link
+type Passthrough struct {
+	// Path Whether the path after the link ID is appended to the destination
+	Path bool `json:"path"`
+
+	// Query Whether the query parameters of the request are merged into the destination
+	Query bool `json:"query"`
+
+	// QueryPrecedence Which value is used when a query parameter is present both in the request and in the destination
+	QueryPrecedence *PassthroughQueryPrecedence `json:"query_precedence,omitempty"`
+}
+
+// PassthroughQueryPrecedence Which value is used when a query parameter is present both in the request and in the destination
+type PassthroughQueryPrecedence string
+
+// Recurrence A window of time that repeats on the given days of every week, within `active_from` and `active_until`.
+// If `until` is before `from`, the window ends on the next day.
+type Recurrence struct {
+	// Days The days of the week the window starts on. If not set, the window repeats every day.
+	Days *[]RecurrenceDays `json:"days,omitempty"`
+
+	// From The time of day the window starts, e.g. `09:00`
+	From string `json:"from"`
+
+	// TimeZone The IANA name of the time zone of `from` and `until`, e.g. `Europe/Sofia`. Defaults to UTC.
+	TimeZone *string `json:"time_zone,omitempty"`
+
+	// Until The time of day the window ends, e.g. `17:30`
+	Until string `json:"until"`
+}
+
+// RecurrenceDays defines model for Recurrence.Days.
+type RecurrenceDays string
+
+// RedirectType How the visitors of the link are sent to its destination.
+// `301`, `302`, `307` and `308` redirect with the respective status code.
+// `meta-refresh` serves an HTML page that redirects via a meta refresh tag and JavaScript.
+type RedirectType string
+
+// Schedule Controls when the link resolves to its destination
+type Schedule struct {
+	// ActiveFrom The time the link becomes active
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+
+	// ActiveUntil The time the link stops being active
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+
+	// FallbackUrl Where the visitors are sent while the link is not active, with the `fallback` behavior
+	FallbackURL *string `json:"fallback_url,omitempty"`
+
+	// Inactive What the visitors get while the link is not active
+	Inactive *ScheduleInactive `json:"inactive,omitempty"`
+
+	// Recurring A window of time that repeats on the given days of every week, within `active_from` and `active_until`.
+	// If `until` is before `from`, the window ends on the next day.
+	Recurring *Recurrence `json:"recurring,omitempty"`
+}
+
+// ScheduleInactive What the visitors get while the link is not active
+type ScheduleInactive string
+
+// TargetingRule Sends the visitors that match all of its conditions to `url`.
+// Each condition matches if the visitor matches any of its values. Conditions that are not set match all visitors.
+type TargetingRule struct {
+	// Countries ISO 3166-1 alpha-2 country codes, e.g. `BG`
+	Countries *[]string               `json:"countries,omitempty"`
+	Devices   *[]TargetingRuleDevices `json:"devices,omitempty"`
+
+	// Languages Language tags, e.g. `en` or `en-US`. A language without a region matches all regions of the language.
+	Languages *[]string                 `json:"languages,omitempty"`
+	Platforms *[]TargetingRulePlatforms `json:"platforms,omitempty"`
+	URL       string                    `json:"url"`
+}
+
+// TargetingRuleDevices defines model for TargetingRule.Devices.
+type TargetingRuleDevices string
+
+// TargetingRulePlatforms defines model for TargetingRule.Platforms.
+type TargetingRulePlatforms string
+
+// UTM UTM parameters that are added to the query of the destination.
+// UTM parameters already present in the destination are replaced.
+type UTM struct {
+	Campaign *string `json:"campaign,omitempty"`
+	Content  *string `json:"content,omitempty"`
+	Medium   *string `json:"medium,omitempty"`
+	Source   string  `json:"source"`
+	Term     *string `json:"term,omitempty"`
+}
+
+// UpdateShortLinkRequest The properties of the link to update. Properties that are not set are left unchanged.
+type UpdateShortLinkRequest struct {
+	// DeleteWhenExhausted Whether the link is deleted once it reaches `max_clicks`.
+	DeleteWhenExhausted *bool `json:"delete_when_exhausted,omitempty"`
+
+	// Destinations URLs the traffic of the link is split between by weight, for visitors that match none of the targeting rules.
+	// Returning visitors are sent to the same destination.
+	Destinations *[]Destination `json:"destinations,omitempty"`
+
+	// Interstitial Whether the visitors are shown a page with the destination before being redirected to it
+	Interstitial *bool `json:"interstitial,omitempty"`
+
+	// MaxClicks The number of clicks after which the link stops working. Zero means that the link is not limited.
+	MaxClicks *int `json:"max_clicks,omitempty"`
+
+	// Passthrough Controls which parts of the incoming request are passed to the destination of the link
+	Passthrough *Passthrough `json:"passthrough,omitempty"`
+
+	// Password The password required to follow the link. An empty password removes the protection.
+	Password *string `json:"password,omitempty"`
+
+	// RedirectType How the visitors of the link are sent to its destination.
+	// `301`, `302`, `307` and `308` redirect with the respective status code.
+	// `meta-refresh` serves an HTML page that redirects via a meta refresh tag and JavaScript.
+	RedirectType *RedirectType `json:"redirect_type,omitempty"`
+
+	// Schedule Controls when the link resolves to its destination
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+
+	// Targeting Rules that send visitors to different destinations, evaluated in order.
+	// Visitors that match none of the rules are sent to `url`.
+	Targeting *[]TargetingRule `json:"targeting,omitempty"`
+	URL       *string          `json:"url,omitempty"`
+
+	// Utm UTM parameters that are added to the query of the destination.
+	// UTM parameters already present in the destination are replaced.
+	Utm *UTM `json:"utm,omitempty"`
+}
+
+// UpdateShortLinkResponse defines model for UpdateShortLinkResponse.
+type UpdateShortLinkResponse struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// DeleteWhenExhausted Whether the link is deleted once it reaches `max_clicks`.
+	DeleteWhenExhausted *bool `json:"delete_when_exhausted,omitempty"`
+
+	// Destinations URLs the traffic of the link is split between by weight, for visitors that match none of the targeting rules.
+	// Returning visitors are sent to the same destination.
+	Destinations *[]Destination `json:"destinations,omitempty"`
+	ID           string         `json:"id"`
+
+	// Interstitial Whether the visitors are shown a page with the destination before being redirected to it
+	Interstitial bool `json:"interstitial"`
+
+	// MaxClicks The number of clicks after which the link stops working. Zero means that the link is not limited.
+	MaxClicks *int `json:"max_clicks,omitempty"`
+
+	// Owner The email of the user that created the link
+	Owner *string `json:"owner,omitempty"`
+
+	// Passthrough Controls which parts of the incoming request are passed to the destination of the link
+	Passthrough       *Passthrough `json:"passthrough,omitempty"`
+	PasswordProtected bool         `json:"password_protected"`
+
+	// RedirectType How the visitors of the link are sent to its destination.
+	// `301`, `302`, `307` and `308` redirect with the respective status code.
+	// `meta-refresh` serves an HTML page that redirects via a meta refresh tag and JavaScript.
+	RedirectType RedirectType `json:"redirect_type"`
+
+	// Schedule Controls when the link resolves to its destination
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+
+	// Targeting Rules that send visitors to different destinations, evaluated in order.
+	// Visitors that match none of the rules are sent to `url`.
+	Targeting *[]TargetingRule `json:"targeting,omitempty"`
+	URL       string           `json:"url"`
+
+	// Utm UTM parameters that are added to the query of the destination.
+	// UTM parameters already present in the destination are replaced.
+	Utm *UTM `json:"utm,omitempty"`
+}
+
+// ListLinksParams defines parameters for ListLinks.
+type ListLinksParams struct {
+	// Broken If true, only links with a broken destination are returned
+	Broken *bool `form:"broken,omitempty" json:"broken,omitempty"`
+
+	// Campaign If set, only links with this UTM campaign are returned
+	Campaign *string `form:"campaign,omitempty" json:"campaign,omitempty"`
+
+	// Tag If set, only links with this tag are returned
+	Tag *string `form:"tag,omitempty" json:"tag,omitempty"`
+}
+
+// CreateNewLinkParams defines parameters for CreateNewLink.
+type CreateNewLinkParams struct {
+	// IdempotencyKey Makes the request safe to retry. The response of the first request with a key is replayed for the retries with the same key and body,
+	// with the `Idempotent-Replayed` header set.
+	IdempotencyKey *string `json:"Idempotency-Key,omitempty"`
+}
+
+// GetLinkQrCodeParams defines parameters for GetLinkQrCode.
+type GetLinkQrCodeParams struct {
+	Format *GetLinkQrCodeParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+
+	// Size The width and height of the image, in pixels
+	Size *int `form:"size,omitempty" json:"size,omitempty"`
+
+	// Level The error correction level. It is raised to `high` with `logo`.
+	Level *GetLinkQrCodeParamsLevel `form:"level,omitempty" json:"level,omitempty"`
+
+	// Margin The width of the quiet zone around the code, in modules
+	Margin *int `form:"margin,omitempty" json:"margin,omitempty"`
+
+	// Foreground The color of the dark modules, in the `#rrggbb` format
+	Foreground *string `form:"foreground,omitempty" json:"foreground,omitempty"`
+
+	// Background The color of the light modules, in the `#rrggbb` format
+	Background *string `form:"background,omitempty" json:"background,omitempty"`
+
+	// Logo Whether the configured logo is drawn in the center of the code
+	Logo *bool `form:"logo,omitempty" json:"logo,omitempty"`
+
+	// Track Whether the scans of the code are counted separately
+	Track *bool `form:"track,omitempty" json:"track,omitempty"`
+}
+
+// GetLinkQrCodeParamsFormat defines parameters for GetLinkQrCode.
+type GetLinkQrCodeParamsFormat string
+
+// GetLinkQrCodeParamsLevel defines parameters for GetLinkQrCode.
+type GetLinkQrCodeParamsLevel string
+
+// AggregateLinkMetricsParams defines parameters for AggregateLinkMetrics.
+type AggregateLinkMetricsParams struct {
+	// GroupBy The property of the links by which the metrics are grouped
+	GroupBy AggregateLinkMetricsParamsGroupBy `form:"group_by" json:"group_by"`
+}
+
+// AggregateLinkMetricsParamsGroupBy defines parameters for AggregateLinkMetrics.
+type AggregateLinkMetricsParamsGroupBy string
+
+// ExportLinksParams defines parameters for ExportLinks.
+type ExportLinksParams struct {
+	Format *ExportLinksParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+}
+
+// ExportLinksParamsFormat defines parameters for ExportLinks.
+type ExportLinksParamsFormat string
+
+// UnlockLinkFormdataBody defines parameters for UnlockLink.
+type UnlockLinkFormdataBody struct {
+	Password string `form:"password" json:"password"`
+
+	// Return The path to redirect to after a successful unlock. Must be the path of the link.
+	Return *string `form:"return,omitempty" json:"return,omitempty"`
 }
 
 // LoginAdminJSONRequestBody defines body for LoginAdmin for application/json ContentType.
@@ -57,23 +624,59 @@ type LoginAdminJSONRequestBody = AdminLoginRequest
 // CreateNewLinkJSONRequestBody defines body for CreateNewLink for application/json ContentType.
 type CreateNewLinkJSONRequestBody = CreateShortLinkRequest
 
+// UpdateShortLinkJSONRequestBody defines body for UpdateShortLink for application/json ContentType.
+type UpdateShortLinkJSONRequestBody = UpdateShortLinkRequest
+
+// BatchCreateLinksJSONRequestBody defines body for BatchCreateLinks for application/json ContentType.
+type BatchCreateLinksJSONRequestBody = BatchCreateLinksRequest
+
+// UnlockLinkFormdataRequestBody defines body for UnlockLink for application/x-www-form-urlencoded ContentType.
+type UnlockLinkFormdataRequestBody UnlockLinkFormdataBody
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
 
 	// (POST /api/v1/admin/login)
 	LoginAdmin(w http.ResponseWriter, r *http.Request)
+	// List links
+	// (GET /api/v1/links)
+	ListLinks(w http.ResponseWriter, r *http.Request, params ListLinksParams)
 
 	// (POST /api/v1/links)
-	CreateNewLink(w http.ResponseWriter, r *http.Request)
+	CreateNewLink(w http.ResponseWriter, r *http.Request, params CreateNewLinkParams)
 	// Delete link
 	// (DELETE /api/v1/links/{linkId})
 	DeleteShortLink(w http.ResponseWriter, r *http.Request, linkID string)
 	// Get Link Metrics
 	// (GET /api/v1/links/{linkId})
 	GetLinkMetrics(w http.ResponseWriter, r *http.Request, linkID string)
+	// Update link
+	// (PATCH /api/v1/links/{linkId})
+	UpdateShortLink(w http.ResponseWriter, r *http.Request, linkID string)
+	// Get QR code
+	// (GET /api/v1/links/{linkId}/qr)
+	GetLinkQrCode(w http.ResponseWriter, r *http.Request, linkID string, params GetLinkQrCodeParams)
+	// Aggregate link metrics
+	// (GET /api/v1/links:aggregate)
+	AggregateLinkMetrics(w http.ResponseWriter, r *http.Request, params AggregateLinkMetricsParams)
+	// Create links in batch
+	// (POST /api/v1/links:batch)
+	BatchCreateLinks(w http.ResponseWriter, r *http.Request)
+	// Report duplicate links
+	// (GET /api/v1/links:duplicates)
+	ReportDuplicateLinks(w http.ResponseWriter, r *http.Request)
+	// Export links
+	// (GET /api/v1/links:export)
+	ExportLinks(w http.ResponseWriter, r *http.Request, params ExportLinksParams)
+	// Import links
+	// (POST /api/v1/links:import)
+	ImportLinks(w http.ResponseWriter, r *http.Request)
 	// Redirect to link
 	// (GET /{linkId})
 	GetLinkById(w http.ResponseWriter, r *http.Request, linkID string)
+	// Unlock password protected link
+	// (POST /{linkId})
+	UnlockLink(w http.ResponseWriter, r *http.Request, linkID string)
 }
 
 // ServerInterfaceWrapper converts contexts to parameters.
@@ -100,14 +703,86 @@ func (siw *ServerInterfaceWrapper) LoginAdmin(w http.ResponseWriter, r *http.Req
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// ListLinks operation middleware
+func (siw *ServerInterfaceWrapper) ListLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ListLinksParams
+
+	// ------------- Optional query parameter "broken" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "broken", r.URL.Query(), &params.Broken)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "broken", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "campaign" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "campaign", r.URL.Query(), &params.Campaign)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "campaign", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "tag" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "tag", r.URL.Query(), &params.Tag)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "tag", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ListLinks(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // CreateNewLink operation middleware
 func (siw *ServerInterfaceWrapper) CreateNewLink(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	var err error
+
 	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
 
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateNewLinkParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey string
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "Idempotency-Key", runtime.ParamLocationHeader, valueList[0], &IdempotencyKey)
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.CreateNewLink(w, r)
+		siw.Handler.CreateNewLink(w, r, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -173,6 +848,247 @@ func (siw *ServerInterfaceWrapper) GetLinkMetrics(w http.ResponseWriter, r *http
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// UpdateShortLink operation middleware
+func (siw *ServerInterfaceWrapper) UpdateShortLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "linkId" -------------
+	var linkID string
+
+	err = runtime.BindStyledParameter("simple", false, "linkId", mux.Vars(r)["linkId"], &linkID)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "linkId", Err: err})
+		return
+	}
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.UpdateShortLink(w, r, linkID)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetLinkQrCode operation middleware
+func (siw *ServerInterfaceWrapper) GetLinkQrCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "linkId" -------------
+	var linkID string
+
+	err = runtime.BindStyledParameter("simple", false, "linkId", mux.Vars(r)["linkId"], &linkID)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "linkId", Err: err})
+		return
+	}
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetLinkQrCodeParams
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "size" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "size", r.URL.Query(), &params.Size)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "size", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "level" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "level", r.URL.Query(), &params.Level)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "level", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "margin" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "margin", r.URL.Query(), &params.Margin)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "margin", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "foreground" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "foreground", r.URL.Query(), &params.Foreground)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "foreground", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "background" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "background", r.URL.Query(), &params.Background)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "background", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "logo" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "logo", r.URL.Query(), &params.Logo)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "logo", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "track" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "track", r.URL.Query(), &params.Track)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "track", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetLinkQrCode(w, r, linkID, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// AggregateLinkMetrics operation middleware
+func (siw *ServerInterfaceWrapper) AggregateLinkMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params AggregateLinkMetricsParams
+
+	// ------------- Required query parameter "group_by" -------------
+
+	if paramValue := r.URL.Query().Get("group_by"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandlerFunc(w, r, &RequiredParamError{ParamName: "group_by"})
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "group_by", r.URL.Query(), &params.GroupBy)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "group_by", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.AggregateLinkMetrics(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// BatchCreateLinks operation middleware
+func (siw *ServerInterfaceWrapper) BatchCreateLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.BatchCreateLinks(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ReportDuplicateLinks operation middleware
+func (siw *ServerInterfaceWrapper) ReportDuplicateLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ReportDuplicateLinks(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ExportLinks operation middleware
+func (siw *ServerInterfaceWrapper) ExportLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ExportLinksParams
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ExportLinks(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ImportLinks operation middleware
+func (siw *ServerInterfaceWrapper) ImportLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, JWTScopes, []string{"admin"})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ImportLinks(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetLinkById operation middleware
 func (siw *ServerInterfaceWrapper) GetLinkById(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -199,6 +1115,32 @@ func (siw *ServerInterfaceWrapper) GetLinkById(w http.ResponseWriter, r *http.Re
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// UnlockLink operation middleware
+func (siw *ServerInterfaceWrapper) UnlockLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	// ------------- Path parameter "linkId" -------------
+	var linkID string
+
+	err = runtime.BindStyledParameter("simple", false, "linkId", mux.Vars(r)["linkId"], &linkID)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "linkId", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.UnlockLink(w, r, linkID)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 type UnescapedCookieParamError struct {
 	ParamName string
 	Err       error
@@ -314,13 +1256,31 @@ func HandlerWithOptions(si ServerInterface, options GorillaServerOptions) http.H
 
 	r.HandleFunc(options.BaseURL+"/api/v1/admin/login", wrapper.LoginAdmin).Methods("POST")
 
+	r.HandleFunc(options.BaseURL+"/api/v1/links", wrapper.ListLinks).Methods("GET")
+
 	r.HandleFunc(options.BaseURL+"/api/v1/links", wrapper.CreateNewLink).Methods("POST")
 
 	r.HandleFunc(options.BaseURL+"/api/v1/links/{linkId}", wrapper.DeleteShortLink).Methods("DELETE")
 
 	r.HandleFunc(options.BaseURL+"/api/v1/links/{linkId}", wrapper.GetLinkMetrics).Methods("GET")
 
+	r.HandleFunc(options.BaseURL+"/api/v1/links/{linkId}", wrapper.UpdateShortLink).Methods("PATCH")
+
+	r.HandleFunc(options.BaseURL+"/api/v1/links/{linkId}/qr", wrapper.GetLinkQrCode).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/api/v1/links:aggregate", wrapper.AggregateLinkMetrics).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/api/v1/links:batch", wrapper.BatchCreateLinks).Methods("POST")
+
+	r.HandleFunc(options.BaseURL+"/api/v1/links:duplicates", wrapper.ReportDuplicateLinks).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/api/v1/links:export", wrapper.ExportLinks).Methods("GET")
+
+	r.HandleFunc(options.BaseURL+"/api/v1/links:import", wrapper.ImportLinks).Methods("POST")
+
 	r.HandleFunc(options.BaseURL+"/{linkId}", wrapper.GetLinkById).Methods("GET")
 
+	r.HandleFunc(options.BaseURL+"/{linkId}", wrapper.UnlockLink).Methods("POST")
+
 	return r
 }
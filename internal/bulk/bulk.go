@@ -0,0 +1,353 @@
+// Package bulk reads and writes links in the formats used to import and export them in bulk.
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+var (
+	// ErrUnsupportedFormat is an error that indicates that the given format is not supported.
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrInvalidRow is an error that indicates that a row cannot be parsed.
+	// The rest of the rows can still be read.
+	ErrInvalidRow = errors.New("invalid row")
+)
+
+// Format is the format links are imported or exported in.
+type Format string
+
+const (
+	// FormatCSV is CSV with a header row.
+	FormatCSV Format = "csv"
+	// FormatNDJSON is one JSON object per line.
+	FormatNDJSON Format = "ndjson"
+	// FormatJSON is a JSON array of objects. It is supported only for export.
+	FormatJSON Format = "json"
+)
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+// FormatFromContentType returns the import format that corresponds to the given Content-Type header.
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, contentType)
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson", "application/ndjson":
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, mediaType)
+	}
+}
+
+// Row is a single link to import.
+type Row struct {
+	// Number is the number of the row in the input, starting from 1.
+	// The header of a CSV input is not counted.
+	Number int
+
+	ID     string     `json:"id,omitempty"`
+	URL    string     `json:"url"`
+	Tags   []string   `json:"tags,omitempty"`
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+// Link converts the row to a link that expires at the expiry of the row.
+func (r *Row) Link() *links.Link {
+	link := &links.Link{
+		ID:   r.ID,
+		URL:  r.URL,
+		Tags: r.Tags,
+	}
+	if r.Expiry != nil {
+		link.Schedule = &links.Schedule{
+			ActiveUntil: r.Expiry,
+			Inactive:    links.InactiveNotFound,
+		}
+	}
+	return link
+}
+
+// Reader reads rows from an input.
+type Reader interface {
+	// Read returns the next row, or io.EOF if there are no more rows.
+	//
+	// Errors that wrap ErrInvalidRow concern only the returned row and the rest of the rows can still be read.
+	// Other errors mean that the input cannot be read any further, and the returned row holds the number of the row
+	// that could not be read.
+	Read() (*Row, error)
+}
+
+// NewReader returns a reader of the given format.
+func NewReader(format Format, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		return &ndjsonReader{scanner: newScanner(r)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+}
+
+// columns are the columns of the CSV format, in the order they are exported.
+var columns = []string{"id", "url", "tags", "expiry", "clicks", "qr_scans", "created_at", "owner"}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	number  int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: missing header", ErrInvalidRow)
+		}
+		return nil, err
+	}
+
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["url"]; !ok {
+		return nil, fmt.Errorf("%w: the header has no url column", ErrInvalidRow)
+	}
+
+	return &csvReader{reader: reader, columns: cols}, nil
+}
+
+func (r *csvReader) Read() (*Row, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.number++
+			return &Row{Number: r.number}, fmt.Errorf("%w: %s", ErrInvalidRow, parseErr.Err)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return &Row{Number: r.number + 1}, err
+	}
+	r.number++
+
+	row := &Row{
+		Number: r.number,
+		ID:     r.field(record, "id"),
+		URL:    r.field(record, "url"),
+	}
+	// Tags are separated by commas, in a single quoted field.
+	if tags := r.field(record, "tags"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			row.Tags = append(row.Tags, strings.TrimSpace(tag))
+		}
+	}
+	if expiry := r.field(record, "expiry"); expiry != "" {
+		t, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			return row, fmt.Errorf("%w: expiry must be in the RFC 3339 format", ErrInvalidRow)
+		}
+		row.Expiry = &t
+	}
+	return row, nil
+}
+
+func (r *csvReader) field(record []string, column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	number  int
+}
+
+// maxLineSize is the maximum size of a single line of NDJSON input.
+const maxLineSize = 1 << 20
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return scanner
+}
+
+func (r *ndjsonReader) Read() (*Row, error) {
+	for r.scanner.Scan() {
+		r.number++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		row := &Row{}
+		if err := json.Unmarshal([]byte(line), row); err != nil {
+			return &Row{Number: r.number}, fmt.Errorf("%w: %s", ErrInvalidRow, err)
+		}
+		row.Number = r.number
+		return row, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return &Row{Number: r.number + 1}, err
+	}
+	return nil, io.EOF
+}
+
+// Writer writes links to an output.
+type Writer interface {
+	// Write writes a single link.
+	Write(link *links.Link) error
+	// Close writes everything that is still buffered and the end of the output, if the format has one.
+	Close() error
+}
+
+// NewWriter returns a writer of the given format.
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer: writer}, nil
+	case FormatNDJSON:
+		return &jsonWriter{w: w, encoder: json.NewEncoder(w)}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w, encoder: json.NewEncoder(w), array: true}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+}
+
+// exported is the representation of an exported link.
+type exported struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	Tags      []string   `json:"tags,omitempty"`
+	Expiry    *time.Time `json:"expiry,omitempty"`
+	Clicks    int        `json:"clicks"`
+	QRScans   int        `json:"qr_scans"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+}
+
+func exportedFrom(link *links.Link) exported {
+	e := exported{
+		ID:    link.ID,
+		URL:   link.URL,
+		Tags:  link.Tags,
+		Owner: link.Owner,
+	}
+	if link.Schedule != nil {
+		e.Expiry = link.Schedule.ActiveUntil
+	}
+	if link.Metrics != nil {
+		e.Clicks = link.Metrics.Clicks
+		e.QRScans = link.Metrics.QRScans
+	}
+	if !link.CreatedAt.IsZero() {
+		e.CreatedAt = &link.CreatedAt
+	}
+	return e
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) Write(link *links.Link) error {
+	e := exportedFrom(link)
+
+	var expiry, createdAt string
+	if e.Expiry != nil {
+		expiry = e.Expiry.Format(time.RFC3339)
+	}
+	if e.CreatedAt != nil {
+		createdAt = e.CreatedAt.Format(time.RFC3339)
+	}
+
+	return w.writer.Write([]string{
+		e.ID,
+		e.URL,
+		strings.Join(e.Tags, ","),
+		expiry,
+		strconv.Itoa(e.Clicks),
+		strconv.Itoa(e.QRScans),
+		createdAt,
+		e.Owner,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonWriter struct {
+	w       io.Writer
+	encoder *json.Encoder
+	// array is true if the links are written as a JSON array, instead of one per line.
+	array   bool
+	written int
+}
+
+func (w *jsonWriter) Write(link *links.Link) error {
+	if w.array {
+		sep := ","
+		if w.written == 0 {
+			sep = "["
+		}
+		if _, err := io.WriteString(w.w, sep); err != nil {
+			return err
+		}
+	}
+	w.written++
+	return w.encoder.Encode(exportedFrom(link))
+}
+
+func (w *jsonWriter) Close() error {
+	if !w.array {
+		return nil
+	}
+	end := "]\n"
+	if w.written == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
@@ -0,0 +1,170 @@
+package bulk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asankov/shortener/internal/bulk"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCSV(t *testing.T) {
+	input := `url,id,tags,expiry
+https://asankov.dev/a,a,"launch, Summer",2030-01-02T15:04:05Z
+https://asankov.dev/b
+https://asankov.dev/c,c,,tomorrow
+`
+	reader, err := bulk.NewReader(bulk.FormatCSV, strings.NewReader(input))
+	require.NoError(t, err)
+
+	rows, errs := readAll(t, reader)
+	require.Len(t, rows, 3)
+
+	expiry := time.Date(2030, time.January, 2, 15, 4, 5, 0, time.UTC)
+	require.Equal(t, &bulk.Row{Number: 1, ID: "a", URL: "https://asankov.dev/a", Tags: []string{"launch", "Summer"}, Expiry: &expiry}, rows[0])
+	require.NoError(t, errs[0])
+	require.Equal(t, &bulk.Row{Number: 2, URL: "https://asankov.dev/b"}, rows[1])
+	require.NoError(t, errs[1])
+	require.Equal(t, 3, rows[2].Number)
+	require.ErrorIs(t, errs[2], bulk.ErrInvalidRow)
+
+	t.Run("TestMissingURLColumn", func(t *testing.T) {
+		_, err := bulk.NewReader(bulk.FormatCSV, strings.NewReader("id,tags\n"))
+		require.ErrorIs(t, err, bulk.ErrInvalidRow)
+	})
+}
+
+func TestReadNDJSON(t *testing.T) {
+	input := `{"id":"a","url":"https://asankov.dev/a","tags":["launch"]}
+
+{"url":
+{"url":"https://asankov.dev/b","expiry":"2030-01-02T15:04:05Z"}
+`
+	reader, err := bulk.NewReader(bulk.FormatNDJSON, strings.NewReader(input))
+	require.NoError(t, err)
+
+	rows, errs := readAll(t, reader)
+	require.Len(t, rows, 3)
+
+	require.Equal(t, &bulk.Row{Number: 1, ID: "a", URL: "https://asankov.dev/a", Tags: []string{"launch"}}, rows[0])
+	require.Equal(t, 3, rows[1].Number)
+	require.ErrorIs(t, errs[1], bulk.ErrInvalidRow)
+	require.Equal(t, 4, rows[2].Number)
+	require.NotNil(t, rows[2].Expiry)
+	require.NoError(t, errs[2])
+}
+
+func TestReadNDJSONTooLong(t *testing.T) {
+	input := `{"id":"a","url":"https://asankov.dev/a"}
+{"url":"https://asankov.dev/` + strings.Repeat("b", 1<<20) + `"}
+{"id":"c","url":"https://asankov.dev/c"}
+`
+	reader, err := bulk.NewReader(bulk.FormatNDJSON, strings.NewReader(input))
+	require.NoError(t, err)
+
+	row, err := reader.Read()
+	require.NoError(t, err)
+	require.Equal(t, "a", row.ID)
+
+	row, err = reader.Read()
+	require.Error(t, err)
+	require.NotErrorIs(t, err, bulk.ErrInvalidRow)
+	require.Equal(t, 2, row.Number)
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	format, err := bulk.FormatFromContentType("text/csv; charset=utf-8")
+	require.NoError(t, err)
+	require.Equal(t, bulk.FormatCSV, format)
+
+	format, err = bulk.FormatFromContentType("application/x-ndjson")
+	require.NoError(t, err)
+	require.Equal(t, bulk.FormatNDJSON, format)
+
+	_, err = bulk.FormatFromContentType("application/json")
+	require.ErrorIs(t, err, bulk.ErrUnsupportedFormat)
+}
+
+func TestWrite(t *testing.T) {
+	expiry := time.Date(2030, time.January, 2, 15, 4, 5, 0, time.UTC)
+	link := &links.Link{
+		ID:       "a",
+		URL:      "https://asankov.dev/a",
+		Tags:     []string{"launch", "summer"},
+		Schedule: &links.Schedule{ActiveUntil: &expiry},
+		Metrics:  &links.Metrics{Clicks: 3, QRScans: 1},
+		Owner:    "admin@asankov.dev",
+	}
+
+	t.Run("TestCSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, err := bulk.NewWriter(bulk.FormatCSV, &buf)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(link))
+		require.NoError(t, writer.Close())
+
+		require.Equal(t, "id,url,tags,expiry,clicks,qr_scans,created_at,owner\n"+
+			`a,https://asankov.dev/a,"launch,summer",2030-01-02T15:04:05Z,3,1,,admin@asankov.dev`+"\n", buf.String())
+	})
+
+	t.Run("TestNDJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, err := bulk.NewWriter(bulk.FormatNDJSON, &buf)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(link))
+		require.NoError(t, writer.Write(link))
+		require.NoError(t, writer.Close())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		require.JSONEq(t, `{"id":"a","url":"https://asankov.dev/a","tags":["launch","summer"],"expiry":"2030-01-02T15:04:05Z","clicks":3,"qr_scans":1,"owner":"admin@asankov.dev"}`, lines[0])
+	})
+
+	t.Run("TestJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, err := bulk.NewWriter(bulk.FormatJSON, &buf)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(link))
+		require.NoError(t, writer.Write(link))
+		require.NoError(t, writer.Close())
+
+		var exported []map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &exported))
+		require.Len(t, exported, 2)
+	})
+
+	t.Run("TestEmptyJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, err := bulk.NewWriter(bulk.FormatJSON, &buf)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		require.JSONEq(t, `[]`, buf.String())
+	})
+}
+
+func readAll(t *testing.T, reader bulk.Reader) ([]*bulk.Row, []error) {
+	t.Helper()
+
+	var (
+		rows []*bulk.Row
+		errs []error
+	)
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, errs
+		}
+		if err != nil {
+			require.ErrorIs(t, err, bulk.ErrInvalidRow)
+		}
+		rows = append(rows, row)
+		errs = append(errs, err)
+	}
+}
@@ -0,0 +1,94 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/asankov/shortener/internal/cache"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+type store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+func TestCaches(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+
+	lru, err := cache.NewLRU(10)
+	require.NoError(t, err)
+	caches := map[string]store{
+		"TestLRU":   lru,
+		"TestRedis": cache.NewRedis(client, "test:"),
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, ok, err := c.Get(ctx, "key")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			set := []byte("value")
+			require.NoError(t, c.Set(ctx, "key", set, time.Minute))
+			require.NoError(t, c.Set(ctx, "empty", []byte{}, time.Minute))
+			value, ok, err := c.Get(ctx, "key")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, []byte("value"), value)
+
+			// The callers get copies of the values, which they can modify.
+			set[0], value[0] = 'x', 'y'
+			value, _, err = c.Get(ctx, "key")
+			require.NoError(t, err)
+			require.Equal(t, []byte("value"), value)
+			value, ok, err = c.Get(ctx, "empty")
+			require.NoError(t, err)
+			require.True(t, ok, "the empty values are cached as well")
+			require.Empty(t, value)
+
+			require.NoError(t, c.Delete(ctx, "key", "empty", "missing"))
+			_, ok, err = c.Get(ctx, "key")
+			require.NoError(t, err)
+			require.False(t, ok)
+			_, ok, err = c.Get(ctx, "empty")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			require.NoError(t, c.Set(ctx, "expiring", []byte("value"), 10*time.Millisecond))
+			time.Sleep(20 * time.Millisecond)
+			server.FastForward(20 * time.Millisecond)
+			_, ok, err = c.Get(ctx, "expiring")
+			require.NoError(t, err)
+			require.False(t, ok, "the values expire after their TTL")
+		})
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewLRU(2)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("a"), time.Minute))
+	require.NoError(t, c.Set(ctx, "b", []byte("b"), time.Minute))
+	_, ok, _ := c.Get(ctx, "a")
+	require.True(t, ok)
+	require.NoError(t, c.Set(ctx, "c", []byte("c"), time.Minute))
+
+	_, ok, _ = c.Get(ctx, "b")
+	require.False(t, ok, "the least recently used value is evicted")
+	_, ok, _ = c.Get(ctx, "a")
+	require.True(t, ok)
+	_, ok, _ = c.Get(ctx, "c")
+	require.True(t, ok)
+}
@@ -0,0 +1,58 @@
+// Package cache holds values by key for a limited time, either in the memory of the process or in a shared store.
+//
+// The values are stored as bytes, so that the callers get copies of them that they can modify.
+package cache
+
+import (
+	"context"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// entry is a value in an LRU cache, together with the time it expires.
+type entry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRU keeps up to a fixed number of values in the memory of the process and evicts the least recently used ones.
+type LRU struct {
+	entries *lru.Cache[string, entry]
+}
+
+// NewLRU creates a new LRU cache that holds up to size values.
+func NewLRU(size int) (*LRU, error) {
+	entries, err := lru.New[string, entry](size)
+	if err != nil {
+		return nil, err
+	}
+	return &LRU{entries: entries}, nil
+}
+
+// Get returns the value of the given key and whether it was found and has not expired.
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	e, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !time.Now().Before(e.expiresAt) {
+		c.entries.Remove(key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), e.value...), true, nil
+}
+
+// Set stores the value of the given key until ttl passes.
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.entries.Add(key, entry{value: append([]byte(nil), value...), expiresAt: time.Now().Add(ttl)})
+	return nil
+}
+
+// Delete removes the values of the given keys.
+func (c *LRU) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		c.entries.Remove(key)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keeps the values in Redis, so that all the replicas of the service share them.
+type Redis struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedis creates a new Redis cache that stores the values with the given client,
+// under keys that start with the given prefix, e.g. shortener:links:.
+func NewRedis(client redis.Cmdable, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Get returns the value of the given key and whether it was found.
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error while getting %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Set stores the value of the given key until ttl passes.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := c.client.Set(ctx, c.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("error while setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes the values of the given keys.
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, c.prefix+key)
+	}
+	if err := c.client.Del(ctx, prefixed...).Err(); err != nil {
+		return fmt.Errorf("error while deleting %d keys: %w", len(keys), err)
+	}
+	return nil
+}
@@ -1,32 +1,283 @@
 package config
 
 import (
-	"github.com/kelseyhightower/envconfig"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asankov/shortener/internal/ratelimit"
+	"golang.org/x/exp/slog"
 )
 
 // Config is the struct that configures the service.
+//
+// The options tagged as reloadable can be changed while the service is running, see Reloader.
 type Config struct {
 	// Port controls on which port the service will listen to.
 	Port int `default:"8080"`
+	// AdminPort controls on which port the operational endpoints, e.g. /metrics, are served.
+	//
+	// It should not be exposed publicly.
+	AdminPort int `split_words:"true" default:"9090"`
 	// Secret is the secret used to generate the JWT token.
-	Secret string `required:"true"`
+	Secret string `required:"true" secret:"true"`
+
+	// ReadHeaderTimeout controls how long the server waits for the headers of a request.
+	ReadHeaderTimeout time.Duration `split_words:"true" default:"5s"`
+	// ReadTimeout controls how long the server waits for a whole request, including the body, e.g. of an import.
+	ReadTimeout time.Duration `split_words:"true" default:"1m"`
+	// WriteTimeout controls how long the server can take to write a response, e.g. of an export.
+	WriteTimeout time.Duration `split_words:"true" default:"5m"`
+	// IdleTimeout controls how long a keep-alive connection is kept open between two requests.
+	IdleTimeout time.Duration `split_words:"true" default:"2m"`
+
+	// ShutdownDrainPeriod controls how long the service keeps serving requests after receiving a termination signal,
+	// while reporting that it is not ready, so that the load balancers stop sending new requests to it.
+	ShutdownDrainPeriod time.Duration `split_words:"true" default:"5s"`
+	// ShutdownTimeout controls how long the service waits for the in-flight requests to complete after the drain period.
+	ShutdownTimeout time.Duration `split_words:"true" default:"20s"`
+
 	// UseInMemoryDB controls whether an in-memory DB will be used for the service.
 	//
 	// This is useful for local testing, but not for production use.
 	UseInMemoryDB bool `envconfig:"SHORTENER_USE_IN_MEMORY_DB"`
+	// AWSRegion is the AWS region of the DynamoDB tables.
+	AWSRegion string `envconfig:"SHORTENER_AWS_REGION" default:"eu-west-1"`
+	// LinksTable is the name of the DynamoDB table of the links.
+	LinksTable string `split_words:"true" default:"links"`
+	// UsersTable is the name of the DynamoDB table of the users.
+	UsersTable string `split_words:"true" default:"users"`
+	// IdempotencyTable is the name of the DynamoDB table of the idempotency keys.
+	IdempotencyTable string `split_words:"true" default:"idempotency_keys"`
+
 	// ForceGenerateAdminUser controls whether or not to ALWAYS generate an admin user on startup.
 	//
 	// If true, an admin user will be created on startup.
 	// If false, an admin user might be created due to other conditions.
 	ForceGenerateAdminUser bool `split_words:"true"`
+
+	// LinkCheckEnabled controls whether the destinations of the links will be periodically checked for availability.
+	LinkCheckEnabled bool `split_words:"true"`
+	// LinkCheckInterval controls how often the destinations of all links are checked.
+	LinkCheckInterval time.Duration `split_words:"true" default:"1h"`
+	// LinkCheckConcurrency controls how many requests can be sent to the destinations at the same time.
+	LinkCheckConcurrency int `split_words:"true" default:"10"`
+	// LinkCheckHostDelay controls the minimum time between two requests to the same host.
+	LinkCheckHostDelay time.Duration `split_words:"true" default:"1s"`
+	// LinkCheckTimeout controls how long to wait for a destination to respond before considering it broken,
+	// not counting the wait for LinkCheckHostDelay.
+	LinkCheckTimeout time.Duration `split_words:"true" default:"10s"`
+
+	// GeoIPDatabase is the path to the file used to look up the country of the visitors.
+	//
+	// If empty, targeting rules with country conditions never match.
+	GeoIPDatabase string `envconfig:"SHORTENER_GEOIP_DATABASE"`
+	// TrustForwardedFor controls whether the X-Forwarded-For header is used to get the IP address of the clients.
+	//
+	// This should be enabled only when the service is running behind a trusted proxy.
+	TrustForwardedFor bool `split_words:"true"`
+	// TrustedProxyHops controls how many trusted proxies in front of the service append an address to the X-Forwarded-For header.
+	//
+	// The address of the client is the one that many entries from the right, since the entries to the left of it are set by the client.
+	TrustedProxyHops int `split_words:"true" default:"1"`
+
+	// LinkPasswordAttempts controls how many wrong passwords a client can submit for a link
+	// in LinkPasswordAttemptsWindow before being rejected.
+	LinkPasswordAttempts int `split_words:"true" default:"5" reloadable:"true"`
+	// LinkPasswordAttemptsPerLink controls how many wrong passwords all clients together can submit for a link
+	// in LinkPasswordAttemptsWindow before being rejected, so that changing the client address does not lift the limit.
+	LinkPasswordAttemptsPerLink int `split_words:"true" default:"50" reloadable:"true"`
+	// LinkPasswordAttemptsWindow controls the period in which the wrong passwords are counted.
+	LinkPasswordAttemptsWindow time.Duration `split_words:"true" default:"15m" reloadable:"true"`
+	// LinkAccessTTL controls for how long a visitor that entered the password of a link is not prompted again.
+	LinkAccessTTL time.Duration `split_words:"true" default:"1h"`
+
+	// RateLimitsPerIP controls how many requests a client IP address can make to a route, by the method and the path
+	// template of the route, e.g. "GET /{linkId}:100/1m,POST /api/v1/links:import:1/1m,*:1000/1m",
+	// where * applies to the routes that are not listed. The limit is separated from the route with the last colon.
+	//
+	// Each route has a bucket of its own, which holds up to the given number of requests and is refilled in the given period.
+	RateLimitsPerIP map[string]ratelimit.Limit `split_words:"true" default:"" reloadable:"true"`
+	// RateLimitsPerUser controls how many requests an authenticated user can make to a route, in the same format as RateLimitsPerIP.
+	RateLimitsPerUser map[string]ratelimit.Limit `split_words:"true" default:"" reloadable:"true"`
+	// RateLimitsPerLink controls how many requests can be made to a route for the same link, by all clients together,
+	// in the same format as RateLimitsPerIP, e.g. "GET /{linkId}:6000/1m".
+	RateLimitsPerLink map[string]ratelimit.Limit `split_words:"true" default:"" reloadable:"true"`
+	// RateLimitStore controls where the buckets of the rate limits are kept, which is either "memory" or "redis".
+	//
+	// With "memory" each replica of the service has buckets of its own, so the limits are multiplied by the number of replicas.
+	RateLimitStore string `split_words:"true" default:"memory"`
+	// RedisAddress is the address of the Redis server, e.g. redis:6379, that is used for the shared state of the replicas.
+	RedisAddress string `split_words:"true"`
+
+	// DeniedDestinations controls the hosts that the links cannot send their visitors to, e.g. "phishing.example,malware.example".
+	// The subdomains of the hosts are denied as well.
+	//
+	// It applies to the links that are created, imported or whose destinations are changed, and not to the existing links.
+	DeniedDestinations []string `split_words:"true" default:"" reloadable:"true"`
+
+	// AlwaysInterstitial controls whether the visitors of all links are shown a page with the destination
+	// before being redirected to it, regardless of the setting of the link.
+	AlwaysInterstitial bool `split_words:"true"`
+	// InterstitialDelay controls how long the page with the destination is shown before the visitor is redirected.
+	InterstitialDelay time.Duration `split_words:"true" default:"5s"`
+
+	// BatchMaxLinks controls how many links can be created with a single batch request.
+	//
+	// Atomic batches in DynamoDB are limited to 100 links.
+	BatchMaxLinks int `split_words:"true" default:"100"`
+
+	// IdempotencyKeyTTL controls for how long the response of a request with an Idempotency-Key header
+	// is replayed for the retries of the request.
+	IdempotencyKeyTTL time.Duration `split_words:"true" default:"24h"`
+
+	// StorageReadTimeout controls how long a single read from the storage, e.g. a lookup of a link, can take.
+	//
+	// Zero means that the reads are not limited.
+	StorageReadTimeout time.Duration `split_words:"true" default:"2s"`
+	// StorageWriteTimeout controls how long a single write to the storage, e.g. the creation of a link, can take.
+	//
+	// Zero means that the writes are not limited.
+	StorageWriteTimeout time.Duration `split_words:"true" default:"5s"`
+	// StorageScanTimeout controls how long a read of all links, e.g. for an export, can take.
+	//
+	// Zero means that the scans are not limited.
+	StorageScanTimeout time.Duration `split_words:"true" default:"5m"`
+
+	// LinkCacheSize controls how many links each replica keeps in memory, so that the visits of the popular links
+	// do not read them from the storage. Zero means that the links are not cached in memory.
+	LinkCacheSize int `split_words:"true" default:"10000"`
+	// LinkCacheTTL controls for how long a link is cached. The other replicas see the changes of a link once it expires.
+	// Zero means that the links are not cached.
+	LinkCacheTTL time.Duration `split_words:"true" default:"30s"`
+	// LinkCacheNegativeTTL controls for how long the IDs of the links that do not exist are cached.
+	// Zero means that they are not cached.
+	LinkCacheNegativeTTL time.Duration `split_words:"true" default:"5s"`
+	// LinkCacheShared controls whether the links are cached in the Redis server at RedisAddress as well,
+	// so that the replicas share them.
+	LinkCacheShared bool `split_words:"true"`
+
+	// ReadinessCheckTimeout controls how long the check of the storage connectivity for the readiness endpoint can take.
+	ReadinessCheckTimeout time.Duration `split_words:"true" default:"2s"`
+	// ReadinessCacheTTL controls for how long the result of the check of the storage connectivity is reused,
+	// so that frequent probes do not overload the storage.
+	ReadinessCacheTTL time.Duration `split_words:"true" default:"5s"`
+
+	// LogFormat controls the format of the logs, which is either "text" or "json".
+	LogFormat string `split_words:"true" default:"text"`
+	// LogLevel controls the minimum level of the logged records, e.g. DEBUG, INFO, WARN or ERROR.
+	LogLevel slog.Level `split_words:"true" default:"INFO" reloadable:"true"`
+	// AccessLogEnabled controls whether a record is logged for each request.
+	AccessLogEnabled bool `split_words:"true" default:"true"`
+	// AccessLogSampleRates controls the share of the requests to a route that are logged, by the method and the path
+	// template of the route, e.g. "GET /{linkId}:0.1,GET /api/v1/links:export:1,GET /readyz:0",
+	// where the rate is separated from the route with the last colon. The requests to the other routes are all logged.
+	//
+	// The requests that fail with a server error are always logged.
+	AccessLogSampleRates map[string]float64 `split_words:"true" default:"GET /healthz:0,GET /readyz:0" reloadable:"true"`
+
+	// TracingEnabled controls whether the requests and the calls to the storage are traced
+	// and the spans are exported with OTLP over HTTP.
+	//
+	// The exporter is configured with the standard OTEL_EXPORTER_OTLP_* environment variables.
+	TracingEnabled bool `split_words:"true"`
+	// TracingSampleRatio controls the share of the traces that are sampled, unless the caller has sampled the trace.
+	TracingSampleRatio float64 `split_words:"true" default:"1"`
+
+	// PublicURL is the URL the service is reachable at, e.g. https://sh.asankov.dev, used to build the short links.
+	//
+	// If empty, it is derived from the incoming requests.
+	PublicURL string `split_words:"true"`
+	// QRLogo is the path to a PNG or JPEG image that can be drawn in the center of the QR codes of the links.
+	QRLogo string `envconfig:"SHORTENER_QR_LOGO"`
 }
 
 // NewFromEnv creates new config with values loaded from environment variables.
+//
+// It returns an error if the config is not valid.
 func NewFromEnv() (*Config, error) {
-	var config Config
-	if err := envconfig.Process("SHORTENER", &config); err != nil {
-		return nil, err
+	return load(nil, nil)
+}
+
+// Validate returns all the problems with the values of the config, if there are any.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port >= 0 && c.Port <= 65535, "port must be between 0 and 65535, got %d", c.Port)
+	check(c.AdminPort >= 0 && c.AdminPort <= 65535, "admin_port must be between 0 and 65535, got %d", c.AdminPort)
+	check(c.Port == 0 || c.Port != c.AdminPort, "port and admin_port must be different, both are %d", c.Port)
+	check(c.Secret != "", "secret cannot be empty")
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_drain_period", c.ShutdownDrainPeriod},
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"link_check_host_delay", c.LinkCheckHostDelay},
+		{"link_check_timeout", c.LinkCheckTimeout},
+		{"link_password_attempts_window", c.LinkPasswordAttemptsWindow},
+		{"link_access_ttl", c.LinkAccessTTL},
+		{"interstitial_delay", c.InterstitialDelay},
+		{"idempotency_key_ttl", c.IdempotencyKeyTTL},
+		{"storage_read_timeout", c.StorageReadTimeout},
+		{"storage_write_timeout", c.StorageWriteTimeout},
+		{"storage_scan_timeout", c.StorageScanTimeout},
+		{"link_cache_ttl", c.LinkCacheTTL},
+		{"link_cache_negative_ttl", c.LinkCacheNegativeTTL},
+		{"readiness_check_timeout", c.ReadinessCheckTimeout},
+		{"readiness_cache_ttl", c.ReadinessCacheTTL},
+	}
+	for _, d := range durations {
+		check(d.value >= 0, "%s cannot be negative, got %s", d.name, d.value)
+	}
+
+	if !c.UseInMemoryDB {
+		check(c.AWSRegion != "", "aws_region cannot be empty")
+		check(c.LinksTable != "", "links_table cannot be empty")
+		check(c.UsersTable != "", "users_table cannot be empty")
+		check(c.IdempotencyTable != "", "idempotency_table cannot be empty")
+		check(c.BatchMaxLinks <= 100, "batch_max_links cannot be more than 100 with DynamoDB, got %d", c.BatchMaxLinks)
+	}
+
+	if c.LinkCheckEnabled {
+		check(c.LinkCheckInterval > 0, "link_check_interval must be positive, got %s", c.LinkCheckInterval)
+		check(c.LinkCheckConcurrency > 0, "link_check_concurrency must be positive, got %d", c.LinkCheckConcurrency)
+	}
+	check(c.TrustedProxyHops > 0, "trusted_proxy_hops must be positive, got %d", c.TrustedProxyHops)
+	check(c.LinkPasswordAttempts > 0, "link_password_attempts must be positive, got %d", c.LinkPasswordAttempts)
+	check(c.LinkPasswordAttemptsPerLink > 0, "link_password_attempts_per_link must be positive, got %d", c.LinkPasswordAttemptsPerLink)
+	check(c.RateLimitStore == "memory" || c.RateLimitStore == "redis", `rate_limit_store must be "memory" or "redis", got %q`, c.RateLimitStore)
+	check(c.RateLimitStore != "redis" || c.RedisAddress != "", `redis_address cannot be empty when rate_limit_store is "redis"`)
+	check(c.LinkCacheSize >= 0, "link_cache_size cannot be negative, got %d", c.LinkCacheSize)
+	check(!c.LinkCacheShared || c.RedisAddress != "", "redis_address cannot be empty when link_cache_shared is enabled")
+	check(c.BatchMaxLinks > 0, "batch_max_links must be positive, got %d", c.BatchMaxLinks)
+
+	for _, host := range c.DeniedDestinations {
+		check(host != "" && !strings.ContainsAny(host, "/:, "), "denied_destinations must be host names, got %q", host)
+	}
+
+	check(c.LogFormat == "text" || c.LogFormat == "json", `log_format must be "text" or "json", got %q`, c.LogFormat)
+	for operation, rate := range c.AccessLogSampleRates {
+		check(rate >= 0 && rate <= 1, "the access_log_sample_rates of %q must be between 0 and 1, got %v", operation, rate)
+	}
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio must be between 0 and 1, got %v", c.TracingSampleRatio)
+
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		check(err == nil && u.IsAbs() && u.Host != "", "public_url must be an absolute URL, got %q", c.PublicURL)
 	}
 
-	return &config, nil
+	return errors.Join(errs...)
 }
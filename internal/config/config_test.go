@@ -1,11 +1,17 @@
 package config_test
 
 import (
+	"bytes"
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/asankov/shortener/internal/config"
+	"github.com/asankov/shortener/internal/ratelimit"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
 )
 
 const secret = "abc123-secret"
@@ -19,12 +25,23 @@ func TestDefaults(t *testing.T) {
 	require.Equal(t, 8080, config.Port)
 	require.Equal(t, secret, config.Secret)
 	require.False(t, config.ForceGenerateAdminUser)
+	require.False(t, config.LinkCheckEnabled)
+	require.Equal(t, time.Hour, config.LinkCheckInterval)
+	require.Equal(t, 10, config.LinkCheckConcurrency)
+	require.Equal(t, "text", config.LogFormat)
+	require.Equal(t, slog.LevelInfo, config.LogLevel)
+	require.True(t, config.AccessLogEnabled)
+	require.Equal(t, map[string]float64{"GET /healthz": 0, "GET /readyz": 0}, config.AccessLogSampleRates)
+	require.Equal(t, 10000, config.LinkCacheSize)
+	require.Equal(t, "memory", config.RateLimitStore)
 }
 
 func TestAllSet(t *testing.T) {
 	setenv(t, "SHORTENER_PORT", "1234")
 	setenv(t, "SHORTENER_SECRET", secret)
 	setenv(t, "SHORTENER_FORCE_GENERATE_ADMIN_USER", "true")
+	setenv(t, "SHORTENER_LOG_LEVEL", "debug")
+	setenv(t, "SHORTENER_ACCESS_LOG_SAMPLE_RATES", "GET /{linkId}:0.25,GET /api/v1/links:export:0.5")
 
 	config, err := config.NewFromEnv()
 
@@ -32,6 +49,8 @@ func TestAllSet(t *testing.T) {
 	require.Equal(t, 1234, config.Port)
 	require.Equal(t, secret, config.Secret)
 	require.True(t, config.ForceGenerateAdminUser)
+	require.Equal(t, slog.LevelDebug, config.LogLevel)
+	require.Equal(t, map[string]float64{"GET /{linkId}": 0.25, "GET /api/v1/links:export": 0.5}, config.AccessLogSampleRates)
 }
 
 func TestRequired(t *testing.T) {
@@ -40,6 +59,284 @@ func TestRequired(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, `
+port: 1000
+admin_port: 2000
+secret: from-file
+link_check_interval: 2h
+access_log_sample_rates:
+  GET /{linkId}: 0.5
+  POST /api/v1/links:import: 0
+`)
+	setenv(t, "SHORTENER_ADMIN_PORT", "3000")
+	setenv(t, "SHORTENER_LINK_CHECK_INTERVAL", "3h")
+
+	config, flags, err := config.Load([]string{"--config", file, "--link-check-interval=4h", "--use-in-memory-db"})
+
+	require.NoError(t, err)
+	require.Equal(t, file, flags.ConfigFile)
+	require.False(t, flags.PrintConfig)
+	require.Equal(t, 1000, config.Port, "the file overrides the default")
+	require.Equal(t, 3000, config.AdminPort, "the environment overrides the file")
+	require.Equal(t, 4*time.Hour, config.LinkCheckInterval, "the flags override the environment")
+	require.Equal(t, "from-file", config.Secret)
+	require.True(t, config.UseInMemoryDB)
+	require.Equal(t, map[string]float64{"GET /{linkId}": 0.5, "POST /api/v1/links:import": 0}, config.AccessLogSampleRates)
+	require.Equal(t, "links", config.LinksTable)
+}
+
+func TestLoadErrors(t *testing.T) {
+	file := writeFile(t, `
+port: abc
+unknown_option: true
+`)
+
+	_, _, err := config.Load([]string{"--config", file, "--link-check-timeout=soon"})
+
+	require.Error(t, err)
+	for _, problem := range []string{
+		`invalid value "abc" of key port of the config file`,
+		`invalid value "soon" of flag --link-check-timeout`,
+		"secret is required",
+		"unknown key unknown_option in the config file",
+	} {
+		require.ErrorContains(t, err, problem)
+	}
+}
+
+func TestLoadMaps(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	file := writeFile(t, `
+rate_limits_per_ip:
+  "POST /api/v1/links:batch": 10/1m
+  GET /{linkId}: 100/1m
+access_log_sample_rates:
+  GET /{linkId}: 0.5
+`)
+
+	loaded, _, err := config.Load([]string{"--config", file, "--rate-limits-per-link", "GET /{linkId}:5/s, POST /api/v1/links:batch:1/s"})
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]ratelimit.Limit{
+		"POST /api/v1/links:batch": {Count: 10, Period: time.Minute},
+		"GET /{linkId}":            {Count: 100, Period: time.Minute},
+	}, loaded.RateLimitsPerIP)
+	require.Equal(t, map[string]ratelimit.Limit{
+		"GET /{linkId}":            {Count: 5, Period: time.Second},
+		"POST /api/v1/links:batch": {Count: 1, Period: time.Second},
+	}, loaded.RateLimitsPerLink)
+	require.Equal(t, map[string]float64{"GET /{linkId}": 0.5}, loaded.AccessLogSampleRates)
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		file := writeFile(t, `
+rate_limits_per_ip:
+  GET /{linkId}: often
+access_log_sample_rates: [0.5]
+`)
+
+		_, _, err := config.Load([]string{"--config", file})
+
+		require.Error(t, err)
+		for _, problem := range []string{
+			`invalid value at line 3 of key rate_limits_per_ip of the config file: invalid value "often" of "GET /{linkId}"`,
+			"invalid value at line 4 of key access_log_sample_rates of the config file: a list cannot be set to map[string]float64",
+		} {
+			require.ErrorContains(t, err, problem)
+		}
+	})
+}
+
+func TestRateLimits(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	setenv(t, "SHORTENER_RATE_LIMITS_PER_USER", "POST /api/v1/links:import:1/1m,*:600/1m")
+	file := writeFile(t, `
+rate_limits_per_ip:
+  POST /api/v1/links:import: 2/1m
+`)
+
+	loaded, _, err := config.Load([]string{"--config", file, "--rate-limits-per-link=POST /api/v1/links:import:3/1m"})
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]ratelimit.Limit{"POST /api/v1/links:import": {Count: 2, Period: time.Minute}}, loaded.RateLimitsPerIP)
+	require.Equal(t, map[string]ratelimit.Limit{
+		"POST /api/v1/links:import": {Count: 1, Period: time.Minute},
+		"*":                         {Count: 600, Period: time.Minute},
+	}, loaded.RateLimitsPerUser)
+	require.Equal(t, map[string]ratelimit.Limit{"POST /api/v1/links:import": {Count: 3, Period: time.Minute}}, loaded.RateLimitsPerLink)
+}
+
+func TestDeniedDestinations(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	setenv(t, "SHORTENER_DENIED_DESTINATIONS", "evil.example, phishing.example")
+
+	loaded, err := config.NewFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, []string{"evil.example", "phishing.example"}, loaded.DeniedDestinations)
+	require.NoError(t, os.Unsetenv("SHORTENER_DENIED_DESTINATIONS"))
+
+	t.Run("TestFile", func(t *testing.T) {
+		file := writeFile(t, `
+denied_destinations:
+  - evil.example
+  - "phishing.example,malware.example"
+`)
+
+		_, _, err := config.Load([]string{"--config", file})
+
+		require.ErrorContains(t, err, `denied_destinations must be host names, got "phishing.example,malware.example"`, "the items of the lists are not split")
+	})
+
+	t.Run("TestPrint", func(t *testing.T) {
+		var b bytes.Buffer
+		require.NoError(t, loaded.Print(&b))
+		require.Contains(t, b.String(), "denied_destinations:\n    - evil.example\n    - phishing.example\n")
+
+		reloaded, _, err := config.Load([]string{"--config", writeFile(t, b.String()), "--secret", secret})
+		require.NoError(t, err)
+		require.Equal(t, loaded, reloaded)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	setenv(t, "SHORTENER_ADMIN_PORT", "8080")
+	setenv(t, "SHORTENER_LOG_FORMAT", "xml")
+	setenv(t, "SHORTENER_TRACING_SAMPLE_RATIO", "2")
+	setenv(t, "SHORTENER_LINKS_TABLE", "")
+	setenv(t, "SHORTENER_RATE_LIMIT_STORE", "redis")
+
+	_, err := config.NewFromEnv()
+
+	require.Error(t, err)
+	for _, problem := range []string{
+		"port and admin_port must be different",
+		`log_format must be "text" or "json"`,
+		"tracing_sample_ratio must be between 0 and 1",
+		"links_table cannot be empty",
+		`redis_address cannot be empty when rate_limit_store is "redis"`,
+	} {
+		require.ErrorContains(t, err, problem)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	setenv(t, "SHORTENER_LOG_LEVEL", "warn")
+	setenv(t, "SHORTENER_RATE_LIMITS_PER_IP", "GET /{linkId}:100/1m,POST /api/v1/links:batch:10/1m,*:10/s")
+
+	loaded, err := config.NewFromEnv()
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, loaded.Print(&b))
+	require.NotContains(t, b.String(), secret)
+	require.Contains(t, b.String(), "secret: '[REDACTED]'\n")
+	require.Contains(t, b.String(), "log_level: WARN\n")
+	require.Contains(t, b.String(), "link_check_interval: 1h0m0s\n")
+	require.Equal(t, ratelimit.Limit{Count: 100, Period: time.Minute}, loaded.RateLimitsPerIP["GET /{linkId}"])
+	require.Contains(t, b.String(), "  GET /{linkId}: 100/1m0s\n")
+	require.Equal(t, ratelimit.Limit{Count: 10, Period: time.Minute}, loaded.RateLimitsPerIP["POST /api/v1/links:batch"])
+
+	// The printed config can be used as a config file.
+	require.NoError(t, os.Unsetenv("SHORTENER_RATE_LIMITS_PER_IP"))
+	reloaded, _, err := config.Load([]string{"--config", writeFile(t, b.String()), "--secret", secret})
+	require.NoError(t, err)
+	require.Equal(t, loaded, reloaded)
+}
+
+func TestReload(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	file := writeFile(t, "log_level: warn\n")
+	args := []string{"--config", file}
+
+	initial, _, err := config.Load(args)
+	require.NoError(t, err)
+	reloader := config.NewReloader(initial).SetLoader(func() (*config.Config, error) {
+		c, _, err := config.Load(args)
+		return c, err
+	})
+	var reloaded []*config.Config
+	reloader.OnReload(func(c *config.Config) {
+		reloaded = append(reloaded, c)
+	})
+	status := reloader.Status()
+	require.Equal(t, 1, status.Version)
+
+	t.Run("TestReloadable", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte("log_level: debug\nlink_password_attempts: 10\n"), 0o600))
+
+		require.NoError(t, reloader.Reload())
+
+		active := reloader.Active()
+		require.Equal(t, slog.LevelDebug, active.LogLevel)
+		require.Equal(t, 10, active.LinkPasswordAttempts)
+		require.Equal(t, slog.LevelWarn, initial.LogLevel, "the active config is replaced, not modified")
+		require.Equal(t, []*config.Config{active}, reloaded)
+		require.Equal(t, 2, reloader.Status().Version)
+		require.NotEqual(t, status.Checksum, reloader.Status().Checksum)
+	})
+	t.Run("TestInvalid", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte("log_level: loud\n"), 0o600))
+
+		require.Error(t, reloader.Reload())
+
+		require.Equal(t, slog.LevelDebug, reloader.Active().LogLevel)
+		require.Equal(t, 2, reloader.Status().Version)
+		require.Contains(t, reloader.Status().LastReloadError, `invalid value "loud" of key log_level`)
+	})
+	t.Run("TestRestartRequired", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(file, []byte("log_level: debug\nlink_password_attempts: 10\nport: 8000\n"), 0o600))
+
+		require.NoError(t, reloader.Reload())
+
+		require.Equal(t, 8080, reloader.Active().Port)
+		require.Equal(t, 2, reloader.Status().Version, "nothing that can be reloaded has changed")
+		require.Empty(t, reloader.Status().LastReloadError)
+		require.Equal(t, []string{"port"}, reloader.Status().RestartRequired)
+		require.Len(t, reloaded, 1)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	setenv(t, "SHORTENER_SECRET", secret)
+	file := writeFile(t, "log_level: warn\n")
+	args := []string{"--config", file}
+
+	initial, _, err := config.Load(args)
+	require.NoError(t, err)
+	reloader := config.NewReloader(initial).SetLoader(func() (*config.Config, error) {
+		c, _, err := config.Load(args)
+		return c, err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- reloader.Watch(ctx, file)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	// The file is replaced, rather than written to, as editors and Kubernetes do.
+	require.Eventually(t, func() bool {
+		replacement := filepath.Join(filepath.Dir(file), "config.yaml.tmp")
+		require.NoError(t, os.WriteFile(replacement, []byte("log_level: error\n"), 0o600))
+		require.NoError(t, os.Rename(replacement, file))
+		return reloader.Active().LogLevel == slog.LevelError
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
 func setenv(t *testing.T, key, value string) {
 	t.Helper()
 
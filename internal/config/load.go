@@ -0,0 +1,382 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables of the config.
+const envPrefix = "SHORTENER_"
+
+// configFileEnv is the environment variable with the path to the config file, if the --config flag is not set.
+const configFileEnv = envPrefix + "CONFIG_FILE"
+
+var (
+	wordsRegexp   = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+	acronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+)
+
+// Flags are the command-line flags that control how the service is started, rather than how it runs.
+type Flags struct {
+	// ConfigFile is the path to the YAML file the config was loaded from, if any.
+	ConfigFile string
+	// PrintConfig controls whether the config should be printed instead of starting the service.
+	PrintConfig bool
+}
+
+// option is a field of the config, with the names it has in the different sources.
+type option struct {
+	field reflect.StructField
+	value reflect.Value
+
+	// env is the name of the environment variable, e.g. SHORTENER_LINK_CHECK_INTERVAL.
+	env string
+	// key is the key in the config file, e.g. link_check_interval.
+	key string
+	// flag is the name of the command-line flag, e.g. link-check-interval.
+	flag string
+}
+
+// options returns the options of the given config, in the order of the fields.
+//
+// The names are derived from the field names and the split_words and envconfig tags.
+func options(c *Config) []option {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	opts := make([]option, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		env := strings.ToUpper(field.Tag.Get("envconfig"))
+		if env == "" {
+			name := field.Name
+			if field.Tag.Get("split_words") == "true" {
+				name = splitWords(name)
+			}
+			env = envPrefix + strings.ToUpper(name)
+		}
+		key := strings.ToLower(strings.TrimPrefix(env, envPrefix))
+
+		opts = append(opts, option{
+			field: field,
+			value: v.Field(i),
+			env:   env,
+			key:   key,
+			flag:  strings.ReplaceAll(key, "_", "-"),
+		})
+	}
+	return opts
+}
+
+// splitWords splits a camel case name into words joined with underscores, e.g. LinkAccessTTL into Link_Access_TTL.
+func splitWords(name string) string {
+	var words []string
+	for _, match := range wordsRegexp.FindAllString(name, -1) {
+		if m := acronymRegexp.FindStringSubmatch(match); len(m) == 3 {
+			words = append(words, m[1], m[2])
+		} else {
+			words = append(words, match)
+		}
+	}
+	return strings.Join(words, "_")
+}
+
+// Load loads the config from, in increasing order of precedence, the defaults, the YAML config file,
+// the environment variables and the command-line flags in args, which do not include the name of the program.
+//
+// The path to the config file is taken from the --config flag or the SHORTENER_CONFIG_FILE environment variable.
+// It returns all the problems with the config, if there are any.
+func Load(args []string) (*Config, *Flags, error) {
+	var (
+		flags  Flags
+		fs     = flag.NewFlagSet("shortener", flag.ContinueOnError)
+		values = make(map[string]string)
+	)
+	fs.StringVar(&flags.ConfigFile, "config", os.Getenv(configFileEnv), "path to the YAML config file")
+	fs.BoolVar(&flags.PrintConfig, "print-config", false, "print the config, with the secrets redacted, and exit")
+	for _, opt := range options(&Config{}) {
+		fs.Var(&flagValue{values: values, key: opt.key, isBool: opt.value.Kind() == reflect.Bool}, opt.flag, usage(opt))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	var file map[string]yaml.Node
+	if flags.ConfigFile != "" {
+		f, err := os.Open(flags.ConfigFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error while opening config file: %w", err)
+		}
+		defer f.Close()
+
+		file, err = readFile(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error while reading config file %s: %w", flags.ConfigFile, err)
+		}
+	}
+
+	config, err := load(file, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, &flags, nil
+}
+
+// load creates a new config from the given values of the config file and the flags, by key,
+// and the environment variables, and validates it.
+//
+// The options are set with reflection, rather than with envconfig, because envconfig reads only the environment
+// and splits the pairs of the maps at the first colon, so it cannot set keys such as "POST /api/v1/links:batch".
+// The maps and the lists of the config file are set from their YAML nodes, so their keys and items can contain
+// any character, while in the environment variables and the flags the pairs of the maps are split at the last colon.
+func load(file map[string]yaml.Node, flags map[string]string) (*Config, error) {
+	var (
+		config Config
+		errs   []error
+		known  = make(map[string]bool)
+	)
+	for _, opt := range options(&config) {
+		known[opt.key] = true
+
+		var (
+			value, source string
+			node          yaml.Node
+			ok            bool
+		)
+		if value, ok = flags[opt.key]; ok {
+			source = "flag --" + opt.flag
+		} else if value, ok = os.LookupEnv(opt.env); ok {
+			source = "environment variable " + opt.env
+		} else if node, ok = file[opt.key]; ok {
+			if err := setNode(opt.value, &node); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %s of key %s of the config file: %w", describeNode(&node), opt.key, err))
+			}
+			continue
+		} else if value, ok = opt.field.Tag.Lookup("default"); ok {
+			source = "default of " + opt.key
+		} else {
+			if opt.field.Tag.Get("required") == "true" {
+				errs = append(errs, fmt.Errorf("%s is required, set it with %s, --%s or the %s key of the config file", opt.key, opt.env, opt.flag, opt.key))
+			}
+			continue
+		}
+
+		if err := setValue(opt.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q of %s: %w", value, source, err))
+		}
+	}
+
+	unknown := make([]string, 0)
+	for key := range file {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("unknown key %s in the config file", key))
+	}
+
+	if len(errs) == 0 {
+		if err := config.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return &config, nil
+}
+
+// usage returns the description of the flag of the given option.
+func usage(opt option) string {
+	usage := "overrides " + opt.env
+	if def, ok := opt.field.Tag.Lookup("default"); ok {
+		usage += fmt.Sprintf(" (default %q)", def)
+	}
+	return usage
+}
+
+// flagValue stores the value of a command-line flag by the key of its option, so that the flags that are set
+// can be told apart from the ones that are not.
+type flagValue struct {
+	values map[string]string
+	key    string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.key]
+}
+
+func (f *flagValue) Set(value string) error {
+	f.values[f.key] = value
+	return nil
+}
+
+// IsBoolFlag allows the boolean flags to be set without a value, e.g. --use-in-memory-db.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// readFile reads the values of a YAML config file, by key.
+func readFile(r io.Reader) (map[string]yaml.Node, error) {
+	var doc map[string]yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return map[string]yaml.Node{}, nil
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// describeNode returns the value of a scalar node, quoted, or the line of the other nodes, for the errors.
+func describeNode(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return strconv.Quote(node.Value)
+	}
+	return fmt.Sprintf("at line %d", node.Line)
+}
+
+// setNode sets the value of a node of the config file to v.
+//
+// The items of the lists and the pairs of the maps are set from their own nodes, while the scalars are parsed
+// in the same way as the environment variables, e.g. a map can be set to "key1:value1,key2:value2" as well.
+func setNode(v reflect.Value, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return setValue(v, node.Value)
+	case yaml.AliasNode:
+		return setNode(v, node.Alias)
+	case yaml.SequenceNode:
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("a list cannot be set to %s", v.Type())
+		}
+		slice := reflect.MakeSlice(v.Type(), len(node.Content), len(node.Content))
+		for i, item := range node.Content {
+			if err := setNode(slice.Index(i), item); err != nil {
+				return fmt.Errorf("invalid item %s: %w", describeNode(item), err)
+			}
+		}
+		v.Set(slice)
+	case yaml.MappingNode:
+		if v.Kind() != reflect.Map {
+			return fmt.Errorf("a map cannot be set to %s", v.Type())
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setNode(key, node.Content[i]); err != nil {
+				return fmt.Errorf("invalid key %s: %w", describeNode(node.Content[i]), err)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setNode(elem, node.Content[i+1]); err != nil {
+				return fmt.Errorf("invalid value %s of %s: %w", describeNode(node.Content[i+1]), describeNode(node.Content[i]), err)
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported value")
+	}
+	return nil
+}
+
+// setValue parses the value and sets it to v.
+//
+// The items of the lists are separated with commas and the pairs of the maps are separated with commas as well,
+// e.g. "key1:value1,key2:value2", where the key is separated from the value with the last colon,
+// so that the keys can contain colons, e.g. "POST /api/v1/links:batch:10/1m".
+func setValue(v reflect.Value, value string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if strings.TrimSpace(value) == "" {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			return nil
+		}
+		items := strings.Split(value, ",")
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		if strings.TrimSpace(value) != "" {
+			for _, pair := range strings.Split(value, ",") {
+				i := strings.LastIndex(pair, ":")
+				if i < 0 {
+					return fmt.Errorf("%q is not a key:value pair", pair)
+				}
+				k, val := pair[:i], pair[i+1:]
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := setValue(key, strings.TrimSpace(k)); err != nil {
+					return err
+				}
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := setValue(elem, strings.TrimSpace(val)); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, elem)
+			}
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
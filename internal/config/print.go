@@ -0,0 +1,46 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the values of the secret options when the config is printed.
+const redacted = "[REDACTED]"
+
+// Print writes the config to w as a YAML config file, with the values of the secret options redacted.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, opt := range options(c) {
+		var value any = opt.value.Interface()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case encoding.TextMarshaler:
+			text, err := v.MarshalText()
+			if err != nil {
+				return fmt.Errorf("error while encoding %s: %w", opt.key, err)
+			}
+			value = string(text)
+		}
+		if opt.field.Tag.Get("secret") == "true" {
+			value = redacted
+		}
+
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return fmt.Errorf("error while encoding %s: %w", opt.key, err)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: opt.key}, &node)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/exp/slog"
+)
+
+// ErrReloadNotSupported is returned when the config is reloaded, but it is not known how to load it.
+var ErrReloadNotSupported = errors.New("the config cannot be reloaded")
+
+// ReloadStatus describes the active config and the last attempt to reload it.
+type ReloadStatus struct {
+	// Version is incremented each time a reload changes the active config. The initial config has version 1.
+	Version int `json:"version"`
+	// Checksum is the SHA-256 checksum of the active config, with the secrets redacted.
+	Checksum string `json:"checksum"`
+	// ActivatedAt is the time the active config was activated.
+	ActivatedAt time.Time `json:"activated_at"`
+	// LastReloadAt is the time of the last attempt to reload the config, if there was one.
+	LastReloadAt *time.Time `json:"last_reload_at,omitempty"`
+	// LastReloadError is the reason the last attempt to reload the config failed, if it did.
+	LastReloadError string `json:"last_reload_error,omitempty"`
+	// RestartRequired are the options that have changed, but cannot be reloaded, so they take effect after a restart.
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// Reloader holds the active config and replaces its reloadable options with the ones of a newly loaded config,
+// e.g. when the config file changes.
+//
+// The active config is never modified, it is replaced as a whole, so it can be read without locking.
+type Reloader struct {
+	load   func() (*Config, error)
+	active atomic.Pointer[Config]
+
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	status   ReloadStatus
+	onReload []func(*Config)
+}
+
+// NewReloader creates a new Reloader with the given active config.
+//
+// It cannot reload the config until SetLoader is called.
+func NewReloader(initial *Config) *Reloader {
+	r := &Reloader{
+		logger: slog.Default(),
+		status: ReloadStatus{
+			Version:     1,
+			Checksum:    checksum(initial),
+			ActivatedAt: time.Now(),
+		},
+	}
+	r.active.Store(initial)
+	return r
+}
+
+// SetLoader sets the function that loads the new config on each reload.
+func (r *Reloader) SetLoader(load func() (*Config, error)) *Reloader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.load = load
+	return r
+}
+
+// SetLogger sets the logger of the Reloader.
+func (r *Reloader) SetLogger(l *slog.Logger) *Reloader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logger = l
+	return r
+}
+
+// Active returns the active config. It must not be modified.
+func (r *Reloader) Active() *Config {
+	return r.active.Load()
+}
+
+// OnReload registers a function that is called with the new active config each time a reload changes it.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onReload = append(r.onReload, fn)
+}
+
+// Status returns the status of the active config and of the last reload.
+func (r *Reloader) Status() ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := r.status
+	status.RestartRequired = append([]string(nil), r.status.RestartRequired...)
+	return status
+}
+
+// Reload loads the config and activates the new values of its reloadable options.
+//
+// If the loaded config is not valid, the active config is kept and the error is returned.
+// The changes of the other options are reported in the status, but they take effect only after a restart.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.status.LastReloadAt = &now
+	if r.load == nil {
+		r.status.LastReloadError = ErrReloadNotSupported.Error()
+		return ErrReloadNotSupported
+	}
+
+	loaded, err := r.load()
+	if err != nil {
+		r.status.LastReloadError = err.Error()
+		return err
+	}
+	r.status.LastReloadError = ""
+
+	var (
+		next        = *r.active.Load()
+		loadedValue = reflect.ValueOf(loaded).Elem()
+		restart     []string
+		changed     bool
+	)
+	for _, opt := range options(&next) {
+		value := loadedValue.FieldByIndex(opt.field.Index)
+		if reflect.DeepEqual(opt.value.Interface(), value.Interface()) {
+			continue
+		}
+		if opt.field.Tag.Get("reloadable") != "true" {
+			restart = append(restart, opt.key)
+			continue
+		}
+		opt.value.Set(value)
+		changed = true
+	}
+
+	r.status.RestartRequired = restart
+	if len(restart) > 0 {
+		r.logger.Warn("config options have changed, but take effect only after a restart", "options", restart)
+	}
+	if !changed {
+		return nil
+	}
+
+	r.active.Store(&next)
+	r.status.Version++
+	r.status.Checksum = checksum(&next)
+	r.status.ActivatedAt = now
+	for _, fn := range r.onReload {
+		fn(&next)
+	}
+	r.logger.Info("config reloaded", "version", r.status.Version, "checksum", r.status.Checksum)
+	return nil
+}
+
+// Watch reloads the config each time the given file changes or the process receives SIGHUP, until ctx is done.
+//
+// If file is empty, the config is reloaded only on SIGHUP.
+func (r *Reloader) Watch(ctx context.Context, file string) error {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if file != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+
+		// The directory is watched, rather than the file, because the file is often replaced instead of written to,
+		// e.g. by editors or by Kubernetes, which swaps a symlink when a mounted ConfigMap changes.
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return err
+		}
+		events, errs = watcher.Events, watcher.Errors
+	}
+	target := resolve(file)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			r.reload("signal")
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			resolved := resolve(file)
+			if filepath.Clean(event.Name) != filepath.Clean(file) && resolved == target {
+				continue
+			}
+			target = resolved
+			if _, err := os.Stat(file); err != nil {
+				// The file is being replaced, it is reloaded once it is created again.
+				continue
+			}
+			r.reload("file")
+		case err, ok := <-errs:
+			if !ok {
+				return nil
+			}
+			r.logger.Warn("error while watching config file", "file", file, "error", err)
+		}
+	}
+}
+
+// reload reloads the config and logs the error, if there is one.
+func (r *Reloader) reload(trigger string) {
+	if err := r.Reload(); err != nil {
+		r.logger.Error("error while reloading config, the active config is kept", "trigger", trigger, "error", err)
+	}
+}
+
+// resolve returns the path the given file points to, if it is a symlink, or the file itself.
+func resolve(file string) string {
+	if file == "" {
+		return ""
+	}
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return file
+	}
+	return resolved
+}
+
+// checksum returns the SHA-256 checksum of the config, with the secrets redacted.
+func checksum(c *Config) string {
+	var b bytes.Buffer
+	if err := c.Print(&b); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b.Bytes())
+	return hex.EncodeToString(sum[:])
+}
@@ -3,7 +3,10 @@ package dynamo
 import (
 	"context"
 	"errors"
-	"strconv"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/asankov/shortener/internal/links"
 	"github.com/asankov/shortener/internal/random"
@@ -16,53 +19,131 @@ import (
 )
 
 var (
-	tableName = aws.String("links")
+	// destinationKeyIndexName is the global secondary index of the links table with destination_key as its partition key.
+	destinationKeyIndexName = aws.String("destination_key-index")
+
+	// linkSettingsFields are the fields of a link that can be changed by Update.
+	linkSettingsFields = []string{
+		urlField,
+		redirectTypeField,
+		passthroughField,
+		utmField,
+		tagsField,
+		targetingField,
+		destinationsField,
+		passwordHashField,
+		maxClicksField,
+		deleteWhenExhaustedField,
+		scheduleField,
+		interstitialField,
+		// The destination key is not a setting, but it changes together with the URL.
+		destinationKeyField,
+	}
 )
 
 const (
-	idField      = "id"
-	urlField     = "url"
-	metricsField = "metrics"
-	clicksField  = "clicks"
-
-	region = "eu-west-1"
+	idField                  = "id"
+	urlField                 = "url"
+	redirectTypeField        = "redirect_type"
+	passthroughField         = "passthrough"
+	utmField                 = "utm"
+	tagsField                = "tags"
+	targetingField           = "targeting"
+	destinationsField        = "destinations"
+	passwordHashField        = "password_hash"
+	maxClicksField           = "max_clicks"
+	deleteWhenExhaustedField = "delete_when_exhausted"
+	scheduleField            = "schedule"
+	interstitialField        = "interstitial"
+	destinationKeyField      = "destination_key"
+	metricsField             = "metrics"
+	clicksField              = "clicks"
+	variantsField            = "variants"
+	qrScansField             = "qr_scans"
+	healthField              = "health"
 
 	maxAllowedConflicts = 50
+
+	// batchWriteLimit is the maximum number of items in a single BatchWriteItem request.
+	batchWriteLimit = 25
+	// transactWriteLimit is the maximum number of items in a single TransactWriteItems request.
+	transactWriteLimit = 100
+	// maxBatchAttempts is how many times the unprocessed items of a batch request are retried.
+	maxBatchAttempts = 5
+	// batchRetryDelay is the delay before the first retry of the unprocessed items. It doubles with each retry.
+	batchRetryDelay = 50 * time.Millisecond
 )
 
+// errUnprocessed is returned for the items DynamoDB did not process after all retries of a batch request.
+var errUnprocessed = errors.New("item was not processed by DynamoDB")
+
+// sleep waits for the given duration, unless the context is done before that.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Options configures the Database.
+type Options struct {
+	// Region is the AWS region of the tables.
+	Region string
+	// LinksTable is the name of the table of the links.
+	LinksTable string
+	// UsersTable is the name of the table of the users.
+	UsersTable string
+	// IdempotencyTable is the name of the table of the idempotency keys.
+	// It should have TTL enabled on the expires_at attribute, so that expired keys are eventually deleted.
+	IdempotencyTable string
+}
+
 // Database represents a DynamoDB database.
 type Database struct {
 	client *dynamodb.Client
 	random *random.Random
 
+	linksTable       *string
+	usersTable       *string
+	idempotencyTable *string
+
+	onIDConflict func()
+
 	logger *slog.Logger
 }
 
-func buildDynamoDBClient() (*dynamodb.Client, error) {
+func buildDynamoDBClient(region string) (*dynamodb.Client, error) {
 	awsConfig, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
 	dynamodbClient := dynamodb.NewFromConfig(awsConfig, func(opt *dynamodb.Options) {
-		// opt.Region = awsConfig.Region
 		opt.Region = region
 	})
 
 	return dynamodbClient, nil
 }
 
-// New creates a new database will config loaded from the environment.
+// New creates a new database with the given options and the AWS credentials loaded from the environment.
 //
 // It returns an error if not possible to do so.
-func New() (*Database, error) {
-	client, err := buildDynamoDBClient()
+func New(options Options) (*Database, error) {
+	client, err := buildDynamoDBClient(options.Region)
 	if err != nil {
 		return nil, err
 	}
 	return &Database{
-		client: client,
-		random: random.New(),
+		client:           client,
+		random:           random.New(),
+		linksTable:       aws.String(options.LinksTable),
+		usersTable:       aws.String(options.UsersTable),
+		idempotencyTable: aws.String(options.IdempotencyTable),
 	}, nil
 }
 
@@ -72,9 +153,9 @@ func (d *Database) SetLogger(l *slog.Logger) {
 }
 
 // GetByID looks up a link by ID and returns it.
-func (d *Database) GetByID(id string) (*links.Link, error) {
-	out, err := d.client.GetItem(context.Background(), &dynamodb.GetItemInput{
-		TableName: tableName,
+func (d *Database) GetByID(ctx context.Context, id string) (*links.Link, error) {
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: d.linksTable,
 		Key: map[string]types.AttributeValue{
 			idField: &types.AttributeValueMemberS{Value: id},
 		},
@@ -86,106 +167,478 @@ func (d *Database) GetByID(id string) (*links.Link, error) {
 		return nil, links.ErrLinkNotFound
 	}
 
-	return &links.Link{
-		ID:  out.Item[idField].(*types.AttributeValueMemberS).Value,
-		URL: out.Item[urlField].(*types.AttributeValueMemberS).Value,
-	}, nil
+	var link links.Link
+	if err := attributevalue.UnmarshalMap(out.Item, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
 }
 
 // GetAll returns all links.
-func (d *Database) GetAll() ([]*links.Link, error) {
-	scanOutput, err := d.client.Scan(context.Background(), &dynamodb.ScanInput{
-		TableName: tableName,
+func (d *Database) GetAll(ctx context.Context) ([]*links.Link, error) {
+	result := make([]*links.Link, 0)
+
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName: d.linksTable,
+	})
+	for paginator.HasMorePages() {
+		scanOutput, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		page := make([]*links.Link, 0, len(scanOutput.Items))
+		if err := attributevalue.UnmarshalListOfMaps(scanOutput.Items, &page); err != nil {
+			return nil, err
+		}
+		result = append(result, page...)
+	}
+	return result, nil
+}
+
+// ForEach calls fn for each link, until it returns an error.
+//
+// The links are read page by page, so that not all of them are kept in memory.
+func (d *Database) ForEach(ctx context.Context, fn func(link *links.Link) error) error {
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName: d.linksTable,
 	})
+	for paginator.HasMorePages() {
+		scanOutput, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		page := make([]*links.Link, 0, len(scanOutput.Items))
+		if err := attributevalue.UnmarshalListOfMaps(scanOutput.Items, &page); err != nil {
+			return err
+		}
+		for _, link := range page {
+			if err := fn(link); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Create creates a new link.
+//
+// The metrics of the link are reset and it returns links.ErrLinkAlreadyExists if a link with the same ID exists.
+func (d *Database) Create(ctx context.Context, link *links.Link) error {
+	created := *link
+	created.Metrics = links.NewMetrics()
+	created.Health = nil
+
+	item, err := marshalLink(&created)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if len(scanOutput.LastEvaluatedKey) > 0 {
-		// TODO: implement pagination
-		d.logger.Warn("there are more results")
+
+	if _, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           d.linksTable,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}); err != nil {
+		var ccfe *types.ConditionalCheckFailedException
+		if errors.As(err, &ccfe) {
+			return links.ErrLinkAlreadyExists
+		}
+		return err
 	}
-	result := make([]*links.Link, 0, len(scanOutput.Items))
-	for _, item := range scanOutput.Items {
-		result = append(result, &links.Link{
-			ID:  item[idField].(*types.AttributeValueMemberS).Value,
-			URL: item[urlField].(*types.AttributeValueMemberS).Value,
-		})
+
+	return nil
+}
+
+// CreateBatch creates the given links with BatchWriteItem and returns an error for each of them,
+// which is nil if the link was created.
+//
+// BatchWriteItem does not support conditions, so the links that already exist are looked up beforehand
+// and reported with links.ErrLinkAlreadyExists. A link with the same ID that is created concurrently can be overwritten.
+func (d *Database) CreateBatch(ctx context.Context, batch []*links.Link) []error {
+	errs := make([]error, len(batch))
+	for start := 0; start < len(batch); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(batch) {
+			end = len(batch)
+		}
+		d.createBatch(ctx, batch[start:end], errs[start:end])
 	}
-	return result, nil
+	return errs
 }
 
-// Create creates a new link with the provided ID and URL.
-func (d *Database) Create(id string, url string) error {
-	return d.saveLink(id, url, &links.Metrics{Clicks: 0}, &saveOptions{conditionalExpression: aws.String("attribute_not_exists(id)")})
+// createBatch creates up to batchWriteLimit links and sets the error for each of them in errs.
+func (d *Database) createBatch(ctx context.Context, batch []*links.Link, errs []error) {
+	ids := make([]string, 0, len(batch))
+	for _, link := range batch {
+		ids = append(ids, link.ID)
+	}
+	existing, err := d.existingIDs(ctx, ids)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return
+	}
+
+	var (
+		requests = make([]types.WriteRequest, 0, len(batch))
+		indexOf  = make(map[string]int, len(batch))
+	)
+	for i, link := range batch {
+		if existing[link.ID] {
+			errs[i] = links.ErrLinkAlreadyExists
+			continue
+		}
+
+		created := *link
+		created.Metrics = links.NewMetrics()
+		created.Health = nil
+
+		item, err := marshalLink(&created)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		indexOf[link.ID] = i
+	}
+
+	// DynamoDB can process only some of the items, e.g. when the table is throttled,
+	// so the rest are retried with an exponential backoff.
+	delay := batchRetryDelay
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt == maxBatchAttempts {
+			err = errUnprocessed
+			break
+		}
+		if attempt > 0 {
+			if err = sleep(ctx, delay); err != nil {
+				break
+			}
+			delay *= 2
+		}
+
+		var out *dynamodb.BatchWriteItemOutput
+		out, err = d.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				*d.linksTable: requests,
+			},
+		})
+		if err != nil {
+			break
+		}
+		requests = out.UnprocessedItems[*d.linksTable]
+	}
+
+	// The requests that are left were not written because of err.
+	for _, request := range requests {
+		var id string
+		if unmarshalErr := attributevalue.Unmarshal(request.PutRequest.Item[idField], &id); unmarshalErr == nil {
+			errs[indexOf[id]] = err
+		}
+	}
 }
 
-// Delete deletes the link with the given ID.
-func (d *Database) Delete(id string) error {
-	idValue, err := attributevalue.Marshal(id)
+// CreateAll creates all given links or none of them, in a single transaction with TransactWriteItems.
+//
+// If any of the links already exists, it returns a *links.BatchError.
+func (d *Database) CreateAll(ctx context.Context, batch []*links.Link) error {
+	if len(batch) > transactWriteLimit {
+		return fmt.Errorf("cannot create more than %d links in a transaction", transactWriteLimit)
+	}
+
+	items := make([]types.TransactWriteItem, 0, len(batch))
+	for _, link := range batch {
+		created := *link
+		created.Metrics = links.NewMetrics()
+		created.Health = nil
+
+		item, err := marshalLink(&created)
+		if err != nil {
+			return err
+		}
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           d.linksTable,
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		})
+	}
+
+	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
 	if err != nil {
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) && len(tce.CancellationReasons) == len(batch) {
+			errs := make([]error, len(batch))
+			for i, reason := range tce.CancellationReasons {
+				switch code := aws.ToString(reason.Code); code {
+				case "None", "":
+					errs[i] = links.ErrBatchAborted
+				case "ConditionalCheckFailed":
+					errs[i] = links.ErrLinkAlreadyExists
+				default:
+					errs[i] = fmt.Errorf("%s: %s", code, aws.ToString(reason.Message))
+				}
+			}
+			return &links.BatchError{Errs: errs}
+		}
 		return err
 	}
-	_, err = d.client.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
-		TableName: tableName,
-		Key: map[string]types.AttributeValue{
-			idField: idValue,
-		},
-	})
-	return err
+
+	return nil
+}
+
+// existingIDs returns which of the given IDs are already in use.
+func (d *Database) existingIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, map[string]types.AttributeValue{
+			idField: &types.AttributeValueMemberS{Value: id},
+		})
+	}
+
+	existing := make(map[string]bool)
+	delay := batchRetryDelay
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt == maxBatchAttempts {
+			return nil, errUnprocessed
+		}
+		if attempt > 0 {
+			if err := sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			delay *= 2
+		}
+
+		out, err := d.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				*d.linksTable: {
+					Keys:                     keys,
+					ProjectionExpression:     aws.String("#id"),
+					ExpressionAttributeNames: map[string]string{"#id": idField},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range out.Responses[*d.linksTable] {
+			var id string
+			if err := attributevalue.Unmarshal(item[idField], &id); err != nil {
+				return nil, err
+			}
+			existing[id] = true
+		}
+		keys = out.UnprocessedKeys[*d.linksTable].Keys
+	}
+	return existing, nil
 }
 
-// IncrementClicks increments the clicks for the link with the given ID.
-func (d *Database) IncrementClicks(id string) error {
-	link, err := d.GetByID(id)
+// Update updates the properties of an existing link.
+//
+// The metrics and the health of the link are not changed.
+func (d *Database) Update(ctx context.Context, link *links.Link) error {
+	item, err := marshalLink(link)
 	if err != nil {
 		return err
 	}
 
-	return d.saveLink(link.ID, link.URL, &links.Metrics{Clicks: link.Metrics.Clicks + 1}, nil)
+	var (
+		set    []string
+		remove []string
+		names  = map[string]string{}
+		values = map[string]types.AttributeValue{}
+	)
+	for _, field := range linkSettingsFields {
+		name := "#" + field
+		names[name] = field
+
+		value, ok := item[field]
+		if !ok {
+			remove = append(remove, name)
+			continue
+		}
+		values[":"+field] = value
+		set = append(set, fmt.Sprintf("%s = :%s", name, field))
+	}
+
+	// Links created before the variant metrics were introduced do not have them,
+	// so they are initialized here, as incrementing them requires them to exist.
+	names["#metrics"] = metricsField
+	names["#variants"] = variantsField
+	values[":noVariants"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	set = append(set, "#metrics.#variants = if_not_exists(#metrics.#variants, :noVariants)")
+
+	expression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expression += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	return d.updateLink(ctx, link.ID, expression, names, values)
 }
 
-type saveOptions struct {
-	conditionalExpression *string
+// GetByDestination returns the links of the given owner whose URLs lead to the same destination as the given URL,
+// starting from the oldest one.
+//
+// The links are looked up in a global secondary index, so links that were just created might not be returned.
+// Links created before the index was introduced are added to it when they are updated.
+func (d *Database) GetByDestination(ctx context.Context, owner, url string) ([]*links.Link, error) {
+	result := make([]*links.Link, 0)
+
+	paginator := dynamodb.NewQueryPaginator(d.client, &dynamodb.QueryInput{
+		TableName:              d.linksTable,
+		IndexName:              destinationKeyIndexName,
+		KeyConditionExpression: aws.String("#destinationKey = :destinationKey"),
+		ExpressionAttributeNames: map[string]string{
+			"#destinationKey": destinationKeyField,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":destinationKey": &types.AttributeValueMemberS{Value: links.DestinationKey(owner, url)},
+		},
+	})
+	for paginator.HasMorePages() {
+		queryOutput, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		page := make([]*links.Link, 0, len(queryOutput.Items))
+		if err := attributevalue.UnmarshalListOfMaps(queryOutput.Items, &page); err != nil {
+			return nil, err
+		}
+		result = append(result, page...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
 }
 
-func (d *Database) saveLink(id, url string, metrics *links.Metrics, opts *saveOptions) error {
-	if opts == nil {
-		opts = &saveOptions{}
+// marshalLink marshals the link to an item, together with its destination key, by which the links are indexed.
+func marshalLink(link *links.Link) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMap(link)
+	if err != nil {
+		return nil, err
 	}
+	item[destinationKeyField] = &types.AttributeValueMemberS{Value: link.DestinationKey()}
+	return item, nil
+}
 
+// Delete deletes the link with the given ID.
+func (d *Database) Delete(ctx context.Context, id string) error {
 	idValue, err := attributevalue.Marshal(id)
 	if err != nil {
 		return err
 	}
-	urlValue, err := attributevalue.Marshal(url)
-	if err != nil {
-		return err
+	_, err = d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: d.linksTable,
+		Key: map[string]types.AttributeValue{
+			idField: idValue,
+		},
+	})
+	return err
+}
+
+// IncrementClicks increments the clicks for the link with the given ID and returns the new number of clicks.
+//
+// The increment is done atomically by DynamoDB, so concurrent clicks are not lost,
+// and links.ErrClickLimitReached is returned if the link has already reached its maximum number of clicks.
+func (d *Database) IncrementClicks(ctx context.Context, id string, click links.Click) (int, error) {
+	expression := "ADD #metrics.#clicks :one"
+	names := map[string]string{
+		"#id":        idField,
+		"#metrics":   metricsField,
+		"#clicks":    clicksField,
+		"#maxClicks": maxClicksField,
+	}
+	if click.Variant != "" {
+		expression += ", #metrics.#variants.#variant :one"
+		names["#variants"] = variantsField
+		names["#variant"] = click.Variant
+	}
+	if click.QR {
+		expression += ", #metrics.#qrScans :one"
+		names["#qrScans"] = qrScansField
 	}
 
-	metricsValue := &types.AttributeValueMemberM{
-		Value: map[string]types.AttributeValue{
-			clicksField: &types.AttributeValueMemberN{Value: strconv.Itoa(metrics.Clicks)},
+	out, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: d.linksTable,
+		Key: map[string]types.AttributeValue{
+			idField: &types.AttributeValueMemberS{Value: id},
 		},
+		UpdateExpression: aws.String(expression),
+		// The limit is checked in the same request as the increment,
+		// so two concurrent visitors cannot both consume the last click.
+		ConditionExpression:       aws.String("attribute_exists(#id) AND (attribute_not_exists(#maxClicks) OR #metrics.#clicks < #maxClicks)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": &types.AttributeValueMemberN{Value: "1"}},
+		ReturnValues:              types.ReturnValueUpdatedNew,
+		// The old item is returned only if it exists,
+		// which tells apart a missing link from one that has reached its limit.
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var ccfe *types.ConditionalCheckFailedException
+		if errors.As(err, &ccfe) {
+			if len(ccfe.Item) > 0 {
+				return 0, links.ErrClickLimitReached
+			}
+			return 0, links.ErrLinkNotFound
+		}
+		return 0, err
 	}
 
-	putItemInput := &dynamodb.PutItemInput{
-		TableName: tableName,
-		Item: map[string]types.AttributeValue{
-			idField:      idValue,
-			urlField:     urlValue,
-			metricsField: metricsValue,
-		},
+	var updated links.Link
+	if err := attributevalue.UnmarshalMap(out.Attributes, &updated); err != nil {
+		return 0, err
 	}
-	if opts.conditionalExpression != nil {
-		putItemInput.ConditionExpression = opts.conditionalExpression
+	if updated.Metrics == nil {
+		return 0, nil
 	}
+	return updated.Metrics.Clicks, nil
+}
 
-	if _, err = d.client.PutItem(context.Background(), putItemInput); err != nil {
-		if opts.conditionalExpression != nil {
-			var ccfe *types.ConditionalCheckFailedException
-			if errors.As(err, &ccfe) {
-				return links.ErrLinkAlreadyExists
-			}
+// UpdateHealth stores the result of the last health check of the link with the given ID.
+func (d *Database) UpdateHealth(ctx context.Context, id string, health *links.Health) error {
+	healthValue, err := attributevalue.Marshal(health)
+	if err != nil {
+		return err
+	}
+
+	return d.updateLink(ctx, id, "SET #health = :health", map[string]string{
+		"#health": healthField,
+	}, map[string]types.AttributeValue{
+		":health": healthValue,
+	})
+}
+
+// updateLink applies the update expression to the link with the given ID.
+//
+// It returns links.ErrLinkNotFound if there is no such link.
+func (d *Database) updateLink(ctx context.Context, id, expression string, names map[string]string, values map[string]types.AttributeValue) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: d.linksTable,
+		Key: map[string]types.AttributeValue{
+			idField: &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String("attribute_exists(id)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var ccfe *types.ConditionalCheckFailedException
+		if errors.As(err, &ccfe) {
+			return links.ErrLinkNotFound
 		}
 		return err
 	}
@@ -194,7 +647,7 @@ func (d *Database) saveLink(id, url string, metrics *links.Metrics, opts *saveOp
 }
 
 // GenerateID generates a new ID and ensures that it is not already in use.
-func (d *Database) GenerateID() (string, error) {
+func (d *Database) GenerateID(ctx context.Context) (string, error) {
 	var (
 		conflictCount        int = 0
 		allowedConflictCount int = 4
@@ -213,12 +666,20 @@ func (d *Database) GenerateID() (string, error) {
 		id := d.random.ID(idLength)
 		// This is not optimal as DynamoDB reads are not free.
 		// Probably best to substitute it with some sort of cache at some point.
-		_, err := d.GetByID(id)
+		_, err := d.GetByID(ctx, id)
 
-		// An item with this ID is not found, so we can safely use it.
-		if err != nil && errors.Is(err, links.ErrLinkNotFound) {
+		// An item with this ID is not found, so we can safely use it, unless its path is served by the service itself.
+		if err != nil && errors.Is(err, links.ErrLinkNotFound) && !links.IsReservedID(id) {
 			return id, nil
 		}
 		conflictCount++
+		if d.onIDConflict != nil {
+			d.onIDConflict()
+		}
 	}
 }
+
+// OnIDConflict sets a function that is called for each generated ID that is already in use.
+func (d *Database) OnIDConflict(fn func()) {
+	d.onIDConflict = fn
+}
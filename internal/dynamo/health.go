@@ -0,0 +1,25 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CheckHealth returns an error if any of the tables used by the Database cannot be reached or is not active.
+func (d *Database) CheckHealth(ctx context.Context) error {
+	for _, table := range []*string{d.linksTable, d.usersTable, d.idempotencyTable} {
+		out, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: table})
+		if err != nil {
+			return fmt.Errorf("error while describing table %s: %w", aws.ToString(table), err)
+		}
+		// The table can still be read and written while it is being updated.
+		if status := out.Table.TableStatus; status != types.TableStatusActive && status != types.TableStatusUpdating {
+			return fmt.Errorf("table %s is %s", aws.ToString(table), status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/asankov/shortener/internal/idempotency"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	keyField       = "key"
+	expiresAtField = "expires_at"
+)
+
+// GetIdempotencyRecord returns the record of the given idempotency key.
+func (d *Database) GetIdempotencyRecord(ctx context.Context, key string) (*idempotency.Record, error) {
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: d.idempotencyTable,
+		Key: map[string]types.AttributeValue{
+			keyField: &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Item) == 0 {
+		return nil, idempotency.ErrNotFound
+	}
+
+	var record idempotency.Record
+	if err := attributevalue.UnmarshalMap(out.Item, &record); err != nil {
+		return nil, err
+	}
+	// Items with an expired TTL are not deleted immediately.
+	if record.IsExpired(time.Now()) {
+		return nil, idempotency.ErrNotFound
+	}
+	return &record, nil
+}
+
+// ReserveIdempotencyKey stores the record, unless there is a record with the same key that has not expired.
+func (d *Database) ReserveIdempotencyKey(ctx context.Context, record *idempotency.Record) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           d.idempotencyTable,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR #expiresAt <= :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#key":       keyField,
+			"#expiresAt": expiresAtField,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return idempotency.ErrKeyInUse
+		}
+		return err
+	}
+	return nil
+}
+
+// SaveIdempotencyRecord stores the record, replacing the record with the same key.
+func (d *Database) SaveIdempotencyRecord(ctx context.Context, record *idempotency.Record) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: d.idempotencyTable,
+		Item:      item,
+	})
+	return err
+}
+
+// DeleteIdempotencyRecord deletes the record of the given idempotency key.
+func (d *Database) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: d.idempotencyTable,
+		Key: map[string]types.AttributeValue{
+			keyField: &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	return err
+}
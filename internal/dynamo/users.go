@@ -11,10 +11,6 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var (
-	usersTableName = aws.String("users")
-)
-
 const (
 	emailField    = "email"
 	passwordField = "password"
@@ -22,7 +18,7 @@ const (
 )
 
 // CreateUser creates a new user with the given properties.
-func (d *Database) CreateUser(email, password string, roles []users.Role) error {
+func (d *Database) CreateUser(ctx context.Context, email, password string, roles []users.Role) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -40,8 +36,8 @@ func (d *Database) CreateUser(email, password string, roles []users.Role) error
 		return err
 	}
 
-	if _, err = d.client.PutItem(context.Background(), &dynamodb.PutItemInput{
-		TableName: usersTableName,
+	if _, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: d.usersTable,
 		Item: map[string]types.AttributeValue{
 			emailField:    emailValue,
 			passwordField: hashedPasswordValue,
@@ -56,9 +52,9 @@ func (d *Database) CreateUser(email, password string, roles []users.Role) error
 }
 
 // GetUser looks up a user by this email and password.
-func (d *Database) GetUser(email, password string) (*users.User, error) {
-	out, err := d.client.GetItem(context.Background(), &dynamodb.GetItemInput{
-		TableName: usersTableName,
+func (d *Database) GetUser(ctx context.Context, email, password string) (*users.User, error) {
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: d.usersTable,
 		Key: map[string]types.AttributeValue{
 			emailField: &types.AttributeValueMemberS{Value: email},
 		},
@@ -94,9 +90,9 @@ func (d *Database) GetUser(email, password string) (*users.User, error) {
 }
 
 // ShouldCreateInitialUser returns true if the users table is empty, e.g. there are no users in the database.
-func (d *Database) ShouldCreateInitialUser() (bool, error) {
-	scanOutput, err := d.client.Scan(context.Background(), &dynamodb.ScanInput{
-		TableName: usersTableName,
+func (d *Database) ShouldCreateInitialUser(ctx context.Context) (bool, error) {
+	scanOutput, err := d.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName: d.usersTable,
 		Limit:     aws.Int32(1),
 	})
 	if err != nil {
@@ -0,0 +1,103 @@
+package geoip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is an error that indicates that the country of an IP address is not known.
+var ErrNotFound = errors.New("country not found")
+
+// Locator looks up the country of IP addresses.
+type Locator interface {
+	// Country returns the ISO 3166-1 alpha-2 code of the country the IP address belongs to.
+	// It returns ErrNotFound if the country is not known.
+	Country(ip netip.Addr) (string, error)
+}
+
+// FileDB is a Locator backed by a local file.
+//
+// The file is in CSV format with one network per line, in CIDR notation, followed by its country code:
+//
+//	# comments and empty lines are ignored
+//	1.0.0.0/24,AU
+//	2001:200::/32,JP
+//
+// The networks must not overlap.
+type FileDB struct {
+	networks []network
+}
+
+type network struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// Open loads the database from the file with the given path.
+func Open(path string) (*FileDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Load loads the database from the given reader.
+func Load(r io.Reader) (*FileDB, error) {
+	db := &FileDB{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cidr, country, found := strings.Cut(line, ",")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected <network>,<country>", lineNumber)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) != 2 {
+			return nil, fmt.Errorf("line %d: invalid country code %q", lineNumber, country)
+		}
+
+		db.networks = append(db.networks, network{prefix: prefix.Masked(), country: country})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.networks, func(i, j int) bool {
+		return db.networks[i].prefix.Addr().Less(db.networks[j].prefix.Addr())
+	})
+
+	return db, nil
+}
+
+// Country returns the country of the network the IP address belongs to.
+func (db *FileDB) Country(ip netip.Addr) (string, error) {
+	ip = ip.Unmap()
+
+	// Find the last network that starts at or before the IP address.
+	i := sort.Search(len(db.networks), func(i int) bool {
+		return ip.Less(db.networks[i].prefix.Addr())
+	}) - 1
+	if i < 0 || !db.networks[i].prefix.Contains(ip) {
+		return "", ErrNotFound
+	}
+
+	return db.networks[i].country, nil
+}
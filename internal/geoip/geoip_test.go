@@ -0,0 +1,55 @@
+package geoip_test
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/asankov/shortener/internal/geoip"
+	"github.com/stretchr/testify/require"
+)
+
+const database = `
+# test database
+1.0.0.0/24,AU
+5.53.32.0/19,bg
+2001:200::/32,JP
+`
+
+func TestFileDB(t *testing.T) {
+	db, err := geoip.Load(strings.NewReader(database))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		ip      string
+		country string
+	}{
+		{ip: "1.0.0.1", country: "AU"},
+		{ip: "5.53.40.10", country: "BG"},
+		{ip: "::ffff:5.53.40.10", country: "BG"},
+		{ip: "2001:200::1", country: "JP"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.ip, func(t *testing.T) {
+			country, err := db.Country(netip.MustParseAddr(testCase.ip))
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.country, country)
+		})
+	}
+
+	t.Run("TestNotFound", func(t *testing.T) {
+		for _, ip := range []string{"0.0.0.1", "1.0.1.0", "8.8.8.8", "2001:201::1"} {
+			_, err := db.Country(netip.MustParseAddr(ip))
+			require.ErrorIs(t, err, geoip.ErrNotFound)
+		}
+	})
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		_, err := geoip.Load(strings.NewReader("1.0.0.0/24"))
+		require.Error(t, err)
+
+		_, err = geoip.Load(strings.NewReader("1.0.0.0/24,Australia"))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,39 @@
+// Package idempotency holds the responses of requests with idempotency keys,
+// so that retries of the same request get the same response instead of being processed again.
+package idempotency
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is an error that indicates that there is no record for the given key.
+	ErrNotFound = errors.New("idempotency key not found")
+	// ErrKeyInUse is an error that indicates that the key is already used by another request that has not expired.
+	ErrKeyInUse = errors.New("idempotency key is already in use")
+)
+
+// Record is the stored response of the first request with an idempotency key.
+type Record struct {
+	Key string `dynamodbav:"key"`
+	// RequestHash identifies the request the key was first used with.
+	RequestHash string `dynamodbav:"request_hash"`
+	// StatusCode is the status code of the response. It is zero while the request is still being processed.
+	StatusCode  int    `dynamodbav:"status_code"`
+	ContentType string `dynamodbav:"content_type,omitempty"`
+	Body        []byte `dynamodbav:"body,omitempty"`
+	// ExpiresAt is the time after which the key can be used for another request.
+	// It is stored as a Unix timestamp, so that it can be used as the TTL attribute of a DynamoDB table.
+	ExpiresAt time.Time `dynamodbav:"expires_at,unixtime"`
+}
+
+// IsCompleted returns true if the response of the request is stored.
+func (r *Record) IsCompleted() bool {
+	return r.StatusCode != 0
+}
+
+// IsExpired returns true if the key can be used for another request.
+func (r *Record) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
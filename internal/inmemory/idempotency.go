@@ -0,0 +1,80 @@
+package inmemory
+
+import (
+	"context"
+	"time"
+
+	"github.com/asankov/shortener/internal/idempotency"
+)
+
+// idempotencySweepInterval is how often the expired idempotency records are removed.
+const idempotencySweepInterval = time.Minute
+
+// GetIdempotencyRecord returns the record of the given idempotency key.
+func (d *DB) GetIdempotencyRecord(ctx context.Context, key string) (*idempotency.Record, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.sweepIdempotencyRecords(now)
+
+	record, found := d.idempotencyRecords[key]
+	if !found {
+		return nil, idempotency.ErrNotFound
+	}
+	if record.IsExpired(now) {
+		delete(d.idempotencyRecords, key)
+		return nil, idempotency.ErrNotFound
+	}
+	c := *record
+	return &c, nil
+}
+
+// ReserveIdempotencyKey stores the record, unless there is a record with the same key that has not expired.
+func (d *DB) ReserveIdempotencyKey(ctx context.Context, record *idempotency.Record) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.sweepIdempotencyRecords(now)
+
+	if existing, found := d.idempotencyRecords[record.Key]; found && !existing.IsExpired(now) {
+		return idempotency.ErrKeyInUse
+	}
+	c := *record
+	d.idempotencyRecords[record.Key] = &c
+	return nil
+}
+
+// SaveIdempotencyRecord stores the record, replacing the record with the same key.
+func (d *DB) SaveIdempotencyRecord(ctx context.Context, record *idempotency.Record) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := *record
+	d.idempotencyRecords[record.Key] = &c
+	return nil
+}
+
+// DeleteIdempotencyRecord deletes the record of the given idempotency key.
+func (d *DB) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.idempotencyRecords, key)
+	return nil
+}
+
+// sweepIdempotencyRecords removes the expired records, at most once per idempotencySweepInterval,
+// so that the keys that are not used again do not take memory. It must be called with the lock held.
+func (d *DB) sweepIdempotencyRecords(now time.Time) {
+	if now.Sub(d.idempotencySwept) < idempotencySweepInterval {
+		return
+	}
+	for key, record := range d.idempotencyRecords {
+		if record.IsExpired(now) {
+			delete(d.idempotencyRecords, key)
+		}
+	}
+	d.idempotencySwept = now
+}
@@ -1,8 +1,13 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/asankov/shortener/internal/idempotency"
 	"github.com/asankov/shortener/internal/links"
 	"github.com/asankov/shortener/internal/random"
 	"github.com/asankov/shortener/internal/users"
@@ -12,57 +17,234 @@ type DB struct {
 	links  map[string]*links.Link
 	users  map[string]*users.User
 	random *random.Random
+
+	// destinations indexes the IDs of the links by their destination key.
+	destinations map[string]map[string]bool
+
+	onIDConflict func()
+
+	idempotencyRecords map[string]*idempotency.Record
+	// idempotencySwept is the last time the expired idempotency records were removed.
+	idempotencySwept time.Time
+
+	mu sync.RWMutex
 }
 
 func NewDB() *DB {
 	return &DB{
-		links: make(map[string]*links.Link),
+		links:        make(map[string]*links.Link),
+		destinations: make(map[string]map[string]bool),
 		users: map[string]*users.User{
 			"admin@asankov.dev": {
 				Email: "admin@asankov.dev",
 				Roles: []users.Role{users.RoleAdmin},
 			},
 		},
-		random: random.New(),
+		random:             random.New(),
+		idempotencyRecords: make(map[string]*idempotency.Record),
+		idempotencySwept:   time.Now(),
 	}
 }
 
-func (d *DB) GetByID(id string) (*links.Link, error) {
+func (d *DB) GetByID(ctx context.Context, id string) (*links.Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	link, found := d.links[id]
 	if !found {
 		return nil, links.ErrLinkNotFound
 	}
-	return link, nil
+	return copyLink(link), nil
 }
 
-func (d *DB) GetAll() ([]*links.Link, error) {
+func (d *DB) GetAll(ctx context.Context) ([]*links.Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	all := make([]*links.Link, 0)
 	for _, link := range d.links {
-		all = append(all, link)
+		all = append(all, copyLink(link))
 	}
 	return all, nil
 }
 
-func (d *DB) Create(id string, url string) error {
-	d.links[id] = &links.Link{ID: id, URL: url, Metrics: &links.Metrics{Clicks: 0}}
+// ForEach calls fn for each link, until it returns an error.
+func (d *DB) ForEach(ctx context.Context, fn func(link *links.Link) error) error {
+	all, err := d.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, link := range all {
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (d *DB) Delete(id string) error {
-	delete(d.links, id)
+func (d *DB) Create(ctx context.Context, link *links.Link) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, found := d.links[link.ID]; found {
+		return links.ErrLinkAlreadyExists
+	}
+
+	created := copyLink(link)
+	created.Metrics = links.NewMetrics()
+	created.Health = nil
+	d.put(created)
+	return nil
+}
+
+// CreateBatch creates the given links and returns an error for each of them, which is nil if the link was created.
+func (d *DB) CreateBatch(ctx context.Context, batch []*links.Link) []error {
+	errs := make([]error, len(batch))
+	for i, link := range batch {
+		errs[i] = d.Create(ctx, link)
+	}
+	return errs
+}
+
+// CreateAll creates all given links or none of them.
+//
+// If any of the links already exists, it returns a *links.BatchError.
+func (d *DB) CreateAll(ctx context.Context, batch []*links.Link) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var (
+		errs   = make([]error, len(batch))
+		failed bool
+		seen   = make(map[string]bool, len(batch))
+	)
+	for i, link := range batch {
+		if _, found := d.links[link.ID]; found || seen[link.ID] {
+			errs[i] = links.ErrLinkAlreadyExists
+			failed = true
+			continue
+		}
+		seen[link.ID] = true
+		errs[i] = links.ErrBatchAborted
+	}
+	if failed {
+		return &links.BatchError{Errs: errs}
+	}
+
+	for _, link := range batch {
+		created := copyLink(link)
+		created.Metrics = links.NewMetrics()
+		created.Health = nil
+		d.put(created)
+	}
+	return nil
+}
+
+func (d *DB) Update(ctx context.Context, link *links.Link) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stored, found := d.links[link.ID]
+	if !found {
+		return links.ErrLinkNotFound
+	}
+
+	updated := copyLink(link)
+	updated.Metrics = stored.Metrics
+	updated.Health = stored.Health
+	d.put(updated)
 	return nil
 }
 
-func (d *DB) IncrementClicks(id string) error {
+func (d *DB) Delete(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.remove(id)
+	return nil
+}
+
+// GetByDestination returns the links of the given owner whose URLs lead to the same destination as the given URL,
+// starting from the oldest one.
+func (d *DB) GetByDestination(ctx context.Context, owner, url string) ([]*links.Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	ids := d.destinations[links.DestinationKey(owner, url)]
+	result := make([]*links.Link, 0, len(ids))
+	for id := range ids {
+		result = append(result, copyLink(d.links[id]))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// put stores the link and indexes it by its destination. It must be called with the lock held.
+func (d *DB) put(link *links.Link) {
+	d.remove(link.ID)
+	d.links[link.ID] = link
+
+	key := link.DestinationKey()
+	if d.destinations[key] == nil {
+		d.destinations[key] = make(map[string]bool)
+	}
+	d.destinations[key][link.ID] = true
+}
+
+// remove deletes the link and removes it from the index. It must be called with the lock held.
+func (d *DB) remove(id string) {
+	link, found := d.links[id]
+	if !found {
+		return
+	}
+	delete(d.links, id)
+
+	key := link.DestinationKey()
+	delete(d.destinations[key], id)
+	if len(d.destinations[key]) == 0 {
+		delete(d.destinations, key)
+	}
+}
+
+func (d *DB) IncrementClicks(ctx context.Context, id string, click links.Click) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	link, ok := d.links[id]
 	if !ok {
-		return links.ErrLinkNotFound
+		return 0, links.ErrLinkNotFound
+	}
+	if link.IsExhausted() {
+		return 0, links.ErrClickLimitReached
 	}
 	link.Metrics.Clicks++
+	if click.Variant != "" {
+		link.Metrics.Variants[click.Variant]++
+	}
+	if click.QR {
+		link.Metrics.QRScans++
+	}
+	return link.Metrics.Clicks, nil
+}
+
+func (d *DB) UpdateHealth(ctx context.Context, id string, health *links.Health) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	link, ok := d.links[id]
+	if !ok {
+		return links.ErrLinkNotFound
+	}
+	link.Health = health
 	return nil
 }
 
-func (d *DB) GenerateID() (string, error) {
+func (d *DB) GenerateID(ctx context.Context) (string, error) {
 	var (
 		conflictCount        int
 		allowedConflictCount int = 4
@@ -81,12 +263,54 @@ func (d *DB) GenerateID() (string, error) {
 		}
 
 		id := d.random.ID(idLength)
-		_, err := d.GetByID(id)
+		_, err := d.GetByID(ctx, id)
 
-		// An item with this ID is not found, so we can safely use it.
-		if err != nil && errors.Is(err, links.ErrLinkNotFound) {
+		// An item with this ID is not found, so we can safely use it, unless its path is served by the service itself.
+		if err != nil && errors.Is(err, links.ErrLinkNotFound) && !links.IsReservedID(id) {
 			return id, nil
 		}
 		conflictCount++
+		if d.onIDConflict != nil {
+			d.onIDConflict()
+		}
+	}
+}
+
+// OnIDConflict sets a function that is called for each generated ID that is already in use.
+func (d *DB) OnIDConflict(fn func()) {
+	d.onIDConflict = fn
+}
+
+// copyLink returns a copy of the link, so that callers cannot modify the stored one.
+func copyLink(link *links.Link) *links.Link {
+	c := *link
+	if link.Metrics != nil {
+		metrics := *link.Metrics
+		metrics.Variants = make(map[string]int, len(link.Metrics.Variants))
+		for variant, clicks := range link.Metrics.Variants {
+			metrics.Variants[variant] = clicks
+		}
+		c.Metrics = &metrics
+	}
+	if link.Passthrough != nil {
+		passthrough := *link.Passthrough
+		c.Passthrough = &passthrough
+	}
+	if link.UTM != nil {
+		utm := *link.UTM
+		c.UTM = &utm
+	}
+	if link.Schedule != nil {
+		schedule := *link.Schedule
+		if link.Schedule.Recurring != nil {
+			recurring := *link.Schedule.Recurring
+			recurring.Days = append([]time.Weekday(nil), link.Schedule.Recurring.Days...)
+			schedule.Recurring = &recurring
+		}
+		c.Schedule = &schedule
 	}
+	c.Tags = append([]string(nil), link.Tags...)
+	c.Targeting = append([]links.TargetingRule(nil), link.Targeting...)
+	c.Destinations = append([]links.Destination(nil), link.Destinations...)
+	return &c
 }
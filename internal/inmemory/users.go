@@ -1,8 +1,15 @@
 package inmemory
 
-import "github.com/asankov/shortener/internal/users"
+import (
+	"context"
+
+	"github.com/asankov/shortener/internal/users"
+)
+
+func (d *DB) GetUser(ctx context.Context, email, password string) (*users.User, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 
-func (d *DB) GetUser(email, password string) (*users.User, error) {
 	user, found := d.users[email]
 	if !found {
 		return nil, users.ErrUserNotFound
@@ -10,11 +17,14 @@ func (d *DB) GetUser(email, password string) (*users.User, error) {
 	return user, nil
 }
 
-func (d *DB) CreateUser(email, password string, roles []users.Role) error {
+func (d *DB) CreateUser(ctx context.Context, email, password string, roles []users.Role) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	d.users[email] = &users.User{Email: email, Roles: roles}
 	return nil
 }
 
-func (d *DB) ShouldCreateInitialUser() (bool, error) {
+func (d *DB) ShouldCreateInitialUser(ctx context.Context) (bool, error) {
 	return true, nil
 }
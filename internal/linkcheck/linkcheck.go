@@ -0,0 +1,297 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+	"golang.org/x/exp/slog"
+)
+
+const maxRedirects = 10
+
+var errTooManyRedirects = fmt.Errorf("stopped after %d redirects", maxRedirects)
+
+// Database is the storage the Checker reads the links from and stores the results to.
+type Database interface {
+	GetAll(ctx context.Context) ([]*links.Link, error)
+	UpdateHealth(ctx context.Context, id string, health *links.Health) error
+}
+
+// Options configures the Checker.
+type Options struct {
+	// Interval is the time between two consecutive checks of all links.
+	Interval time.Duration
+	// Concurrency is the maximum number of requests sent to the destinations at the same time.
+	Concurrency int
+	// HostDelay is the minimum time between two requests to the same host.
+	HostDelay time.Duration
+	// Timeout is the maximum time a single request can take, not counting the wait for its host.
+	Timeout time.Duration
+}
+
+// Checker periodically checks whether the destinations of the links are still reachable.
+type Checker struct {
+	db      Database
+	options Options
+
+	transport http.RoundTripper
+	// slots limits the number of the requests that are sent at the same time.
+	slots chan struct{}
+
+	hostsMu sync.Mutex
+	hosts   map[string]*host
+
+	logger *slog.Logger
+}
+
+// host keeps track of the time the last request to a given host was scheduled at.
+type host struct {
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+// New creates a new Checker from the given parameters.
+func New(db Database, options Options) *Checker {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	return &Checker{
+		db:        db,
+		options:   options,
+		transport: http.DefaultTransport,
+		slots:     make(chan struct{}, options.Concurrency),
+		hosts:     make(map[string]*host),
+		logger:    slog.Default(),
+	}
+}
+
+// SetLogger sets the logger used in the Checker.
+func (c *Checker) SetLogger(l *slog.Logger) *Checker {
+	c.logger = l
+	return c
+}
+
+// Run checks all links every Interval until the context is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.CheckAll(ctx); err != nil {
+			c.logger.Warn("error while checking links", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks the destinations of all links and stores the results.
+//
+// The links are grouped by the host of their destination and the links of each host are checked one after another,
+// so that they wait for each other because of HostDelay, rather than for the slots of the concurrent requests,
+// which are taken only while a request is sent.
+func (c *Checker) CheckAll(ctx context.Context) error {
+	all, err := c.db.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		hosts  []string
+		byHost = make(map[string][]*links.Link)
+	)
+	for _, link := range all {
+		var name string
+		if u, err := url.Parse(link.URL); err == nil {
+			name = u.Host
+		}
+		if _, ok := byHost[name]; !ok {
+			hosts = append(hosts, name)
+		}
+		byHost[name] = append(byHost[name], link)
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range hosts {
+		wg.Add(1)
+		go func(all []*links.Link) {
+			defer wg.Done()
+
+			for _, link := range all {
+				if ctx.Err() != nil {
+					return
+				}
+
+				health := c.Check(ctx, link.URL)
+				if err := c.db.UpdateHealth(ctx, link.ID, health); err != nil && !errors.Is(err, links.ErrLinkNotFound) {
+					c.logger.Warn("error while updating link health", "link_id", link.ID, "error", err)
+				}
+			}
+		}(byHost[name])
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// Check sends a request to the given URL, following its redirects, and reports its health.
+//
+// A HEAD request is tried first, and if the destination does not support it, a GET request is sent.
+func (c *Checker) Check(ctx context.Context, rawURL string) *links.Health {
+	health := c.check(ctx, http.MethodHead, rawURL)
+	if health.StatusCode == http.StatusMethodNotAllowed || health.StatusCode == http.StatusNotImplemented {
+		health = c.check(ctx, http.MethodGet, rawURL)
+	}
+	return health
+}
+
+// check sends a request with the given method to the given URL and to each of the URLs it redirects to.
+func (c *Checker) check(ctx context.Context, method, rawURL string) *links.Health {
+	health := &links.Health{}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		health.Error = err.Error()
+		health.CheckedAt = time.Now()
+		return health
+	}
+
+	for {
+		resp, latency, err := c.send(ctx, method, u)
+		health.Latency += latency
+		health.CheckedAt = time.Now()
+		if err != nil {
+			health.Error = err.Error()
+			return health
+		}
+
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			health.StatusCode = resp.StatusCode
+			return health
+		}
+		if len(health.RedirectChain) >= maxRedirects {
+			health.Error = fmt.Sprintf("%s %q: %s", method, u, errTooManyRedirects)
+			return health
+		}
+
+		next, err := u.Parse(location)
+		if err != nil {
+			health.Error = fmt.Sprintf("%s %q: invalid redirect location %q: %s", method, u, location, err)
+			return health
+		}
+		health.RedirectChain = append(health.RedirectChain, next.String())
+		u = next
+	}
+}
+
+// send sends a single request to the given URL, without following its redirects.
+//
+// It waits for its turn to send a request to the host before it takes a slot of the concurrent requests
+// and starts the timeout of the request, so that neither is spent on waiting.
+// The body of the response is closed, as only its status and headers are needed.
+func (c *Checker) send(ctx context.Context, method string, u *url.URL) (*http.Response, time.Duration, error) {
+	if err := c.wait(ctx, u); err != nil {
+		return nil, 0, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case c.slots <- struct{}{}:
+	}
+	defer func() {
+		<-c.slots
+	}()
+
+	if c.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	client := &http.Client{
+		Transport: c.transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return nil, latency, err
+	}
+	resp.Body.Close()
+
+	return resp, latency, nil
+}
+
+// isRedirect returns true if the given status code redirects to the URL in the Location header.
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// wait blocks until it is polite to send another request to the host of the given URL.
+//
+// The requests to the same host are scheduled HostDelay apart, in the order wait is called,
+// so that waiting does not hold the lock of the host and can be cancelled.
+func (c *Checker) wait(ctx context.Context, u *url.URL) error {
+	if c.options.HostDelay <= 0 {
+		return nil
+	}
+
+	h := c.host(u.Host)
+	h.mu.Lock()
+	at := time.Now()
+	if next := h.lastRequest.Add(c.options.HostDelay); next.After(at) {
+		at = next
+	}
+	h.lastRequest = at
+	h.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return nil
+}
+
+func (c *Checker) host(name string) *host {
+	c.hostsMu.Lock()
+	defer c.hostsMu.Unlock()
+
+	h, ok := c.hosts[name]
+	if !ok {
+		h = &host{}
+		c.hosts[name] = h
+	}
+	return h
+}
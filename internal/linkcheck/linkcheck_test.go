@@ -0,0 +1,158 @@
+package linkcheck_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/asankov/shortener/internal/inmemory"
+	"github.com/asankov/shortener/internal/linkcheck"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	checker := linkcheck.New(inmemory.NewDB(), linkcheck.Options{Timeout: time.Second})
+
+	t.Run("TestOK", func(t *testing.T) {
+		health := checker.Check(context.Background(), server.URL+"/ok")
+
+		require.Equal(t, http.StatusOK, health.StatusCode)
+		require.False(t, health.IsBroken())
+		require.Empty(t, health.RedirectChain)
+	})
+
+	t.Run("TestNotFound", func(t *testing.T) {
+		health := checker.Check(context.Background(), server.URL+"/gone")
+
+		require.Equal(t, http.StatusNotFound, health.StatusCode)
+		require.True(t, health.IsBroken())
+	})
+
+	t.Run("TestRedirectChain", func(t *testing.T) {
+		health := checker.Check(context.Background(), server.URL+"/moved")
+
+		require.Equal(t, http.StatusOK, health.StatusCode)
+		require.Equal(t, []string{server.URL + "/ok"}, health.RedirectChain)
+	})
+
+	t.Run("TestTooManyRedirects", func(t *testing.T) {
+		health := checker.Check(context.Background(), server.URL+"/loop")
+
+		require.Zero(t, health.StatusCode)
+		require.Contains(t, health.Error, "stopped after 10 redirects")
+		require.Len(t, health.RedirectChain, 10)
+	})
+
+	t.Run("TestFallbackToGET", func(t *testing.T) {
+		health := checker.Check(context.Background(), server.URL+"/no-head")
+
+		require.Equal(t, http.StatusOK, health.StatusCode)
+	})
+
+	t.Run("TestTimeoutAfterHostDelay", func(t *testing.T) {
+		// The second request waits longer than the timeout for the host, but the wait does not count towards it.
+		checker := linkcheck.New(inmemory.NewDB(), linkcheck.Options{HostDelay: 200 * time.Millisecond, Timeout: 100 * time.Millisecond})
+
+		require.Equal(t, http.StatusOK, checker.Check(context.Background(), server.URL+"/ok").StatusCode)
+		health := checker.Check(context.Background(), server.URL+"/moved")
+		require.Empty(t, health.Error)
+		require.Equal(t, http.StatusOK, health.StatusCode)
+	})
+
+	t.Run("TestUnreachable", func(t *testing.T) {
+		health := checker.Check(context.Background(), "http://127.0.0.1:1")
+
+		require.Zero(t, health.StatusCode)
+		require.NotEmpty(t, health.Error)
+		require.True(t, health.IsBroken())
+	})
+}
+
+func TestCheckAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	db := inmemory.NewDB()
+	require.NoError(t, db.Create(context.Background(), &links.Link{ID: "ok", URL: server.URL + "/ok"}))
+	require.NoError(t, db.Create(context.Background(), &links.Link{ID: "gone", URL: server.URL + "/gone"}))
+
+	checker := linkcheck.New(db, linkcheck.Options{Concurrency: 2, HostDelay: 10 * time.Millisecond})
+	require.NoError(t, checker.CheckAll(context.Background()))
+
+	ok, err := db.GetByID(context.Background(), "ok")
+	require.NoError(t, err)
+	require.NotNil(t, ok.Health)
+	require.False(t, ok.Health.IsBroken())
+
+	gone, err := db.GetByID(context.Background(), "gone")
+	require.NoError(t, err)
+	require.NotNil(t, gone.Health)
+	require.Equal(t, http.StatusGone, gone.Health.StatusCode)
+	require.True(t, gone.Health.IsBroken())
+}
+
+func TestCheckAllHostDelay(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	slow := httptest.NewServer(handler)
+	t.Cleanup(slow.Close)
+	other := httptest.NewServer(handler)
+	t.Cleanup(other.Close)
+
+	db := inmemory.NewDB()
+	require.NoError(t, db.Create(context.Background(), &links.Link{ID: "first", URL: slow.URL + "/first"}))
+	require.NoError(t, db.Create(context.Background(), &links.Link{ID: "second", URL: slow.URL + "/second"}))
+	require.NoError(t, db.Create(context.Background(), &links.Link{ID: "other", URL: other.URL}))
+
+	// The link of the other host does not wait for the slot that the second link of the first host would hold while waiting.
+	checker := linkcheck.New(db, linkcheck.Options{Concurrency: 1, HostDelay: 300 * time.Millisecond})
+	require.NoError(t, checker.CheckAll(context.Background()))
+
+	health := make(map[string]*links.Health)
+	for _, id := range []string{"first", "second", "other"} {
+		link, err := db.GetByID(context.Background(), id)
+		require.NoError(t, err)
+		require.NotNil(t, link.Health)
+		require.Equal(t, http.StatusOK, link.Health.StatusCode)
+		health[id] = link.Health
+	}
+	first, second := health["first"].CheckedAt, health["second"].CheckedAt
+	if second.Before(first) {
+		first, second = second, first
+	}
+	require.GreaterOrEqual(t, second.Sub(first), 250*time.Millisecond)
+	require.True(t, health["other"].CheckedAt.Before(second))
+}
@@ -0,0 +1,22 @@
+package links
+
+import (
+	"fmt"
+)
+
+// BatchError is returned when an all-or-nothing batch of links is not created.
+type BatchError struct {
+	// Errs holds the reason each link of the batch was not created, in the order of the batch.
+	// Links that did not fail themselves have ErrBatchAborted.
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	var failed int
+	for _, err := range e.Errs {
+		if err != ErrBatchAborted {
+			failed++
+		}
+	}
+	return fmt.Sprintf("batch of %d links was not created, because %d of them failed", len(e.Errs), failed)
+}
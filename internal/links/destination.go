@@ -0,0 +1,79 @@
+package links
+
+import "fmt"
+
+// Destination is one of the URLs the traffic of a link is split between.
+type Destination struct {
+	// ID identifies the destination in the metrics and in the cookies of the visitors.
+	ID  string `dynamodbav:"id"`
+	URL string `dynamodbav:"url"`
+	// Weight is the relative share of the traffic sent to this destination.
+	Weight int `dynamodbav:"weight"`
+}
+
+// Click holds the details of a single visit of a link.
+type Click struct {
+	// Variant is the ID of the destination the visitor was sent to,
+	// or empty if the link does not split its traffic.
+	Variant string
+	// QR is true if the visitor scanned a tracked QR code of the link.
+	QR bool
+}
+
+// ValidateDestinations returns an error if the destinations are not valid.
+func ValidateDestinations(destinations []Destination) error {
+	seen := make(map[string]bool, len(destinations))
+	for _, d := range destinations {
+		if d.ID == "" {
+			return fmt.Errorf("%w: id is required", ErrInvalidDestination)
+		}
+		if seen[d.ID] {
+			return fmt.Errorf("%w: duplicate id %q", ErrInvalidDestination, d.ID)
+		}
+		seen[d.ID] = true
+
+		if d.URL == "" {
+			return fmt.Errorf("%w: url is required", ErrInvalidDestination)
+		}
+		if err := ValidateURL(d.URL); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidDestination, err)
+		}
+		if d.Weight <= 0 {
+			return fmt.Errorf("%w: weight must be positive", ErrInvalidDestination)
+		}
+	}
+	return nil
+}
+
+// Destination returns the destination with the given ID or nil if the link has no such destination.
+func (l *Link) Destination(id string) *Destination {
+	for i := range l.Destinations {
+		if l.Destinations[i].ID == id {
+			return &l.Destinations[i]
+		}
+	}
+	return nil
+}
+
+// TotalWeight returns the sum of the weights of all destinations.
+func (l *Link) TotalWeight() int {
+	total := 0
+	for _, d := range l.Destinations {
+		total += d.Weight
+	}
+	return total
+}
+
+// DestinationAt returns the destination that n falls into, when the destinations
+// are laid out one after another, each taking as much space as its weight.
+//
+// n must be in [0, TotalWeight()).
+func (l *Link) DestinationAt(n int) *Destination {
+	for i := range l.Destinations {
+		if n < l.Destinations[i].Weight {
+			return &l.Destinations[i]
+		}
+		n -= l.Destinations[i].Weight
+	}
+	return nil
+}
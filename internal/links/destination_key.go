@@ -0,0 +1,66 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+)
+
+// defaultPorts are the ports that are omitted from normalized URLs.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL returns the form of the URL that is the same for the URLs that lead to the same destination,
+// e.g. both HTTPS://Asankov.dev:443/?b=2&a=1#top and https://asankov.dev/?a=1&b=2 result in https://asankov.dev/?a=1&b=2.
+//
+// The scheme and the host are lowercased, the default port and the fragment are removed,
+// an empty path becomes / and the query parameters are sorted.
+func NormalizeURL(rawURL string) (string, error) {
+	if err := ValidateURL(rawURL); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		// Hostname removes the brackets of IPv6 addresses.
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// DestinationKey returns the key that is the same for the links of the given owner
+// whose URLs lead to the same destination.
+//
+// URLs that cannot be normalized are used as they are.
+func DestinationKey(owner, rawURL string) string {
+	normalized, err := NormalizeURL(rawURL)
+	if err != nil {
+		normalized = rawURL
+	}
+	return owner + " " + normalized
+}
+
+// DestinationKey returns the key that is the same for the links of the same owner
+// whose URLs lead to the same destination.
+func (l *Link) DestinationKey() string {
+	return DestinationKey(l.Owner, l.URL)
+}
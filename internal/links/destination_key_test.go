@@ -0,0 +1,42 @@
+package links_test
+
+import (
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://asankov.dev", expected: "https://asankov.dev/"},
+		{url: "HTTPS://Asankov.DEV:443/?b=2&a=1#top", expected: "https://asankov.dev/?a=1&b=2"},
+		{url: "http://asankov.dev:80/blog", expected: "http://asankov.dev/blog"},
+		{url: "http://asankov.dev:8080/Blog/", expected: "http://asankov.dev:8080/Blog/"},
+		{url: "https://[::1]:443/", expected: "https://[::1]/"},
+		{url: "https://[::1]:8443/", expected: "https://[::1]:8443/"},
+		{url: "https://asankov.dev/?", expected: "https://asankov.dev/"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.url, func(t *testing.T) {
+			normalized, err := links.NormalizeURL(testCase.url)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, normalized)
+		})
+	}
+
+	_, err := links.NormalizeURL("asankov.dev")
+	require.ErrorIs(t, err, links.ErrInvalidURL)
+}
+
+func TestDestinationKey(t *testing.T) {
+	a := &links.Link{Owner: "a@asankov.dev", URL: "https://asankov.dev/?b=2&a=1"}
+	b := &links.Link{Owner: "a@asankov.dev", URL: "https://ASANKOV.dev/?a=1&b=2#top"}
+	c := &links.Link{Owner: "c@asankov.dev", URL: "https://asankov.dev/?a=1&b=2"}
+
+	require.Equal(t, a.DestinationKey(), b.DestinationKey())
+	require.NotEqual(t, a.DestinationKey(), c.DestinationKey())
+}
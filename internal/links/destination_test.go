@@ -0,0 +1,44 @@
+package links_test
+
+import (
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinations(t *testing.T) {
+	link := &links.Link{
+		Destinations: []links.Destination{
+			{ID: "a", URL: "https://asankov.dev/a", Weight: 3},
+			{ID: "b", URL: "https://asankov.dev/b", Weight: 1},
+		},
+	}
+
+	require.Equal(t, 4, link.TotalWeight())
+	require.Equal(t, "a", link.DestinationAt(0).ID)
+	require.Equal(t, "a", link.DestinationAt(2).ID)
+	require.Equal(t, "b", link.DestinationAt(3).ID)
+	require.Nil(t, link.DestinationAt(4))
+
+	require.Equal(t, "https://asankov.dev/b", link.Destination("b").URL)
+	require.Nil(t, link.Destination("c"))
+}
+
+func TestValidateDestinations(t *testing.T) {
+	require.NoError(t, links.ValidateDestinations([]links.Destination{
+		{ID: "a", URL: "https://asankov.dev/a", Weight: 1},
+		{ID: "b", URL: "https://asankov.dev/b", Weight: 1},
+	}))
+
+	for _, destinations := range [][]links.Destination{
+		{{URL: "https://asankov.dev/a", Weight: 1}},
+		{{ID: "a", Weight: 1}},
+		{{ID: "a", URL: "https://asankov.dev/a", Weight: 0}},
+		{{ID: "a", URL: "asankov.dev/a", Weight: 1}},
+		{{ID: "a", URL: "javascript:alert(1)", Weight: 1}},
+		{{ID: "a", URL: "https://asankov.dev/a", Weight: 1}, {ID: "a", URL: "https://asankov.dev/b", Weight: 1}},
+	} {
+		require.ErrorIs(t, links.ValidateDestinations(destinations), links.ErrInvalidDestination)
+	}
+}
@@ -9,4 +9,32 @@ var (
 	ErrIDNotGenerated = errors.New("cannot generate ID")
 	// ErrLinkAlreadyExists is an error that indicates that link with the given properties already exists.
 	ErrLinkAlreadyExists = errors.New("link already exists")
+	// ErrInvalidID is an error that indicates that the given link ID is not valid.
+	ErrInvalidID = errors.New("invalid link ID")
+	// ErrInvalidURL is an error that indicates that the given URL cannot be used as the destination of a link.
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrDeniedDestination is an error that indicates that the host of the given URL is not allowed as the destination of a link.
+	ErrDeniedDestination = errors.New("destination is denied")
+	// ErrBatchAborted is an error that indicates that a link was not created, because other links of the same batch failed.
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrInvalidRedirectType is an error that indicates that the given redirect type is not supported.
+	ErrInvalidRedirectType = errors.New("invalid redirect type")
+	// ErrInvalidQueryPrecedence is an error that indicates that the given query precedence is not supported.
+	ErrInvalidQueryPrecedence = errors.New("invalid query precedence")
+	// ErrPathNotAllowed is an error that indicates that a path was given for a link that does not allow path passthrough.
+	ErrPathNotAllowed = errors.New("path passthrough is not allowed for this link")
+	// ErrInvalidUTM is an error that indicates that the given UTM parameters are not valid.
+	ErrInvalidUTM = errors.New("invalid UTM parameters")
+	// ErrInvalidTag is an error that indicates that the given tag is not valid.
+	ErrInvalidTag = errors.New("tag cannot be empty")
+	// ErrInvalidTargetingRule is an error that indicates that the given targeting rule is not valid.
+	ErrInvalidTargetingRule = errors.New("invalid targeting rule")
+	// ErrInvalidDestination is an error that indicates that the given destination is not valid.
+	ErrInvalidDestination = errors.New("invalid destination")
+	// ErrInvalidClickLimit is an error that indicates that the given maximum number of clicks is not valid.
+	ErrInvalidClickLimit = errors.New("maximum number of clicks cannot be negative")
+	// ErrInvalidSchedule is an error that indicates that the given schedule is not valid.
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrClickLimitReached is an error that indicates that the link has reached its maximum number of clicks.
+	ErrClickLimitReached = errors.New("link has reached its maximum number of clicks")
 )
@@ -1,11 +1,217 @@
 package links
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// PreviewSuffix is appended to the ID of a link to get its preview page.
+const PreviewSuffix = "+"
+
+// reservedIDs are the IDs that cannot be used for links, because their paths are served by the service itself.
+var reservedIDs = map[string]bool{
+	"healthz": true,
+	"readyz":  true,
+	"version": true,
+}
+
+// IsReservedID returns whether the given ID cannot be used for a link, because its path is served by the service itself.
+func IsReservedID(id string) bool {
+	return reservedIDs[id]
+}
+
 type Link struct {
-	ID      string
-	URL     string
-	Metrics *Metrics
+	ID           string       `dynamodbav:"id"`
+	URL          string       `dynamodbav:"url"`
+	RedirectType RedirectType `dynamodbav:"redirect_type,omitempty"`
+	Passthrough  *Passthrough `dynamodbav:"passthrough,omitempty"`
+	UTM          *UTM         `dynamodbav:"utm,omitempty"`
+	Tags         []string     `dynamodbav:"tags,omitempty"`
+	// Targeting holds the rules that send visitors to different destinations, evaluated in order.
+	// URL is the fallback destination for visitors that match none of the rules.
+	Targeting []TargetingRule `dynamodbav:"targeting,omitempty"`
+	// Destinations holds the URLs the traffic of the link is split between by weight.
+	// If empty, all visitors are sent to URL.
+	Destinations []Destination `dynamodbav:"destinations,omitempty"`
+	// PasswordHash is the bcrypt hash of the password required to follow the link, if any.
+	PasswordHash []byte `dynamodbav:"password_hash,omitempty"`
+	// MaxClicks is the number of clicks after which the link stops working.
+	// Zero means that the link is not limited.
+	MaxClicks int `dynamodbav:"max_clicks,omitempty"`
+	// DeleteWhenExhausted controls whether the link is deleted once it reaches MaxClicks.
+	DeleteWhenExhausted bool `dynamodbav:"delete_when_exhausted,omitempty"`
+	// Schedule controls when the link resolves to its destination. If nil, it always does.
+	Schedule *Schedule `dynamodbav:"schedule,omitempty"`
+	// Interstitial controls whether the visitors are shown a page with the destination before being redirected to it.
+	Interstitial bool `dynamodbav:"interstitial,omitempty"`
+	// Owner is the email of the user that created the link.
+	Owner string `dynamodbav:"owner,omitempty"`
+	// CreatedAt is the time the link was created.
+	CreatedAt time.Time `dynamodbav:"created_at"`
+	Metrics   *Metrics  `dynamodbav:"metrics"`
+	Health    *Health   `dynamodbav:"health,omitempty"`
+}
+
+// ValidateID returns an error if the given ID cannot be used for a link.
+func ValidateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: id cannot be empty", ErrInvalidID)
+	}
+	if strings.Contains(id, "/") {
+		return fmt.Errorf("%w: %q contains a slash", ErrInvalidID, id)
+	}
+	if strings.HasSuffix(id, PreviewSuffix) {
+		return fmt.Errorf("%w: %q ends with %q", ErrInvalidID, id, PreviewSuffix)
+	}
+	if IsReservedID(id) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// ValidateURL returns an error if the given URL cannot be used as the destination of a link.
+//
+// Only absolute http and https URLs are allowed, because the destinations are written to the redirect pages,
+// where e.g. a javascript: URL would run on the origin of the service.
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, err)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("%w: %q is not an absolute URL", ErrInvalidURL, rawURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: the scheme of %q must be http or https", ErrInvalidURL, rawURL)
+	}
+	return nil
+}
+
+// Campaign returns the UTM campaign of the link or an empty string if it has none.
+func (l *Link) Campaign() string {
+	if l.UTM == nil {
+		return ""
+	}
+	return l.UTM.Campaign
+}
+
+// IsExhausted returns true if the link has reached its maximum number of clicks.
+func (l *Link) IsExhausted() bool {
+	return l.MaxClicks > 0 && l.Metrics != nil && l.Metrics.Clicks >= l.MaxClicks
+}
+
+// RemainingClicks returns how many more times the link can be followed,
+// or -1 if the link is not limited.
+func (l *Link) RemainingClicks() int {
+	if l.MaxClicks <= 0 {
+		return -1
+	}
+	if l.Metrics == nil {
+		return l.MaxClicks
+	}
+	if l.Metrics.Clicks >= l.MaxClicks {
+		return 0
+	}
+	return l.MaxClicks - l.Metrics.Clicks
+}
+
+// State returns the state of the link at the given time.
+func (l *Link) State(now time.Time) State {
+	if l.IsExhausted() {
+		return StateExhausted
+	}
+	return l.Schedule.State(now)
+}
+
+// HasTag returns true if the link is tagged with the given tag.
+func (l *Link) HasTag(tag string) bool {
+	for _, t := range l.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// URLs returns all the URLs the link can send its visitors to, i.e. its URL and the URLs of its targeting rules,
+// its destinations and the fallback of its schedule.
+func (l *Link) URLs() []string {
+	urls := []string{l.URL}
+	for _, rule := range l.Targeting {
+		urls = append(urls, rule.URL)
+	}
+	for _, d := range l.Destinations {
+		urls = append(urls, d.URL)
+	}
+	if l.Schedule != nil && l.Schedule.FallbackURL != "" {
+		urls = append(urls, l.Schedule.FallbackURL)
+	}
+	return urls
+}
+
+// SameSettings returns true if the link behaves in the same way as the other link when it is visited,
+// apart from its password, whose hashes differ even for the same password.
+// The URLs of the links are not compared, as links with the same destination are expected to be compared.
+func (l *Link) SameSettings(other *Link) bool {
+	return l.RedirectType == other.RedirectType &&
+		equalPointers(l.Passthrough, other.Passthrough) &&
+		equalPointers(l.UTM, other.UTM) &&
+		slices.Equal(l.Tags, other.Tags) &&
+		slices.EqualFunc(l.Targeting, other.Targeting, TargetingRule.equal) &&
+		slices.Equal(l.Destinations, other.Destinations) &&
+		l.MaxClicks == other.MaxClicks &&
+		l.DeleteWhenExhausted == other.DeleteWhenExhausted &&
+		l.Schedule.equal(other.Schedule) &&
+		l.Interstitial == other.Interstitial
+}
+
+// equalPointers returns true if both pointers are nil or point to equal values.
+func equalPointers[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 type Metrics struct {
-	Clicks int
+	Clicks int `dynamodbav:"clicks"`
+	// Variants holds the clicks per destination ID, for links that split their traffic.
+	Variants map[string]int `dynamodbav:"variants"`
+	// QRScans is the number of clicks that came from scanning a tracked QR code of the link.
+	QRScans int `dynamodbav:"qr_scans"`
+}
+
+// NewMetrics returns the metrics of a link that has not been visited yet.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Clicks:   0,
+		Variants: map[string]int{},
+	}
+}
+
+// Health is the result of the last check of the destination of a link.
+type Health struct {
+	// StatusCode is the status code returned by the destination.
+	// It is 0 if the destination could not be reached at all.
+	StatusCode int `dynamodbav:"status_code"`
+	// Latency is the time it took for the destination, and the URLs it redirected to, to respond.
+	Latency time.Duration `dynamodbav:"latency"`
+	// RedirectChain holds the URLs the destination redirected to, in order.
+	RedirectChain []string `dynamodbav:"redirect_chain,omitempty"`
+	// Error holds the reason the destination could not be reached, if any.
+	Error string `dynamodbav:"error,omitempty"`
+	// CheckedAt is the time the check was performed.
+	CheckedAt time.Time `dynamodbav:"checked_at"`
+}
+
+// IsBroken returns true if the destination could not be reached or responded with an error status code.
+func (h *Health) IsBroken() bool {
+	if h == nil {
+		return false
+	}
+	return h.Error != "" || h.StatusCode >= 400
 }
@@ -0,0 +1,63 @@
+package links_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateURL(t *testing.T) {
+	for _, valid := range []string{
+		"https://asankov.dev",
+		"http://asankov.dev/path?query=1#fragment",
+		"HTTPS://asankov.dev",
+	} {
+		require.NoError(t, links.ValidateURL(valid), valid)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"asankov.dev",
+		"/relative/path",
+		"javascript://x/%0aalert(1)",
+		"javascript:alert(1)",
+		"data://text/html,<script>alert(1)</script>",
+		"ftp://asankov.dev/file",
+	} {
+		require.ErrorIs(t, links.ValidateURL(invalid), links.ErrInvalidURL, invalid)
+	}
+}
+
+func TestSameSettings(t *testing.T) {
+	from := time.Date(2023, time.October, 2, 9, 0, 0, 0, time.UTC)
+	link := links.Link{
+		ID:           "first",
+		URL:          "https://asankov.dev",
+		RedirectType: links.RedirectTemporary,
+		Tags:         []string{"blog"},
+		Schedule:     &links.Schedule{ActiveFrom: &from},
+	}
+
+	same := link
+	same.ID = "second"
+	same.Schedule = &links.Schedule{ActiveFrom: ptr(from.In(time.FixedZone("EEST", 3*60*60)))}
+	require.True(t, link.SameSettings(&same))
+
+	for _, change := range []func(l *links.Link){
+		func(l *links.Link) { l.RedirectType = links.RedirectPermanent },
+		func(l *links.Link) { l.Tags = nil },
+		func(l *links.Link) { l.Schedule = nil },
+		func(l *links.Link) { l.MaxClicks = 10 },
+		func(l *links.Link) { l.Passthrough = &links.Passthrough{Query: true} },
+	} {
+		other := link
+		change(&other)
+		require.False(t, link.SameSettings(&other))
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,92 @@
+package links
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// QueryPrecedence controls which value is used when a query parameter
+// is present both in the incoming request and in the destination URL.
+type QueryPrecedence string
+
+const (
+	// QueryPrecedenceIncoming means that the value from the incoming request is used.
+	// This is the default query precedence.
+	QueryPrecedenceIncoming QueryPrecedence = "incoming"
+	// QueryPrecedenceDestination means that the value from the destination URL is used.
+	QueryPrecedenceDestination QueryPrecedence = "destination"
+)
+
+// QueryPrecedenceFrom returns the QueryPrecedence represented by the given string.
+// An empty string results in the default QueryPrecedenceIncoming.
+func QueryPrecedenceFrom(s string) (QueryPrecedence, error) {
+	switch p := QueryPrecedence(s); p {
+	case "":
+		return QueryPrecedenceIncoming, nil
+	case QueryPrecedenceIncoming, QueryPrecedenceDestination:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidQueryPrecedence, s)
+	}
+}
+
+// Passthrough controls which parts of the incoming request are passed to the destination of a link.
+type Passthrough struct {
+	// Query controls whether the query parameters of the incoming request are merged into the destination.
+	Query bool `dynamodbav:"query"`
+	// QueryPrecedence controls which value wins if a parameter is present in both.
+	QueryPrecedence QueryPrecedence `dynamodbav:"query_precedence,omitempty"`
+	// Path controls whether the path after the link ID is appended to the destination.
+	Path bool `dynamodbav:"path"`
+}
+
+// Apply returns the destination with the passed through parts of the incoming request.
+//
+// path is the unescaped path that follows the link ID and query are the query parameters of the incoming request.
+// It returns ErrPathNotAllowed if path is not empty, but path passthrough is not enabled.
+func (p *Passthrough) Apply(destination, path string, query url.Values) (string, error) {
+	path = strings.Trim(path, "/")
+	if p == nil {
+		if path != "" {
+			return "", ErrPathNotAllowed
+		}
+		return destination, nil
+	}
+	if path != "" && !p.Path {
+		return "", ErrPathNotAllowed
+	}
+	if path == "" && (!p.Query || len(query) == 0) {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if path != "" {
+		segments := make([]string, 0)
+		for _, segment := range strings.Split(path, "/") {
+			// Relative segments are dropped, so that the path cannot escape the destination.
+			if segment == "" || segment == "." || segment == ".." {
+				continue
+			}
+			segments = append(segments, url.PathEscape(segment))
+		}
+		u = u.JoinPath(segments...)
+	}
+
+	if p.Query && len(query) > 0 {
+		merged := u.Query()
+		for key, values := range query {
+			if _, exists := merged[key]; exists && p.QueryPrecedence == QueryPrecedenceDestination {
+				continue
+			}
+			merged[key] = values
+		}
+		u.RawQuery = merged.Encode()
+	}
+
+	return u.String(), nil
+}
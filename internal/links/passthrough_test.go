@@ -0,0 +1,88 @@
+package links_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassthrough(t *testing.T) {
+	testCases := []struct {
+		name        string
+		passthrough *links.Passthrough
+		destination string
+		path        string
+		query       url.Values
+		expected    string
+	}{
+		{
+			name:        "TestNoPassthrough",
+			destination: "https://asankov.dev/blog?a=1",
+			query:       url.Values{"utm_source": {"x"}},
+			expected:    "https://asankov.dev/blog?a=1",
+		},
+		{
+			name:        "TestQueryIncomingPrecedence",
+			passthrough: &links.Passthrough{Query: true, QueryPrecedence: links.QueryPrecedenceIncoming},
+			destination: "https://asankov.dev/blog?a=1&b=2",
+			query:       url.Values{"a": {"3"}, "utm_source": {"x"}},
+			expected:    "https://asankov.dev/blog?a=3&b=2&utm_source=x",
+		},
+		{
+			name:        "TestQueryDestinationPrecedence",
+			passthrough: &links.Passthrough{Query: true, QueryPrecedence: links.QueryPrecedenceDestination},
+			destination: "https://asankov.dev/blog?a=1&b=2",
+			query:       url.Values{"a": {"3"}, "utm_source": {"x"}},
+			expected:    "https://asankov.dev/blog?a=1&b=2&utm_source=x",
+		},
+		{
+			name:        "TestQueryDisabled",
+			passthrough: &links.Passthrough{Path: true},
+			destination: "https://asankov.dev/blog",
+			query:       url.Values{"a": {"3"}},
+			expected:    "https://asankov.dev/blog",
+		},
+		{
+			name:        "TestPath",
+			passthrough: &links.Passthrough{Path: true},
+			destination: "https://asankov.dev/blog/",
+			path:        "2023/hello world",
+			expected:    "https://asankov.dev/blog/2023/hello%20world",
+		},
+		{
+			name:        "TestPathCannotEscapeDestination",
+			passthrough: &links.Passthrough{Path: true},
+			destination: "https://asankov.dev/blog",
+			path:        "../../admin",
+			expected:    "https://asankov.dev/blog/admin",
+		},
+		{
+			name:        "TestPathAndQuery",
+			passthrough: &links.Passthrough{Path: true, Query: true},
+			destination: "https://asankov.dev/docs?lang=en",
+			path:        "intro",
+			query:       url.Values{"lang": {"bg"}},
+			expected:    "https://asankov.dev/docs/intro?lang=bg",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			destination, err := testCase.passthrough.Apply(testCase.destination, testCase.path, testCase.query)
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, destination)
+		})
+	}
+
+	t.Run("TestPathNotAllowed", func(t *testing.T) {
+		_, err := (&links.Passthrough{Query: true}).Apply("https://asankov.dev", "extra", nil)
+		require.ErrorIs(t, err, links.ErrPathNotAllowed)
+
+		var passthrough *links.Passthrough
+		_, err = passthrough.Apply("https://asankov.dev", "extra", nil)
+		require.ErrorIs(t, err, links.ErrPathNotAllowed)
+	})
+}
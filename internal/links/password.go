@@ -0,0 +1,29 @@
+package links
+
+import "golang.org/x/crypto/bcrypt"
+
+// SetPassword protects the link with the given password.
+// An empty password removes the protection.
+func (l *Link) SetPassword(password string) error {
+	if password == "" {
+		l.PasswordHash = nil
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	l.PasswordHash = hash
+	return nil
+}
+
+// IsProtected returns true if the link requires a password.
+func (l *Link) IsProtected() bool {
+	return len(l.PasswordHash) > 0
+}
+
+// CheckPassword returns true if the given password is the password of the link.
+func (l *Link) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(l.PasswordHash, []byte(password)) == nil
+}
@@ -0,0 +1,56 @@
+package links
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RedirectType controls how the visitors of a link are sent to its destination.
+type RedirectType string
+
+const (
+	// RedirectMovedPermanently redirects with 301 Moved Permanently.
+	RedirectMovedPermanently RedirectType = "301"
+	// RedirectFound redirects with 302 Found.
+	// This is the default redirect type.
+	RedirectFound RedirectType = "302"
+	// RedirectTemporary redirects with 307 Temporary Redirect, which preserves the request method.
+	RedirectTemporary RedirectType = "307"
+	// RedirectPermanent redirects with 308 Permanent Redirect, which preserves the request method.
+	RedirectPermanent RedirectType = "308"
+	// RedirectMetaRefresh serves an HTML page that redirects via a meta refresh tag and JavaScript.
+	//
+	// This is useful when the visit needs to be seen by tracking pixels or scripts on the page.
+	RedirectMetaRefresh RedirectType = "meta-refresh"
+)
+
+// RedirectTypeFrom returns the RedirectType represented by the given string.
+// An empty string results in the default RedirectFound.
+func RedirectTypeFrom(s string) (RedirectType, error) {
+	switch t := RedirectType(s); t {
+	case "":
+		return RedirectFound, nil
+	case RedirectMovedPermanently, RedirectFound, RedirectTemporary, RedirectPermanent, RedirectMetaRefresh:
+		return t, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidRedirectType, s)
+	}
+}
+
+// StatusCode returns the HTTP status code used for redirects of this type.
+//
+// For RedirectMetaRefresh it returns 200 OK, because the redirect is done by the served page.
+func (t RedirectType) StatusCode() int {
+	switch t {
+	case RedirectMovedPermanently:
+		return http.StatusMovedPermanently
+	case RedirectTemporary:
+		return http.StatusTemporaryRedirect
+	case RedirectPermanent:
+		return http.StatusPermanentRedirect
+	case RedirectMetaRefresh:
+		return http.StatusOK
+	default:
+		return http.StatusFound
+	}
+}
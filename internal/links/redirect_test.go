@@ -0,0 +1,40 @@
+package links_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectTypeFrom(t *testing.T) {
+	testCases := []struct {
+		value      string
+		expected   links.RedirectType
+		statusCode int
+	}{
+		{value: "", expected: links.RedirectFound, statusCode: http.StatusFound},
+		{value: "301", expected: links.RedirectMovedPermanently, statusCode: http.StatusMovedPermanently},
+		{value: "302", expected: links.RedirectFound, statusCode: http.StatusFound},
+		{value: "307", expected: links.RedirectTemporary, statusCode: http.StatusTemporaryRedirect},
+		{value: "308", expected: links.RedirectPermanent, statusCode: http.StatusPermanentRedirect},
+		{value: "meta-refresh", expected: links.RedirectMetaRefresh, statusCode: http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.value, func(t *testing.T) {
+			redirectType, err := links.RedirectTypeFrom(testCase.value)
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, redirectType)
+			require.Equal(t, testCase.statusCode, redirectType.StatusCode())
+		})
+	}
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		_, err := links.RedirectTypeFrom("303")
+
+		require.ErrorIs(t, err, links.ErrInvalidRedirectType)
+	})
+}
@@ -0,0 +1,270 @@
+package links
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// State is the state of a link, which determines whether it resolves to its destination.
+type State string
+
+const (
+	// StateActive means that the link resolves to its destination.
+	StateActive State = "active"
+	// StateScheduled means that the link is not active yet.
+	StateScheduled State = "scheduled"
+	// StateExpired means that the link is no longer active.
+	StateExpired State = "expired"
+	// StateOffHours means that the link is outside of its recurring window.
+	StateOffHours State = "off-hours"
+	// StateExhausted means that the link has reached its maximum number of clicks.
+	StateExhausted State = "exhausted"
+)
+
+// IsActive returns true if the link resolves to its destination in this state.
+func (s State) IsActive() bool {
+	return s == StateActive
+}
+
+// InactiveBehavior is what the visitors of a link that is not active get.
+type InactiveBehavior string
+
+const (
+	// InactiveNotFound responds as if the link did not exist.
+	InactiveNotFound InactiveBehavior = "not-found"
+	// InactiveHoldingPage shows a page that tells the visitor when the link becomes active.
+	InactiveHoldingPage InactiveBehavior = "holding-page"
+	// InactiveFallback redirects the visitor to the fallback URL of the schedule.
+	InactiveFallback InactiveBehavior = "fallback"
+)
+
+// InactiveBehaviorFrom validates the given string and returns the InactiveBehavior it represents.
+//
+// An empty string results in InactiveNotFound.
+func InactiveBehaviorFrom(s string) (InactiveBehavior, error) {
+	switch b := InactiveBehavior(s); b {
+	case "":
+		return InactiveNotFound, nil
+	case InactiveNotFound, InactiveHoldingPage, InactiveFallback:
+		return b, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidSchedule, s)
+	}
+}
+
+// clockLayout is the layout of the times of day in a Recurrence.
+const clockLayout = "15:04"
+
+// Schedule controls when a link resolves to its destination.
+type Schedule struct {
+	// ActiveFrom is the time the link becomes active. If nil, the link is active from its creation.
+	ActiveFrom *time.Time `dynamodbav:"active_from,omitempty"`
+	// ActiveUntil is the time the link stops being active. If nil, the link never expires.
+	ActiveUntil *time.Time `dynamodbav:"active_until,omitempty"`
+	// Recurring limits the link to a window that repeats every week, within ActiveFrom and ActiveUntil.
+	Recurring *Recurrence `dynamodbav:"recurring,omitempty"`
+	// Inactive is what the visitors get while the link is not active.
+	Inactive InactiveBehavior `dynamodbav:"inactive"`
+	// FallbackURL is where the visitors are sent while the link is not active, with InactiveFallback.
+	FallbackURL string `dynamodbav:"fallback_url,omitempty"`
+}
+
+// Recurrence is a window of time that repeats on the given days of every week.
+type Recurrence struct {
+	// Days are the days of the week the window starts on. If empty, the window repeats every day.
+	Days []time.Weekday `dynamodbav:"days,omitempty"`
+	// From and Until are the times of day the window starts and ends, e.g. 09:00.
+	// If Until is before From, the window ends on the next day.
+	From  string `dynamodbav:"from"`
+	Until string `dynamodbav:"until"`
+	// TimeZone is the IANA name of the time zone From and Until are in. If empty, UTC is used.
+	TimeZone string `dynamodbav:"time_zone,omitempty"`
+}
+
+// Validate returns an error if the schedule is not valid.
+func (s *Schedule) Validate() error {
+	if s == nil {
+		return nil
+	}
+
+	if s.ActiveFrom != nil && s.ActiveUntil != nil && !s.ActiveFrom.Before(*s.ActiveUntil) {
+		return fmt.Errorf("%w: active_from must be before active_until", ErrInvalidSchedule)
+	}
+	if _, err := InactiveBehaviorFrom(string(s.Inactive)); err != nil {
+		return err
+	}
+	if s.Inactive == InactiveFallback && s.FallbackURL == "" {
+		return fmt.Errorf("%w: fallback_url is required for the fallback behavior", ErrInvalidSchedule)
+	}
+	if s.FallbackURL != "" {
+		if err := ValidateURL(s.FallbackURL); err != nil {
+			return fmt.Errorf("%w: invalid fallback_url: %w", ErrInvalidSchedule, err)
+		}
+	}
+	if s.Recurring != nil {
+		return s.Recurring.validate()
+	}
+	return nil
+}
+
+// equal returns true if both schedules are nil or make the links active at the same times in the same way.
+func (s *Schedule) equal(other *Schedule) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	return equalTimes(s.ActiveFrom, other.ActiveFrom) &&
+		equalTimes(s.ActiveUntil, other.ActiveUntil) &&
+		s.Recurring.equal(other.Recurring) &&
+		s.Inactive == other.Inactive &&
+		s.FallbackURL == other.FallbackURL
+}
+
+func (r *Recurrence) equal(other *Recurrence) bool {
+	if r == nil || other == nil {
+		return r == other
+	}
+	return slices.Equal(r.Days, other.Days) &&
+		r.From == other.From &&
+		r.Until == other.Until &&
+		r.TimeZone == other.TimeZone
+}
+
+// equalTimes returns true if both times are nil or are the same instant.
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (r *Recurrence) validate() error {
+	if _, err := r.location(); err != nil {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, r.TimeZone)
+	}
+	from, err := time.Parse(clockLayout, r.From)
+	if err != nil {
+		return fmt.Errorf("%w: from must be in the HH:MM format", ErrInvalidSchedule)
+	}
+	until, err := time.Parse(clockLayout, r.Until)
+	if err != nil {
+		return fmt.Errorf("%w: until must be in the HH:MM format", ErrInvalidSchedule)
+	}
+	if from.Equal(until) {
+		return fmt.Errorf("%w: from and until cannot be the same", ErrInvalidSchedule)
+	}
+	for _, d := range r.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("%w: invalid day %d", ErrInvalidSchedule, d)
+		}
+	}
+	return nil
+}
+
+// State returns the state of the schedule at the given time.
+//
+// A nil schedule is always active.
+func (s *Schedule) State(now time.Time) State {
+	if s == nil {
+		return StateActive
+	}
+	if s.ActiveFrom != nil && now.Before(*s.ActiveFrom) {
+		return StateScheduled
+	}
+	if s.ActiveUntil != nil && !now.Before(*s.ActiveUntil) {
+		return StateExpired
+	}
+	if s.Recurring != nil && !s.Recurring.contains(now) {
+		return StateOffHours
+	}
+	return StateActive
+}
+
+// NextActive returns the first time at or after now at which the schedule is active,
+// or false if it will never be active again.
+func (s *Schedule) NextActive(now time.Time) (time.Time, bool) {
+	if s == nil {
+		return now, true
+	}
+	if s.ActiveFrom != nil && now.Before(*s.ActiveFrom) {
+		now = *s.ActiveFrom
+	}
+	if s.Recurring != nil && !s.Recurring.contains(now) {
+		start, ok := s.Recurring.nextStart(now)
+		if !ok {
+			return time.Time{}, false
+		}
+		now = start
+	}
+	if s.ActiveUntil != nil && !now.Before(*s.ActiveUntil) {
+		return time.Time{}, false
+	}
+	return now, true
+}
+
+// contains returns true if t is within one of the windows of the recurrence.
+func (r *Recurrence) contains(t time.Time) bool {
+	loc, err := r.location()
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+
+	// The window that contains t might have started on the previous day, if it ends after midnight.
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		start, end, ok := r.window(day)
+		if ok && !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStart returns the start of the first window after t.
+func (r *Recurrence) nextStart(t time.Time) (time.Time, bool) {
+	loc, err := r.location()
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = t.In(loc)
+
+	for i := 0; i <= 7; i++ {
+		start, _, ok := r.window(t.AddDate(0, 0, i))
+		if ok && start.After(t) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// window returns the window that starts on the day of t, if there is one.
+func (r *Recurrence) window(t time.Time) (time.Time, time.Time, bool) {
+	if len(r.Days) > 0 && !slices.Contains(r.Days, t.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	from, err := time.Parse(clockLayout, r.From)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	until, err := time.Parse(clockLayout, r.Until)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	year, month, day := t.Date()
+	start := time.Date(year, month, day, from.Hour(), from.Minute(), 0, 0, t.Location())
+	end := time.Date(year, month, day, until.Hour(), until.Minute(), 0, 0, t.Location())
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, true
+}
+
+func (r *Recurrence) location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.TimeZone)
+}
@@ -0,0 +1,141 @@
+package links_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleState(t *testing.T) {
+	from := time.Date(2023, time.October, 2, 9, 0, 0, 0, time.UTC)
+	until := time.Date(2023, time.October, 31, 0, 0, 0, 0, time.UTC)
+
+	schedule := &links.Schedule{
+		ActiveFrom:  &from,
+		ActiveUntil: &until,
+		Recurring: &links.Recurrence{
+			Days:  []time.Weekday{time.Monday, time.Friday},
+			From:  "22:00",
+			Until: "02:00",
+		},
+	}
+	require.NoError(t, schedule.Validate())
+
+	testCases := []struct {
+		name     string
+		now      time.Time
+		expected links.State
+	}{
+		{
+			name:     "TestBeforeActiveFrom",
+			now:      from.Add(-time.Hour),
+			expected: links.StateScheduled,
+		},
+		{
+			name:     "TestAfterActiveUntil",
+			now:      until,
+			expected: links.StateExpired,
+		},
+		{
+			name:     "TestInWindow",
+			now:      time.Date(2023, time.October, 2, 23, 0, 0, 0, time.UTC),
+			expected: links.StateActive,
+		},
+		{
+			name:     "TestInWindowAfterMidnight",
+			now:      time.Date(2023, time.October, 3, 1, 59, 0, 0, time.UTC),
+			expected: links.StateActive,
+		},
+		{
+			name:     "TestAfterWindow",
+			now:      time.Date(2023, time.October, 3, 2, 0, 0, 0, time.UTC),
+			expected: links.StateOffHours,
+		},
+		{
+			name:     "TestOtherDay",
+			now:      time.Date(2023, time.October, 4, 23, 0, 0, 0, time.UTC),
+			expected: links.StateOffHours,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, schedule.State(testCase.now))
+		})
+	}
+
+	t.Run("TestNextActive", func(t *testing.T) {
+		next, ok := schedule.NextActive(from.Add(-time.Hour))
+		require.True(t, ok)
+		require.Equal(t, time.Date(2023, time.October, 2, 22, 0, 0, 0, time.UTC), next)
+
+		next, ok = schedule.NextActive(time.Date(2023, time.October, 3, 12, 0, 0, 0, time.UTC))
+		require.True(t, ok)
+		require.Equal(t, time.Date(2023, time.October, 6, 22, 0, 0, 0, time.UTC), next)
+
+		_, ok = schedule.NextActive(time.Date(2023, time.October, 31, 12, 0, 0, 0, time.UTC))
+		require.False(t, ok)
+	})
+
+	t.Run("TestNil", func(t *testing.T) {
+		var schedule *links.Schedule
+		require.Equal(t, links.StateActive, schedule.State(time.Now()))
+	})
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	schedule := &links.Schedule{
+		Recurring: &links.Recurrence{
+			From:     "09:00",
+			Until:    "17:00",
+			TimeZone: "Europe/Sofia",
+		},
+	}
+	require.NoError(t, schedule.Validate())
+
+	// 09:30 in Sofia is 06:30 UTC in the summer.
+	require.Equal(t, links.StateActive, schedule.State(time.Date(2023, time.July, 3, 6, 30, 0, 0, time.UTC)))
+	require.Equal(t, links.StateOffHours, schedule.State(time.Date(2023, time.July, 3, 14, 30, 0, 0, time.UTC)))
+}
+
+func TestScheduleValidate(t *testing.T) {
+	from := time.Date(2023, time.October, 2, 9, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		schedule links.Schedule
+	}{
+		{
+			name:     "TestUntilBeforeFrom",
+			schedule: links.Schedule{ActiveFrom: &from, ActiveUntil: &from},
+		},
+		{
+			name:     "TestFallbackWithoutURL",
+			schedule: links.Schedule{Inactive: links.InactiveFallback},
+		},
+		{
+			name:     "TestUnsafeFallbackURL",
+			schedule: links.Schedule{Inactive: links.InactiveFallback, FallbackURL: "javascript:alert(1)"},
+		},
+		{
+			name:     "TestInvalidBehavior",
+			schedule: links.Schedule{Inactive: "teapot"},
+		},
+		{
+			name:     "TestInvalidTime",
+			schedule: links.Schedule{Recurring: &links.Recurrence{From: "9am", Until: "17:00"}},
+		},
+		{
+			name:     "TestInvalidTimeZone",
+			schedule: links.Schedule{Recurring: &links.Recurrence{From: "09:00", Until: "17:00", TimeZone: "Mars/Olympus"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.ErrorIs(t, testCase.schedule.Validate(), links.ErrInvalidSchedule)
+		})
+	}
+}
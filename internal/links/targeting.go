@@ -0,0 +1,160 @@
+package links
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Platform is the operating system of a visitor.
+type Platform string
+
+const (
+	PlatformIOS     Platform = "ios"
+	PlatformAndroid Platform = "android"
+	PlatformWindows Platform = "windows"
+	PlatformMacOS   Platform = "macos"
+	PlatformLinux   Platform = "linux"
+)
+
+// Device is the type of device of a visitor.
+type Device string
+
+const (
+	DeviceMobile  Device = "mobile"
+	DeviceTablet  Device = "tablet"
+	DeviceDesktop Device = "desktop"
+)
+
+// Visitor holds the properties of a visitor that targeting rules are evaluated on.
+type Visitor struct {
+	Platform Platform
+	Device   Device
+	// Language is the most preferred language of the visitor, e.g. "en-US".
+	Language string
+	// Country is the ISO 3166-1 alpha-2 code of the country of the visitor, e.g. "BG".
+	Country string
+}
+
+// TargetingRule sends the visitors that match all of its conditions to URL.
+//
+// Each condition matches if the visitor matches any of its values.
+// Conditions without values match all visitors.
+type TargetingRule struct {
+	URL       string     `dynamodbav:"url"`
+	Platforms []Platform `dynamodbav:"platforms,omitempty"`
+	Devices   []Device   `dynamodbav:"devices,omitempty"`
+	// Languages are language tags, e.g. "en" or "en-US".
+	// A language without a region matches all regions of the language.
+	Languages []string `dynamodbav:"languages,omitempty"`
+	// Countries are ISO 3166-1 alpha-2 country codes.
+	Countries []string `dynamodbav:"countries,omitempty"`
+}
+
+// Validate returns an error if the rule is not valid.
+func (r *TargetingRule) Validate() error {
+	if r.URL == "" {
+		return fmt.Errorf("%w: url is required", ErrInvalidTargetingRule)
+	}
+	if err := ValidateURL(r.URL); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTargetingRule, err)
+	}
+	if len(r.Platforms) == 0 && len(r.Devices) == 0 && len(r.Languages) == 0 && len(r.Countries) == 0 {
+		return fmt.Errorf("%w: at least one condition is required", ErrInvalidTargetingRule)
+	}
+	for _, p := range r.Platforms {
+		switch p {
+		case PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux:
+		default:
+			return fmt.Errorf("%w: unknown platform %q", ErrInvalidTargetingRule, p)
+		}
+	}
+	for _, d := range r.Devices {
+		switch d {
+		case DeviceMobile, DeviceTablet, DeviceDesktop:
+		default:
+			return fmt.Errorf("%w: unknown device %q", ErrInvalidTargetingRule, d)
+		}
+	}
+	for _, c := range r.Countries {
+		if len(c) != 2 {
+			return fmt.Errorf("%w: invalid country code %q", ErrInvalidTargetingRule, c)
+		}
+	}
+	return nil
+}
+
+// equal returns true if both rules send the same visitors to the same URL.
+func (r TargetingRule) equal(other TargetingRule) bool {
+	return r.URL == other.URL &&
+		slices.Equal(r.Platforms, other.Platforms) &&
+		slices.Equal(r.Devices, other.Devices) &&
+		slices.Equal(r.Languages, other.Languages) &&
+		slices.Equal(r.Countries, other.Countries)
+}
+
+// Matches returns true if the visitor matches all conditions of the rule.
+func (r *TargetingRule) Matches(v *Visitor) bool {
+	if len(r.Platforms) > 0 && !slices.Contains(r.Platforms, v.Platform) {
+		return false
+	}
+	if len(r.Devices) > 0 && !slices.Contains(r.Devices, v.Device) {
+		return false
+	}
+	if len(r.Languages) > 0 && !r.matchesLanguage(v.Language) {
+		return false
+	}
+	if len(r.Countries) > 0 && !r.matchesCountry(v.Country) {
+		return false
+	}
+	return true
+}
+
+// NeedsCountry returns true if any of the rules has a country condition.
+func NeedsCountry(rules []TargetingRule) bool {
+	for _, r := range rules {
+		if len(r.Countries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTargeting returns the first rule the visitor matches, or nil if none does.
+func (l *Link) MatchTargeting(v *Visitor) *TargetingRule {
+	for i := range l.Targeting {
+		if l.Targeting[i].Matches(v) {
+			return &l.Targeting[i]
+		}
+	}
+	return nil
+}
+
+func (r *TargetingRule) matchesLanguage(language string) bool {
+	if language == "" {
+		return false
+	}
+	primary, _, _ := strings.Cut(language, "-")
+	for _, l := range r.Languages {
+		if strings.EqualFold(l, language) {
+			return true
+		}
+		if !strings.Contains(l, "-") && strings.EqualFold(l, primary) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *TargetingRule) matchesCountry(country string) bool {
+	if country == "" {
+		return false
+	}
+	for _, c := range r.Countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
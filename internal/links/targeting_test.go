@@ -0,0 +1,83 @@
+package links_test
+
+import (
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTargeting(t *testing.T) {
+	link := &links.Link{
+		URL: "https://asankov.dev",
+		Targeting: []links.TargetingRule{
+			{URL: "https://apps.apple.com/app", Platforms: []links.Platform{links.PlatformIOS}},
+			{URL: "https://play.google.com/app", Platforms: []links.Platform{links.PlatformAndroid}},
+			{URL: "https://asankov.dev/bg", Languages: []string{"bg"}, Countries: []string{"BG", "MK"}},
+			{URL: "https://asankov.dev/uk", Languages: []string{"en-GB"}},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		visitor  links.Visitor
+		expected string
+	}{
+		{
+			name:     "TestIOS",
+			visitor:  links.Visitor{Platform: links.PlatformIOS, Device: links.DeviceMobile, Language: "bg-BG", Country: "BG"},
+			expected: "https://apps.apple.com/app",
+		},
+		{
+			name:     "TestAndroid",
+			visitor:  links.Visitor{Platform: links.PlatformAndroid, Device: links.DeviceTablet},
+			expected: "https://play.google.com/app",
+		},
+		{
+			name:     "TestLanguageAndCountry",
+			visitor:  links.Visitor{Platform: links.PlatformWindows, Language: "bg-BG", Country: "bg"},
+			expected: "https://asankov.dev/bg",
+		},
+		{
+			name:     "TestLanguageWithoutCountry",
+			visitor:  links.Visitor{Platform: links.PlatformWindows, Language: "bg"},
+			expected: "https://asankov.dev",
+		},
+		{
+			name:     "TestLanguageWithRegion",
+			visitor:  links.Visitor{Platform: links.PlatformLinux, Language: "en-gb"},
+			expected: "https://asankov.dev/uk",
+		},
+		{
+			name:     "TestFallback",
+			visitor:  links.Visitor{Platform: links.PlatformMacOS, Language: "en-US", Country: "US"},
+			expected: "https://asankov.dev",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			destination := link.URL
+			if rule := link.MatchTargeting(&testCase.visitor); rule != nil {
+				destination = rule.URL
+			}
+			require.Equal(t, testCase.expected, destination)
+		})
+	}
+}
+
+func TestTargetingRuleValidate(t *testing.T) {
+	require.NoError(t, (&links.TargetingRule{URL: "https://asankov.dev", Devices: []links.Device{links.DeviceMobile}}).Validate())
+
+	for _, rule := range []links.TargetingRule{
+		{Devices: []links.Device{links.DeviceMobile}},
+		{URL: "https://asankov.dev"},
+		{URL: "https://asankov.dev", Platforms: []links.Platform{"beos"}},
+		{URL: "https://asankov.dev", Devices: []links.Device{"watch"}},
+		{URL: "https://asankov.dev", Countries: []string{"Bulgaria"}},
+		{URL: "/relative", Devices: []links.Device{links.DeviceMobile}},
+		{URL: "javascript:alert(1)", Devices: []links.Device{links.DeviceMobile}},
+	} {
+		require.ErrorIs(t, rule.Validate(), links.ErrInvalidTargetingRule)
+	}
+}
@@ -0,0 +1,89 @@
+package links
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// UTM holds the Urchin Tracking Module parameters of a link.
+type UTM struct {
+	Source   string `dynamodbav:"source,omitempty"`
+	Medium   string `dynamodbav:"medium,omitempty"`
+	Campaign string `dynamodbav:"campaign,omitempty"`
+	Term     string `dynamodbav:"term,omitempty"`
+	Content  string `dynamodbav:"content,omitempty"`
+}
+
+// Validate returns an error if the UTM parameters are not valid.
+//
+// The source is the only required parameter.
+func (u *UTM) Validate() error {
+	if u == nil {
+		return nil
+	}
+	if strings.TrimSpace(u.Source) == "" {
+		return fmt.Errorf("%w: source is required", ErrInvalidUTM)
+	}
+	return nil
+}
+
+// Apply returns the destination with the UTM parameters set as query parameters.
+//
+// UTM parameters already present in the destination are replaced,
+// all other query parameters and the fragment are preserved.
+func (u *UTM) Apply(destination string) (string, error) {
+	if u == nil {
+		return destination, nil
+	}
+
+	d, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	query := d.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+	for key, value := range map[string]string{
+		"utm_source":   u.Source,
+		"utm_medium":   u.Medium,
+		"utm_campaign": u.Campaign,
+		"utm_term":     u.Term,
+		"utm_content":  u.Content,
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			query.Set(key, value)
+		}
+	}
+	d.RawQuery = query.Encode()
+
+	return d.String(), nil
+}
+
+// NormalizeTags trims the tags and removes the duplicates, preserving the order.
+//
+// It returns ErrInvalidTag if any of the tags is empty.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, ErrInvalidTag
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,46 @@
+package links_test
+
+import (
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTM(t *testing.T) {
+	utm := &links.UTM{
+		Source:   "newsletter",
+		Medium:   "email",
+		Campaign: "spring sale",
+	}
+
+	t.Run("TestApply", func(t *testing.T) {
+		destination, err := utm.Apply("https://asankov.dev/shop?utm_source=old&utm_term=shoes&page=2#top")
+
+		require.NoError(t, err)
+		require.Equal(t, "https://asankov.dev/shop?page=2&utm_campaign=spring+sale&utm_medium=email&utm_source=newsletter#top", destination)
+	})
+
+	t.Run("TestNil", func(t *testing.T) {
+		var utm *links.UTM
+		destination, err := utm.Apply("https://asankov.dev?utm_source=old")
+
+		require.NoError(t, err)
+		require.Equal(t, "https://asankov.dev?utm_source=old", destination)
+		require.NoError(t, utm.Validate())
+	})
+
+	t.Run("TestValidate", func(t *testing.T) {
+		require.NoError(t, utm.Validate())
+		require.ErrorIs(t, (&links.UTM{Campaign: "spring"}).Validate(), links.ErrInvalidUTM)
+	})
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := links.NormalizeTags([]string{" spring ", "email", "spring"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"spring", "email"}, tags)
+
+	_, err = links.NormalizeTags([]string{"spring", " "})
+	require.ErrorIs(t, err, links.ErrInvalidTag)
+}
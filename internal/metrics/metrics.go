@@ -0,0 +1,166 @@
+// Package metrics holds the Prometheus metrics of the service.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// AuthFailureReason is the reason a request was not authenticated.
+type AuthFailureReason string
+
+const (
+	AuthMissingToken       AuthFailureReason = "missing_token"
+	AuthExpiredToken       AuthFailureReason = "expired_token"
+	AuthInvalidToken       AuthFailureReason = "invalid_token"
+	AuthInsufficientRole   AuthFailureReason = "insufficient_role"
+	AuthInvalidCredentials AuthFailureReason = "invalid_credentials"
+)
+
+// Metrics holds the metrics of the service, in a registry of their own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	idConflicts     prometheus.Counter
+	authFailures    *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+	cacheLookups    *prometheus.CounterVec
+}
+
+// New creates the metrics of the service, together with the Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "The number of HTTP requests by operation and status code.",
+		}, []string{"operation", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "The time it took to serve the HTTP requests by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "The number of visits of short links by whether the link exists.",
+		}, []string{"result"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_call_duration_seconds",
+			Help:      "The time the calls to the storage took by backend and method.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"backend", "method"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "The number of calls to the storage that failed by backend and method.",
+		}, []string{"backend", "method"}),
+		idConflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "id_conflicts_total",
+			Help:      "The number of generated link IDs that were already in use.",
+		}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "The number of requests that were not authenticated by reason.",
+		}, []string{"reason"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "The number of HTTP requests that were rejected by a rate limit by operation and the key of the limit.",
+		}, []string{"operation", "key"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "The number of lookups of links in the caches by cache and result, which is hit, miss or error.",
+		}, []string{"cache", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.redirects,
+		m.storageDuration,
+		m.storageErrors,
+		m.idConflicts,
+		m.authFailures,
+		m.rateLimited,
+		m.cacheLookups,
+	)
+	return m
+}
+
+// Handler returns the HTTP handler that serves the metrics in the Prometheus format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest records an HTTP request to the given operation.
+func (m *Metrics) ObserveRequest(operation string, code int, duration time.Duration) {
+	m.requests.WithLabelValues(operation, strconv.Itoa(code)).Inc()
+	m.requestDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveRedirect records a visit of a short link. hit is false if the link does not exist.
+func (m *Metrics) ObserveRedirect(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveStorageCall records a call to the given method of the storage backend.
+func (m *Metrics) ObserveStorageCall(backend, method string, duration time.Duration, failed bool) {
+	m.storageDuration.WithLabelValues(backend, method).Observe(duration.Seconds())
+	if failed {
+		m.storageErrors.WithLabelValues(backend, method).Inc()
+	}
+}
+
+// ObserveIDConflict records a generated link ID that was already in use.
+func (m *Metrics) ObserveIDConflict() {
+	m.idConflicts.Inc()
+}
+
+// ObserveAuthFailure records a request that was not authenticated.
+func (m *Metrics) ObserveAuthFailure(reason AuthFailureReason) {
+	m.authFailures.WithLabelValues(string(reason)).Inc()
+}
+
+// ObserveRateLimited records an HTTP request to the given operation that was rejected by a rate limit,
+// by what the requests are counted by, e.g. ip.
+func (m *Metrics) ObserveRateLimited(operation, key string) {
+	m.rateLimited.WithLabelValues(operation, key).Inc()
+}
+
+// ObserveCacheLookup records a lookup of a link in the given cache. failed is true if the cache could not be read.
+func (m *Metrics) ObserveCacheLookup(cache string, hit, failed bool) {
+	result := "miss"
+	switch {
+	case failed:
+		result = "error"
+	case hit:
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
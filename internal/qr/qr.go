@@ -0,0 +1,303 @@
+// Package qr renders QR codes as PNG and SVG images.
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// DefaultSize is the width and height of the images, in pixels, if no size is set.
+	DefaultSize = 256
+	// MaxSize is the maximum width and height of the images, in pixels.
+	MaxSize = 2048
+	// DefaultMargin is the width of the quiet zone around the code, in modules, recommended by the QR code specification.
+	DefaultMargin = 4
+	// MaxMargin is the maximum width of the quiet zone around the code, in modules.
+	MaxMargin = 16
+
+	// logoRatio is the maximum share of the width of the code the logo takes.
+	// It is small enough for the code to be readable with the high error correction level.
+	logoRatio = 0.2
+)
+
+// ErrInvalidOptions is an error that indicates that the given options are not valid.
+var ErrInvalidOptions = errors.New("invalid QR code options")
+
+// Level is the error correction level of a QR code.
+// Higher levels make the code readable when more of it is damaged or covered, at the cost of a denser code.
+type Level string
+
+const (
+	LevelLow      Level = "low"
+	LevelMedium   Level = "medium"
+	LevelQuartile Level = "quartile"
+	LevelHigh     Level = "high"
+)
+
+var recoveryLevels = map[Level]qrcode.RecoveryLevel{
+	LevelLow:      qrcode.Low,
+	LevelMedium:   qrcode.Medium,
+	LevelQuartile: qrcode.High,
+	LevelHigh:     qrcode.Highest,
+}
+
+// Options configures how a QR code is rendered.
+type Options struct {
+	// Size is the width and height of the image, in pixels.
+	Size int
+	// Level is the error correction level.
+	Level Level
+	// Margin is the width of the quiet zone around the code, in modules.
+	// Codes without a margin are harder to scan, unless they are placed on a light background.
+	Margin int
+	// Foreground and Background are the colors of the dark and the light modules.
+	Foreground color.Color
+	Background color.Color
+	// Logo is drawn in the center of the code, if set.
+	// The error correction level is raised to LevelHigh, so that the code remains readable.
+	Logo image.Image
+}
+
+// Code is a QR code that can be rendered as an image.
+type Code struct {
+	modules [][]bool
+	options Options
+}
+
+// New encodes the content as a QR code.
+//
+// Options that are not set get their default values.
+func New(content string, options Options) (*Code, error) {
+	if options.Size == 0 {
+		options.Size = DefaultSize
+	}
+	if options.Size < 0 || options.Size > MaxSize {
+		return nil, fmt.Errorf("%w: size must be between 1 and %d", ErrInvalidOptions, MaxSize)
+	}
+	if options.Margin < 0 || options.Margin > MaxMargin {
+		return nil, fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+	}
+	if options.Level == "" {
+		options.Level = LevelMedium
+	}
+	if options.Logo != nil {
+		options.Level = LevelHigh
+	}
+	if options.Foreground == nil {
+		options.Foreground = color.Black
+	}
+	if options.Background == nil {
+		options.Background = color.White
+	}
+
+	level, ok := recoveryLevels[options.Level]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown level %q", ErrInvalidOptions, options.Level)
+	}
+
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+	// The quiet zone is added when rendering, with the configured margin.
+	code.DisableBorder = true
+
+	return &Code{
+		modules: code.Bitmap(),
+		options: options,
+	}, nil
+}
+
+// LevelFrom validates the given string and returns the Level it represents.
+func LevelFrom(s string) (Level, error) {
+	level := Level(s)
+	if _, ok := recoveryLevels[level]; !ok {
+		return "", fmt.Errorf("%w: unknown level %q", ErrInvalidOptions, s)
+	}
+	return level, nil
+}
+
+// ParseColor parses a color in the #rrggbb or #rgb hex format. The leading # is optional.
+func ParseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = strings.Repeat(hex[0:1], 2) + strings.Repeat(hex[1:2], 2) + strings.Repeat(hex[2:3], 2)
+	}
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("%w: invalid color %q", ErrInvalidOptions, s)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid color %q", ErrInvalidOptions, s)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, nil
+}
+
+// layout returns the number of modules on each side of the image, including the margin,
+// the size of a single module and the offset of the first module, in pixels.
+func (c *Code) layout() (modules, scale, offset int) {
+	modules = len(c.modules) + 2*c.options.Margin
+	scale = c.options.Size / modules
+	if scale < 1 {
+		scale = 1
+	}
+	offset = (c.options.Size - modules*scale) / 2
+	if offset < 0 {
+		offset = 0
+	}
+	return modules, scale, offset + c.options.Margin*scale
+}
+
+// Image returns the QR code as an image.
+func (c *Code) Image() image.Image {
+	modules, scale, offset := c.layout()
+
+	// The image is larger than requested, if the requested size is too small to fit all modules.
+	size := c.options.Size
+	if minSize := modules * scale; size < minSize {
+		size = minSize
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c.options.Background), image.Point{}, draw.Src)
+
+	foreground := image.NewUniform(c.options.Foreground)
+	for y, row := range c.modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			module := image.Rect(offset+x*scale, offset+y*scale, offset+(x+1)*scale, offset+(y+1)*scale)
+			draw.Draw(img, module, foreground, image.Point{}, draw.Src)
+		}
+	}
+
+	if c.options.Logo != nil {
+		area := c.logoArea(offset, scale)
+		draw.Draw(img, area, image.NewUniform(c.options.Background), image.Point{}, draw.Src)
+		drawScaled(img, area.Inset(scale), c.options.Logo)
+	}
+
+	return img
+}
+
+// PNG writes the QR code as a PNG image.
+func (c *Code) PNG(w io.Writer) error {
+	return png.Encode(w, c.Image())
+}
+
+// SVG writes the QR code as an SVG image, with a single path for all dark modules.
+func (c *Code) SVG(w io.Writer) error {
+	modules, _, _ := c.layout()
+	margin := c.options.Margin
+
+	var path strings.Builder
+	for y, row := range c.modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// Consecutive dark modules in a row are drawn as a single rectangle.
+			start := x
+			for x+1 < len(row) && row[x+1] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start+1, x-start+1)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		c.options.Size, c.options.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, hexColor(c.options.Background))
+	fmt.Fprintf(&buf, `<path fill="%s" d="%s"/>`, hexColor(c.options.Foreground), path.String())
+
+	if c.options.Logo != nil {
+		area := c.logoArea(margin, 1)
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`,
+			area.Min.X, area.Min.Y, area.Dx(), area.Dy(), hexColor(c.options.Background))
+
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, c.options.Logo); err != nil {
+			return err
+		}
+		logoArea := area.Inset(1)
+		fmt.Fprintf(&buf, `<image x="%d" y="%d" width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			logoArea.Min.X, logoArea.Min.Y, logoArea.Dx(), logoArea.Dy(), base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+
+	buf.WriteString(`</svg>`)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// logoArea returns the area in the center of the code that is cleared for the logo, aligned to the modules.
+func (c *Code) logoArea(offset, scale int) image.Rectangle {
+	n := len(c.modules)
+	side := int(float64(n) * logoRatio)
+	// An odd number of modules keeps the area centered.
+	if side%2 == 0 {
+		side++
+	}
+	start := (n - side) / 2
+	return image.Rect(offset+start*scale, offset+start*scale, offset+(start+side)*scale, offset+(start+side)*scale)
+}
+
+// drawScaled draws src into the given area of dst, scaled with the nearest neighbor and keeping its aspect ratio.
+func drawScaled(dst draw.Image, area image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	if bounds.Empty() || area.Empty() {
+		return
+	}
+
+	width, height := area.Dx(), area.Dy()
+	if bounds.Dx() > bounds.Dy() {
+		height = height * bounds.Dy() / bounds.Dx()
+	} else {
+		width = width * bounds.Dx() / bounds.Dy()
+	}
+	x0 := area.Min.X + (area.Dx()-width)/2
+	y0 := area.Min.Y + (area.Dy()-height)/2
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := src.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height)
+			dst.Set(x0+x, y0+y, blend(dst.At(x0+x, y0+y), c))
+		}
+	}
+}
+
+// blend draws c over the background color bg.
+func blend(bg, c color.Color) color.Color {
+	r, g, b, a := c.RGBA()
+	if a == 0xffff {
+		return c
+	}
+	br, bgG, bb, _ := bg.RGBA()
+	inv := 0xffff - a
+	return color.RGBA64{
+		R: uint16(r + br*inv/0xffff),
+		G: uint16(g + bgG*inv/0xffff),
+		B: uint16(b + bb*inv/0xffff),
+		A: 0xffff,
+	}
+}
+
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,109 @@
+package qr_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/asankov/shortener/internal/qr"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	dark  = color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}
+	light = color.RGBA{R: 0xff, G: 0xee, B: 0xdd, A: 0xff}
+)
+
+func TestPNG(t *testing.T) {
+	code, err := qr.New("https://sh.asankov.dev/abc", qr.Options{
+		Size:       290,
+		Margin:     2,
+		Foreground: dark,
+		Background: light,
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, code.PNG(&buf))
+
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 290, 290), img.Bounds())
+
+	require.Equal(t, light, toRGBA(img.At(0, 0)))
+	// The finder pattern in the top left corner starts right after the margin.
+	// The code of the URL is 25x25 modules, which with the margin makes modules of 10px.
+	require.Equal(t, light, toRGBA(img.At(19, 19)))
+	require.Equal(t, dark, toRGBA(img.At(20, 20)))
+}
+
+func TestSVG(t *testing.T) {
+	code, err := qr.New("https://sh.asankov.dev/abc", qr.Options{Margin: qr.DefaultMargin, Foreground: dark})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, code.SVG(&buf))
+
+	svg := buf.String()
+	require.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256" viewBox="0 0 33 33"`))
+	require.Contains(t, svg, `<path fill="#123456" d="M4 4h7v1h-7z`)
+	require.True(t, strings.HasSuffix(svg, "</svg>"))
+}
+
+func TestLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for x := 0; x < 10; x++ {
+		for y := 0; y < 10; y++ {
+			logo.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+		}
+	}
+
+	code, err := qr.New("https://sh.asankov.dev/abc", qr.Options{Size: 330, Logo: logo})
+	require.NoError(t, err)
+
+	img := code.Image()
+	require.Equal(t, color.RGBA{R: 0xff, A: 0xff}, toRGBA(img.At(165, 165)))
+
+	var buf bytes.Buffer
+	require.NoError(t, code.SVG(&buf))
+	require.Contains(t, buf.String(), `href="data:image/png;base64,`)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		options qr.Options
+	}{
+		{name: "TestSizeTooLarge", options: qr.Options{Size: qr.MaxSize + 1}},
+		{name: "TestNegativeSize", options: qr.Options{Size: -1}},
+		{name: "TestMarginTooLarge", options: qr.Options{Margin: qr.MaxMargin + 1}},
+		{name: "TestUnknownLevel", options: qr.Options{Level: "ultra"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := qr.New("https://sh.asankov.dev/abc", testCase.options)
+			require.ErrorIs(t, err, qr.ErrInvalidOptions)
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := qr.ParseColor("#123456")
+	require.NoError(t, err)
+	require.Equal(t, dark, c)
+
+	c, err = qr.ParseColor("fed")
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{R: 0xff, G: 0xee, B: 0xdd, A: 0xff}, c)
+
+	_, err = qr.ParseColor("#12345g")
+	require.ErrorIs(t, err, qr.ErrInvalidOptions)
+}
+
+func toRGBA(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the buckets that are full are removed from a Memory limiter.
+const sweepInterval = time.Minute
+
+// Memory keeps the buckets in the memory of the process, so each replica of the service has buckets of its own.
+type Memory struct {
+	mu sync.Mutex
+	// tats are the theoretical arrival times of the buckets, by key. The buckets that are full are not kept.
+	tats  map[string]time.Time
+	swept time.Time
+}
+
+// NewMemory creates a new Memory limiter.
+func NewMemory() *Memory {
+	return &Memory{
+		tats:  make(map[string]time.Time),
+		swept: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the given key.
+func (m *Memory) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+	tat, result := take(now, m.tats[key], limit)
+	if result.Allowed {
+		m.tats[key] = tat
+	}
+	return result, nil
+}
+
+// sweep removes the buckets that are full, so that the keys that are no longer used do not take memory.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+	for key, tat := range m.tats {
+		if !tat.After(now) {
+			delete(m.tats, key)
+		}
+	}
+	m.swept = now
+}
@@ -0,0 +1,105 @@
+// Package ratelimit limits the rate of events, e.g. requests, with token buckets that are identified by keys.
+//
+// The buckets are implemented with the generic cell rate algorithm (GCRA), which keeps a single timestamp per bucket,
+// so that the same limits hold whether the buckets are kept in the memory of the process or in a shared store.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is the size of a token bucket and how quickly it is refilled:
+// it holds up to Count tokens and Count tokens are added to it each Period.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseLimit parses a limit in the format count/period, e.g. 100/1m. The number of the period can be left out, e.g. 10/s.
+func ParseLimit(s string) (Limit, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q is not in the format count/period, e.g. 100/1m", s)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return Limit{}, fmt.Errorf("invalid count of %q: %w", s, err)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil {
+		return Limit{}, fmt.Errorf("invalid period of %q: %w", s, err)
+	}
+
+	limit := Limit{Count: n, Period: d}
+	if limit.Count <= 0 || limit.Period <= 0 {
+		return Limit{}, fmt.Errorf("the count and the period of %q must be positive", s)
+	}
+	if limit.interval() < time.Microsecond {
+		return Limit{}, fmt.Errorf("the count of %q is too high for its period", s)
+	}
+	return limit, nil
+}
+
+// String returns the limit in the format count/period, e.g. 100/1m0s.
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Count, l.Period)
+}
+
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Limit) UnmarshalText(text []byte) error {
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// interval returns the time it takes to add a single token to the bucket.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Count)
+}
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	// Allowed reports whether there was a token in the bucket.
+	Allowed bool
+	// Remaining is the number of tokens that are left in the bucket.
+	Remaining int
+	// RetryAfter is the time until the next token is added to the bucket, if there was no token.
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+// take takes a token from a bucket whose theoretical arrival time, i.e. the time it is full again, is tat.
+// It returns the new theoretical arrival time of the bucket, which is unchanged if there was no token.
+func take(now, tat time.Time, limit Limit) (time.Time, Result) {
+	if tat.Before(now) {
+		tat = now
+	}
+
+	interval := limit.interval()
+	next := tat.Add(interval)
+	if allowAt := next.Add(-limit.Period); allowAt.After(now) {
+		return tat, Result{
+			RetryAfter: allowAt.Sub(now),
+			Reset:      tat.Sub(now),
+		}
+	}
+	return next, Result{
+		Allowed:   true,
+		Remaining: int(now.Add(limit.Period).Sub(next) / interval),
+		Reset:     next.Sub(now),
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/asankov/shortener/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+type limiter interface {
+	Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error)
+}
+
+func TestParseLimit(t *testing.T) {
+	testCases := []struct {
+		value string
+		limit ratelimit.Limit
+	}{
+		{value: "100/1m", limit: ratelimit.Limit{Count: 100, Period: time.Minute}},
+		{value: "10/s", limit: ratelimit.Limit{Count: 10, Period: time.Second}},
+		{value: " 5/30s ", limit: ratelimit.Limit{Count: 5, Period: 30 * time.Second}},
+	}
+	for _, testCase := range testCases {
+		limit, err := ratelimit.ParseLimit(testCase.value)
+		require.NoError(t, err)
+		require.Equal(t, testCase.limit, limit)
+
+		reparsed, err := ratelimit.ParseLimit(limit.String())
+		require.NoError(t, err)
+		require.Equal(t, limit, reparsed)
+	}
+
+	for _, value := range []string{"", "100", "x/1m", "100/forever", "0/1m", "-1/1m", "10/0s", "10000000/1s"} {
+		_, err := ratelimit.ParseLimit(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestLimiters(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+
+	limiters := map[string]limiter{
+		"TestMemory": ratelimit.NewMemory(),
+		"TestRedis":  ratelimit.NewRedis(client),
+	}
+	for name, l := range limiters {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			limit := ratelimit.Limit{Count: 3, Period: 300 * time.Millisecond}
+
+			for i := 2; i >= 0; i-- {
+				result, err := l.Allow(ctx, "key", limit)
+				require.NoError(t, err)
+				require.True(t, result.Allowed)
+				require.Equal(t, i, result.Remaining)
+				require.Positive(t, result.Reset)
+				require.LessOrEqual(t, result.Reset, limit.Period)
+			}
+
+			result, err := l.Allow(ctx, "key", limit)
+			require.NoError(t, err)
+			require.False(t, result.Allowed)
+			require.Zero(t, result.Remaining)
+			require.Positive(t, result.RetryAfter)
+			require.LessOrEqual(t, result.RetryAfter, 100*time.Millisecond)
+
+			other, err := l.Allow(ctx, "other", limit)
+			require.NoError(t, err)
+			require.True(t, other.Allowed, "the keys have buckets of their own")
+
+			time.Sleep(result.RetryAfter)
+			result, err = l.Allow(ctx, "key", limit)
+			require.NoError(t, err)
+			require.True(t, result.Allowed, "a token is added after the interval")
+		})
+	}
+}
+
+func TestRedisShared(t *testing.T) {
+	server := miniredis.RunT(t)
+	limit := ratelimit.Limit{Count: 2, Period: time.Minute}
+
+	var allowed int
+	for i := 0; i < 4; i++ {
+		// Each replica of the service has a client of its own.
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		result, err := ratelimit.NewRedis(client).Allow(context.Background(), "key", limit)
+		require.NoError(t, err)
+		require.NoError(t, client.Close())
+		if result.Allowed {
+			allowed++
+		}
+	}
+	require.Equal(t, 2, allowed)
+	require.Positive(t, server.TTL("shortener:ratelimit:key"), "the buckets expire once they are full")
+
+	addr := server.Addr()
+	server.Close()
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	_, err := ratelimit.NewRedis(client).Allow(context.Background(), "key", limit)
+	require.Error(t, err)
+}
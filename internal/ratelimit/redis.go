@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix is the prefix of the keys of the buckets in Redis.
+const keyPrefix = "shortener:ratelimit:"
+
+// gcra takes a token from the bucket in KEYS[1], in the same way as take does.
+//
+// The times are in microseconds. The theoretical arrival time is stored as an integer,
+// because Lua formats the large numbers in the exponent notation, and it expires when the bucket is full.
+var gcra = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local next = tat + interval
+local allow_at = next - period
+if allow_at > now then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+redis.call("SET", KEYS[1], string.format("%.0f", next), "PX", math.ceil((next - now) / 1000))
+return {1, math.floor((now + period - next) / interval), 0, next - now}
+`)
+
+// Redis keeps the buckets in Redis, so that all the replicas of the service share them.
+//
+// The current time is taken from the replicas, so their clocks should be synchronized.
+type Redis struct {
+	client redis.Scripter
+}
+
+// NewRedis creates a new Redis limiter that keeps the buckets with the given client.
+func NewRedis(client redis.Scripter) *Redis {
+	return &Redis{client: client}
+}
+
+// Allow takes a token from the bucket of the given key.
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now().UnixMicro()
+	reply, err := gcra.Run(ctx, r.client, []string{keyPrefix + key}, now, limit.interval().Microseconds(), limit.Period.Microseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("error while taking a token from the bucket of %s: %w", key, err)
+	}
+	if len(reply) != 4 {
+		return Result{}, fmt.Errorf("unexpected reply %v while taking a token from the bucket of %s", reply, key)
+	}
+
+	return Result{
+		Allowed:    reply[0] == 1,
+		Remaining:  int(reply[1]),
+		RetryAfter: time.Duration(reply[2]) * time.Microsecond,
+		Reset:      time.Duration(reply[3]) * time.Microsecond,
+	}, nil
+}
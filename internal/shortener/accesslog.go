@@ -0,0 +1,90 @@
+package shortener
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// accessLogContextKey is the key of the access log entry in the context of the requests.
+const accessLogContextKey contextKey = "access_log"
+
+// accessLogEntry holds the details of a request that are known only to the inner handlers, e.g. the authenticated user.
+type accessLogEntry struct {
+	user string
+	// spanContext is the context of the span of the request, so that its record can be correlated with its trace.
+	spanContext trace.SpanContext
+}
+
+// setAccessLogUser records the authenticated user of the request in its access log entry.
+func setAccessLogUser(ctx context.Context, user string) {
+	if entry, ok := ctx.Value(accessLogContextKey).(*accessLogEntry); ok {
+		entry.user = user
+	}
+}
+
+// setAccessLogSpan records the span of the request in its access log entry.
+func setAccessLogSpan(ctx context.Context, span trace.Span) {
+	if entry, ok := ctx.Value(accessLogContextKey).(*accessLogEntry); ok {
+		entry.spanContext = span.SpanContext()
+	}
+}
+
+// accessLogged logs a record for each request to the routes, unless it is left out by the sample rate of its route.
+func (h *handler) accessLogged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{}
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogContextKey, entry)))
+
+		status := rec.Status()
+		if status < http.StatusInternalServerError && !h.sampled(operationOf(r)) {
+			return
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", routeOf(r)),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", rec.Bytes()),
+		}
+		if linkID := mux.Vars(r)["linkId"]; linkID != "" {
+			attrs = append(attrs, slog.String("link_id", linkID))
+		}
+		if entry.user != "" {
+			attrs = append(attrs, slog.String("user", entry.user))
+		}
+		if query := scrubQuery(r.URL.Query()); query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if userAgent := r.UserAgent(); userAgent != "" {
+			attrs = append(attrs, slog.String("user_agent", userAgent))
+		}
+		ctx := trace.ContextWithSpanContext(r.Context(), entry.spanContext)
+		h.logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// sampled returns whether a request to the given operation is logged, based on the sample rate of the operation.
+func (h *handler) sampled(operation string) bool {
+	rate, ok := h.settings.Active().AccessLogSampleRates[operation]
+	if !ok {
+		return true
+	}
+	return rand.Float64() < rate
+}
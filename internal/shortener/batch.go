@@ -0,0 +1,145 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asankov/shortener/internal/apis"
+	"github.com/asankov/shortener/internal/links"
+)
+
+func (h *handler) BatchCreateLinks(w http.ResponseWriter, r *http.Request) {
+	var req apis.BatchCreateLinksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorContext(r.Context(), "Error while decoding request body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Links) == 0 || len(req.Links) > h.batchMaxLinks {
+		h.logger.ErrorContext(r.Context(), "Invalid batch size", "size", len(req.Links), "max", h.batchMaxLinks)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	atomic := req.Atomic != nil && *req.Atomic
+
+	var (
+		results = make([]apis.BatchCreateLinkResult, len(req.Links))
+		valid   = make([]*links.Link, 0, len(req.Links))
+		// indexes holds the index in the request of each valid link.
+		indexes = make([]int, 0, len(req.Links))
+		seen    = make(map[string]bool, len(req.Links))
+		failed  bool
+
+		now  = time.Now().UTC()
+		user = userFrom(r.Context())
+	)
+	for i := range req.Links {
+		item := &req.Links[i]
+		if item.ID == nil {
+			id, err := h.idGenerator.GenerateID(r.Context())
+			if err != nil {
+				h.logger.ErrorContext(r.Context(), "Error while generating ID", "error", err)
+				w.WriteHeader(storageErrorStatus(err))
+				return
+			}
+			item.ID = &id
+		}
+
+		link, err := linkFromCreateRequest(item)
+		if err == nil {
+			err = h.checkDenylist(link)
+		}
+		if err != nil {
+			results[i] = batchResult(apis.BatchStatusInvalid, *item.ID, err)
+			failed = true
+			continue
+		}
+		if seen[link.ID] {
+			results[i] = batchResult(apis.BatchStatusConflict, link.ID, fmt.Errorf("%w: the id is used by another link of the batch", links.ErrLinkAlreadyExists))
+			failed = true
+			continue
+		}
+		seen[link.ID] = true
+
+		link.CreatedAt = now
+		if user != nil {
+			link.Owner = user.Email
+		}
+		valid = append(valid, link)
+		indexes = append(indexes, i)
+	}
+
+	switch {
+	case atomic && failed:
+		for _, i := range indexes {
+			results[i] = batchResult(apis.BatchStatusAborted, *req.Links[i].ID, links.ErrBatchAborted)
+		}
+	case atomic:
+		err := h.db.CreateAll(r.Context(), valid)
+
+		var batchErr *links.BatchError
+		if err != nil && !errors.As(err, &batchErr) {
+			h.logger.ErrorContext(r.Context(), "Error while creating links", "error", err)
+			w.WriteHeader(storageErrorStatus(err))
+			return
+		}
+		for j, link := range valid {
+			if batchErr == nil {
+				results[indexes[j]] = batchCreated(link)
+				continue
+			}
+			results[indexes[j]] = h.batchFailure(r.Context(), link, batchErr.Errs[j])
+		}
+	default:
+		for j, err := range h.db.CreateBatch(r.Context(), valid) {
+			if err == nil {
+				results[indexes[j]] = batchCreated(valid[j])
+				continue
+			}
+			results[indexes[j]] = h.batchFailure(r.Context(), valid[j], err)
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(apis.BatchCreateLinksResponse{Results: results}); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// batchFailure returns the result of a valid link of the batch that was not created.
+func (h *handler) batchFailure(ctx context.Context, link *links.Link, err error) apis.BatchCreateLinkResult {
+	switch {
+	case errors.Is(err, links.ErrLinkAlreadyExists):
+		return batchResult(apis.BatchStatusConflict, link.ID, err)
+	case errors.Is(err, links.ErrBatchAborted):
+		return batchResult(apis.BatchStatusAborted, link.ID, err)
+	default:
+		h.logger.ErrorContext(ctx, "Error while creating link", "link_id", link.ID, "error", err)
+		// The details of internal errors are logged, but not returned to the client.
+		return batchResult(apis.BatchStatusFailed, link.ID, errors.New(http.StatusText(http.StatusInternalServerError)))
+	}
+}
+
+func batchCreated(link *links.Link) apis.BatchCreateLinkResult {
+	res := createLinkResponse(link)
+	return apis.BatchCreateLinkResult{
+		Status: apis.BatchStatusCreated,
+		ID:     &link.ID,
+		Link:   &res,
+	}
+}
+
+func batchResult(status apis.BatchCreateLinkResultStatus, id string, err error) apis.BatchCreateLinkResult {
+	message := err.Error()
+	return apis.BatchCreateLinkResult{
+		Status: status,
+		ID:     &id,
+		Error:  &message,
+	}
+}
@@ -0,0 +1,201 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/asankov/shortener/internal/apis"
+	"github.com/asankov/shortener/internal/bulk"
+	"github.com/asankov/shortener/internal/links"
+)
+
+// importBatchSize is the number of imported links that are written to the database at once.
+const importBatchSize = 100
+
+func (h *handler) ImportLinks(w http.ResponseWriter, r *http.Request) {
+	format, err := bulk.FormatFromContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	reader, err := bulk.NewReader(format, r.Body)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Error while reading import", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var (
+		res = apis.ImportLinksResponse{Errors: []apis.ImportRowError{}}
+
+		seen    = make(map[string]bool)
+		rows    = make([]*bulk.Row, 0, importBatchSize)
+		pending = make([]*links.Link, 0, importBatchSize)
+		user    = userFrom(r.Context())
+	)
+	fail := func(row *bulk.Row, id string, err error) {
+		res.Failed++
+		res.Errors = append(res.Errors, apis.ImportRowError{
+			Row:   row.Number,
+			ID:    emptyToNil(id),
+			Error: err.Error(),
+		})
+	}
+	flush := func() {
+		for i, err := range h.db.CreateBatch(r.Context(), pending) {
+			if err != nil {
+				fail(rows[i], pending[i].ID, err)
+				continue
+			}
+			res.Imported++
+		}
+		rows, pending = rows[:0], pending[:0]
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, bulk.ErrInvalidRow) {
+				fail(row, row.ID, err)
+				continue
+			}
+
+			// The rest of the input cannot be read, but the rows before it are imported and reported,
+			// so that the client knows where to resume from.
+			h.logger.ErrorContext(r.Context(), "Error while reading import", "row", row.Number, "error", err)
+			fail(row, "", err)
+			flush()
+			h.writeImportReport(w, r, http.StatusBadRequest, &res)
+			return
+		}
+
+		link, err := h.linkFromRow(r.Context(), row, seen)
+		if err != nil {
+			fail(row, row.ID, err)
+			continue
+		}
+		if seen[link.ID] {
+			fail(row, link.ID, fmt.Errorf("%w: the id is used by another row", links.ErrLinkAlreadyExists))
+			continue
+		}
+		seen[link.ID] = true
+
+		link.CreatedAt = time.Now().UTC()
+		if user != nil {
+			link.Owner = user.Email
+		}
+
+		rows = append(rows, row)
+		pending = append(pending, link)
+		if len(pending) == importBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	h.writeImportReport(w, r, http.StatusOK, &res)
+}
+
+// writeImportReport responds with the report of an import, with the errors in the order of the rows.
+func (h *handler) writeImportReport(w http.ResponseWriter, r *http.Request, status int, res *apis.ImportLinksResponse) {
+	sort.Slice(res.Errors, func(i, j int) bool {
+		return res.Errors[i].Row < res.Errors[j].Row
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+	}
+}
+
+// maxImportIDAttempts is the number of times an ID is generated for an imported row
+// before giving up, if the generated IDs are used by the other rows of the import.
+const maxImportIDAttempts = 10
+
+// linkFromRow builds a new link from an imported row and validates it.
+//
+// The IDs that are generated for the rows without one are not used by the rows in seen,
+// which are not created yet, so the generator cannot know about them.
+func (h *handler) linkFromRow(ctx context.Context, row *bulk.Row, seen map[string]bool) (*links.Link, error) {
+	for attempt := 0; row.ID == ""; attempt++ {
+		if attempt == maxImportIDAttempts {
+			return nil, links.ErrIDNotGenerated
+		}
+
+		id, err := h.idGenerator.GenerateID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			row.ID = id
+		}
+	}
+	if err := links.ValidateID(row.ID); err != nil {
+		return nil, err
+	}
+	if err := links.ValidateURL(row.URL); err != nil {
+		return nil, err
+	}
+
+	link := row.Link()
+
+	tags, err := links.NormalizeTags(link.Tags)
+	if err != nil {
+		return nil, err
+	}
+	link.Tags = tags
+	link.RedirectType = links.RedirectFound
+
+	if err := link.Schedule.Validate(); err != nil {
+		return nil, err
+	}
+	if err := h.checkDenylist(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+func (h *handler) ExportLinks(w http.ResponseWriter, r *http.Request, params apis.ExportLinksParams) {
+	format := bulk.FormatCSV
+	if params.Format != nil {
+		format = bulk.Format(*params.Format)
+	}
+
+	switch format {
+	case bulk.FormatCSV, bulk.FormatNDJSON, bulk.FormatJSON:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links.%s"`, format))
+
+	writer, err := bulk.NewWriter(format, w)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while starting export", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The links are streamed as they are read, so the status cannot be changed after the first one is written
+	// and an incomplete export can only be detected by the client from the missing end of the output.
+	if err := h.db.ForEach(r.Context(), writer.Write); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while exporting links", "error", err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while finishing export", "error", err)
+	}
+}
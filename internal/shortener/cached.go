@@ -0,0 +1,232 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/metrics"
+	"golang.org/x/exp/slog"
+	"golang.org/x/sync/singleflight"
+)
+
+// uncachedContextKey marks the lookups of links that must read them from the storage.
+const uncachedContextKey contextKey = "uncached"
+
+// uncached returns a copy of ctx whose lookups of links bypass the caches,
+// e.g. to read the latest number of clicks or to read a link before changing it.
+func uncached(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedContextKey, true)
+}
+
+// cacheTier is one of the caches of the links, e.g. the one in the memory of the process.
+type cacheTier struct {
+	name  string
+	cache Cache
+}
+
+// cachedDatabase serves the lookups of the links by ID from the caches, in order, before reading them from the Database.
+//
+// The IDs of the links that are not found are cached as well, for a shorter time, so that the visits of the links
+// that do not exist do not reach the storage. The concurrent lookups of the same ID that miss the caches share a single read.
+//
+// A change of a link removes it from the caches of this replica and from the shared cache, but the other replicas
+// can serve it from their own caches until it expires. The number of clicks of a cached link can be stale as well,
+// but the click limits are still enforced by IncrementClicks.
+type cachedDatabase struct {
+	db    Database
+	tiers []cacheTier
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	group singleflight.Group
+	// generation is incremented on each change of the links,
+	// so that the reads that started before a change do not put the links they read in the caches.
+	generation atomic.Uint64
+
+	metrics *metrics.Metrics
+	logger  *slog.Logger
+}
+
+func (d *cachedDatabase) GetByID(ctx context.Context, id string) (*links.Link, error) {
+	if bypass, _ := ctx.Value(uncachedContextKey).(bool); bypass {
+		return d.db.GetByID(ctx, id)
+	}
+
+	for i, tier := range d.tiers {
+		value, ok, err := tier.cache.Get(ctx, id)
+		d.metrics.ObserveCacheLookup(tier.name, ok, err != nil)
+		if err != nil {
+			d.logger.WarnContext(ctx, "error while getting link from cache", "cache", tier.name, "link_id", id, "error", err)
+			continue
+		}
+		if ok {
+			d.fill(ctx, d.tiers[:i], id, value)
+			return decodeLink(value)
+		}
+	}
+
+	result := d.group.DoChan(id, func() (any, error) {
+		// The read is shared by the concurrent lookups, so it is not cancelled when the first one is.
+		ctx := detachedContext{ctx}
+		generation := d.generation.Load()
+
+		var value []byte
+		link, err := d.db.GetByID(ctx, id)
+		switch {
+		case errors.Is(err, links.ErrLinkNotFound):
+			value = []byte{}
+		case err != nil:
+			return nil, err
+		default:
+			if value, err = json.Marshal(link); err != nil {
+				return nil, err
+			}
+		}
+
+		if d.generation.Load() == generation {
+			d.fill(ctx, d.tiers, id, value)
+		}
+		return value, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return decodeLink(res.Val.([]byte))
+	}
+}
+
+// fill puts the encoded link, or an empty value if the link does not exist, in the given caches.
+//
+// Nothing is cached if the TTL is not positive, since Redis would keep the values with a zero TTL forever.
+func (d *cachedDatabase) fill(ctx context.Context, tiers []cacheTier, id string, value []byte) {
+	ttl := d.ttl
+	if len(value) == 0 {
+		ttl = d.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	for _, tier := range tiers {
+		if err := tier.cache.Set(ctx, id, value, ttl); err != nil {
+			d.logger.WarnContext(ctx, "error while putting link in cache", "cache", tier.name, "link_id", id, "error", err)
+		}
+	}
+}
+
+// invalidate removes the links with the given IDs from the caches.
+func (d *cachedDatabase) invalidate(ctx context.Context, ids ...string) {
+	d.generation.Add(1)
+	for _, id := range ids {
+		// The lookups that start after the change do not wait for the reads that started before it.
+		d.group.Forget(id)
+	}
+
+	// The links are removed even if the caller has gone away after changing them.
+	ctx = detachedContext{ctx}
+	for _, tier := range d.tiers {
+		if err := tier.cache.Delete(ctx, ids...); err != nil {
+			d.logger.WarnContext(ctx, "error while removing links from cache", "cache", tier.name, "links", len(ids), "error", err)
+		}
+	}
+}
+
+// decodeLink decodes a link from a cache, where an empty value means that the link does not exist.
+func decodeLink(value []byte) (*links.Link, error) {
+	if len(value) == 0 {
+		return nil, links.ErrLinkNotFound
+	}
+	var link links.Link
+	if err := json.Unmarshal(value, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (d *cachedDatabase) GetAll(ctx context.Context) ([]*links.Link, error) {
+	return d.db.GetAll(ctx)
+}
+
+func (d *cachedDatabase) ForEach(ctx context.Context, fn func(link *links.Link) error) error {
+	return d.db.ForEach(ctx, fn)
+}
+
+func (d *cachedDatabase) GetByDestination(ctx context.Context, owner, url string) ([]*links.Link, error) {
+	return d.db.GetByDestination(ctx, owner, url)
+}
+
+func (d *cachedDatabase) Create(ctx context.Context, link *links.Link) error {
+	// The ID may be cached as one of a link that does not exist.
+	defer d.invalidate(ctx, link.ID)
+	return d.db.Create(ctx, link)
+}
+
+func (d *cachedDatabase) CreateBatch(ctx context.Context, batch []*links.Link) []error {
+	defer d.invalidate(ctx, linkIDs(batch)...)
+	return d.db.CreateBatch(ctx, batch)
+}
+
+func (d *cachedDatabase) CreateAll(ctx context.Context, batch []*links.Link) error {
+	defer d.invalidate(ctx, linkIDs(batch)...)
+	return d.db.CreateAll(ctx, batch)
+}
+
+func (d *cachedDatabase) Update(ctx context.Context, link *links.Link) error {
+	defer d.invalidate(ctx, link.ID)
+	return d.db.Update(ctx, link)
+}
+
+func (d *cachedDatabase) Delete(ctx context.Context, id string) error {
+	defer d.invalidate(ctx, id)
+	return d.db.Delete(ctx, id)
+}
+
+// IncrementClicks does not remove the link from the caches, because it is called on each visit,
+// unless the link cannot be visited anymore.
+func (d *cachedDatabase) IncrementClicks(ctx context.Context, id string, click links.Click) (int, error) {
+	clicks, err := d.db.IncrementClicks(ctx, id, click)
+	if errors.Is(err, links.ErrClickLimitReached) || errors.Is(err, links.ErrLinkNotFound) {
+		d.invalidate(ctx, id)
+	}
+	return clicks, err
+}
+
+func (d *cachedDatabase) UpdateHealth(ctx context.Context, id string, health *links.Health) error {
+	defer d.invalidate(ctx, id)
+	return d.db.UpdateHealth(ctx, id, health)
+}
+
+// linkIDs returns the IDs of the given links.
+func linkIDs(batch []*links.Link) []string {
+	ids := make([]string, 0, len(batch))
+	for _, link := range batch {
+		ids = append(ids, link.ID)
+	}
+	return ids
+}
+
+// detachedContext keeps the values of its parent, e.g. the span of the request, but is never cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
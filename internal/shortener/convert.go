@@ -0,0 +1,515 @@
+package shortener
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asankov/shortener/internal/apis"
+	"github.com/asankov/shortener/internal/links"
+)
+
+// linkFromCreateRequest builds a new link from the request and validates it.
+func linkFromCreateRequest(req *apis.CreateShortLinkRequest) (*links.Link, error) {
+	if err := links.ValidateID(*req.ID); err != nil {
+		return nil, err
+	}
+	if err := links.ValidateURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	link := &links.Link{
+		ID:  *req.ID,
+		URL: req.URL,
+	}
+
+	redirectType, err := redirectTypeFrom(req.RedirectType)
+	if err != nil {
+		return nil, err
+	}
+	link.RedirectType = redirectType
+
+	passthrough, err := passthroughFrom(req.Passthrough)
+	if err != nil {
+		return nil, err
+	}
+	link.Passthrough = passthrough
+
+	tags, err := tagsFrom(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	link.Tags = tags
+
+	targeting, err := targetingFrom(req.Targeting)
+	if err != nil {
+		return nil, err
+	}
+	link.Targeting = targeting
+
+	destinations, err := destinationsFrom(req.Destinations)
+	if err != nil {
+		return nil, err
+	}
+	link.Destinations = destinations
+
+	if req.Password != nil {
+		if err := link.SetPassword(*req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.MaxClicks != nil {
+		maxClicks, err := maxClicksFrom(*req.MaxClicks)
+		if err != nil {
+			return nil, err
+		}
+		link.MaxClicks = maxClicks
+	}
+	if req.DeleteWhenExhausted != nil {
+		link.DeleteWhenExhausted = *req.DeleteWhenExhausted
+	}
+	if req.Interstitial != nil {
+		link.Interstitial = *req.Interstitial
+	}
+
+	schedule, err := scheduleFrom(req.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	link.Schedule = schedule
+
+	if err := applyUTM(link, utmFrom(req.Utm)); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// applyUpdateRequest applies the properties set in the request to the link and validates them.
+func applyUpdateRequest(link *links.Link, req *apis.UpdateShortLinkRequest) error {
+	if req.URL != nil {
+		if err := links.ValidateURL(*req.URL); err != nil {
+			return err
+		}
+		link.URL = *req.URL
+	}
+
+	if req.RedirectType != nil || link.RedirectType == "" {
+		redirectType, err := redirectTypeFrom(req.RedirectType)
+		if err != nil {
+			return err
+		}
+		link.RedirectType = redirectType
+	}
+
+	if req.Passthrough != nil {
+		passthrough, err := passthroughFrom(req.Passthrough)
+		if err != nil {
+			return err
+		}
+		link.Passthrough = passthrough
+	}
+
+	if req.Tags != nil {
+		tags, err := tagsFrom(req.Tags)
+		if err != nil {
+			return err
+		}
+		link.Tags = tags
+	}
+
+	if req.Targeting != nil {
+		targeting, err := targetingFrom(req.Targeting)
+		if err != nil {
+			return err
+		}
+		link.Targeting = targeting
+	}
+
+	if req.Destinations != nil {
+		destinations, err := destinationsFrom(req.Destinations)
+		if err != nil {
+			return err
+		}
+		link.Destinations = destinations
+	}
+
+	if req.Password != nil {
+		if err := link.SetPassword(*req.Password); err != nil {
+			return err
+		}
+	}
+
+	if req.MaxClicks != nil {
+		maxClicks, err := maxClicksFrom(*req.MaxClicks)
+		if err != nil {
+			return err
+		}
+		link.MaxClicks = maxClicks
+	}
+	if req.DeleteWhenExhausted != nil {
+		link.DeleteWhenExhausted = *req.DeleteWhenExhausted
+	}
+	if req.Interstitial != nil {
+		link.Interstitial = *req.Interstitial
+	}
+
+	if req.Schedule != nil {
+		schedule, err := scheduleFrom(req.Schedule)
+		if err != nil {
+			return err
+		}
+		link.Schedule = schedule
+	}
+
+	if req.Utm != nil || req.URL != nil {
+		utm := link.UTM
+		if req.Utm != nil {
+			utm = utmFrom(req.Utm)
+		}
+		if err := applyUTM(link, utm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyUTM validates the UTM parameters, sets them to the link and composes its destination.
+func applyUTM(link *links.Link, utm *links.UTM) error {
+	if err := utm.Validate(); err != nil {
+		return err
+	}
+
+	url, err := utm.Apply(link.URL)
+	if err != nil {
+		return err
+	}
+
+	link.UTM = utm
+	link.URL = url
+	return nil
+}
+
+// createLinkResponse converts the link to its API representation.
+func createLinkResponse(link *links.Link) apis.CreateShortLinkResponse {
+	res := apis.CreateShortLinkResponse{
+		ID:                link.ID,
+		URL:               link.URL,
+		RedirectType:      apis.RedirectType(link.RedirectType),
+		Passthrough:       passthroughResponse(link.Passthrough),
+		Utm:               utmResponse(link.UTM),
+		Tags:              tagsResponse(link.Tags),
+		Targeting:         targetingResponse(link.Targeting),
+		Destinations:      destinationsResponse(link.Destinations),
+		PasswordProtected: link.IsProtected(),
+		Schedule:          scheduleResponse(link.Schedule),
+		Interstitial:      link.Interstitial,
+		CreatedAt:         link.CreatedAt,
+		Owner:             emptyToNil(link.Owner),
+	}
+	if link.MaxClicks > 0 {
+		res.MaxClicks = &link.MaxClicks
+		res.DeleteWhenExhausted = &link.DeleteWhenExhausted
+	}
+	return res
+}
+
+// maxClicksFrom validates the maximum number of clicks of a link.
+func maxClicksFrom(maxClicks int) (int, error) {
+	if maxClicks < 0 {
+		return 0, fmt.Errorf("%w: %d", links.ErrInvalidClickLimit, maxClicks)
+	}
+	return maxClicks, nil
+}
+
+// redirectTypeFrom converts the optional API redirect type to a links.RedirectType.
+func redirectTypeFrom(t *apis.RedirectType) (links.RedirectType, error) {
+	if t == nil {
+		return links.RedirectFound, nil
+	}
+	return links.RedirectTypeFrom(string(*t))
+}
+
+// passthroughFrom converts the optional API passthrough to a links.Passthrough.
+func passthroughFrom(p *apis.Passthrough) (*links.Passthrough, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	var precedence string
+	if p.QueryPrecedence != nil {
+		precedence = string(*p.QueryPrecedence)
+	}
+	queryPrecedence, err := links.QueryPrecedenceFrom(precedence)
+	if err != nil {
+		return nil, err
+	}
+
+	return &links.Passthrough{
+		Query:           p.Query,
+		QueryPrecedence: queryPrecedence,
+		Path:            p.Path,
+	}, nil
+}
+
+func passthroughResponse(p *links.Passthrough) *apis.Passthrough {
+	if p == nil {
+		return nil
+	}
+
+	queryPrecedence := apis.PassthroughQueryPrecedence(p.QueryPrecedence)
+	return &apis.Passthrough{
+		Query:           p.Query,
+		QueryPrecedence: &queryPrecedence,
+		Path:            p.Path,
+	}
+}
+
+// utmFrom converts the optional API UTM parameters to links.UTM.
+func utmFrom(u *apis.UTM) *links.UTM {
+	if u == nil {
+		return nil
+	}
+
+	return &links.UTM{
+		Source:   u.Source,
+		Medium:   valueOrEmpty(u.Medium),
+		Campaign: valueOrEmpty(u.Campaign),
+		Term:     valueOrEmpty(u.Term),
+		Content:  valueOrEmpty(u.Content),
+	}
+}
+
+func utmResponse(u *links.UTM) *apis.UTM {
+	if u == nil {
+		return nil
+	}
+
+	return &apis.UTM{
+		Source:   u.Source,
+		Medium:   emptyToNil(u.Medium),
+		Campaign: emptyToNil(u.Campaign),
+		Term:     emptyToNil(u.Term),
+		Content:  emptyToNil(u.Content),
+	}
+}
+
+// tagsFrom converts the optional API tags to normalized link tags.
+func tagsFrom(tags *[]string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	return links.NormalizeTags(*tags)
+}
+
+func tagsResponse(tags []string) *[]string {
+	return nilIfEmpty(tags)
+}
+
+// targetingFrom converts the optional API targeting rules to validated links.TargetingRule.
+func targetingFrom(rules *[]apis.TargetingRule) ([]links.TargetingRule, error) {
+	if rules == nil || len(*rules) == 0 {
+		return nil, nil
+	}
+
+	result := make([]links.TargetingRule, 0, len(*rules))
+	for _, r := range *rules {
+		rule := links.TargetingRule{
+			URL:       r.URL,
+			Languages: valuesOrNil(r.Languages),
+			Countries: valuesOrNil(r.Countries),
+		}
+		for _, p := range valuesOrNil(r.Platforms) {
+			rule.Platforms = append(rule.Platforms, links.Platform(p))
+		}
+		for _, d := range valuesOrNil(r.Devices) {
+			rule.Devices = append(rule.Devices, links.Device(d))
+		}
+
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+func targetingResponse(rules []links.TargetingRule) *[]apis.TargetingRule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	result := make([]apis.TargetingRule, 0, len(rules))
+	for _, r := range rules {
+		rule := apis.TargetingRule{
+			URL:       r.URL,
+			Languages: nilIfEmpty(r.Languages),
+			Countries: nilIfEmpty(r.Countries),
+		}
+		if len(r.Platforms) > 0 {
+			platforms := make([]apis.TargetingRulePlatforms, 0, len(r.Platforms))
+			for _, p := range r.Platforms {
+				platforms = append(platforms, apis.TargetingRulePlatforms(p))
+			}
+			rule.Platforms = &platforms
+		}
+		if len(r.Devices) > 0 {
+			devices := make([]apis.TargetingRuleDevices, 0, len(r.Devices))
+			for _, d := range r.Devices {
+				devices = append(devices, apis.TargetingRuleDevices(d))
+			}
+			rule.Devices = &devices
+		}
+		result = append(result, rule)
+	}
+	return &result
+}
+
+// scheduleFrom converts the optional API schedule to a validated links.Schedule.
+//
+// A schedule without any of its properties set removes the schedule of the link.
+func scheduleFrom(s *apis.Schedule) (*links.Schedule, error) {
+	if s == nil || (s.ActiveFrom == nil && s.ActiveUntil == nil && s.Recurring == nil && s.Inactive == nil && s.FallbackURL == nil) {
+		return nil, nil
+	}
+
+	var behavior string
+	if s.Inactive != nil {
+		behavior = string(*s.Inactive)
+	}
+	inactive, err := links.InactiveBehaviorFrom(behavior)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &links.Schedule{
+		ActiveFrom:  s.ActiveFrom,
+		ActiveUntil: s.ActiveUntil,
+		Inactive:    inactive,
+		FallbackURL: valueOrEmpty(s.FallbackURL),
+	}
+	if s.Recurring != nil {
+		schedule.Recurring = &links.Recurrence{
+			From:     s.Recurring.From,
+			Until:    s.Recurring.Until,
+			TimeZone: valueOrEmpty(s.Recurring.TimeZone),
+		}
+		for _, d := range valuesOrNil(s.Recurring.Days) {
+			day, ok := weekdays[d]
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid day %q", links.ErrInvalidSchedule, d)
+			}
+			schedule.Recurring.Days = append(schedule.Recurring.Days, day)
+		}
+	}
+
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func scheduleResponse(s *links.Schedule) *apis.Schedule {
+	if s == nil {
+		return nil
+	}
+
+	inactive := apis.ScheduleInactive(s.Inactive)
+	res := &apis.Schedule{
+		ActiveFrom:  s.ActiveFrom,
+		ActiveUntil: s.ActiveUntil,
+		Inactive:    &inactive,
+		FallbackURL: emptyToNil(s.FallbackURL),
+	}
+	if s.Recurring != nil {
+		res.Recurring = &apis.Recurrence{
+			From:     s.Recurring.From,
+			Until:    s.Recurring.Until,
+			TimeZone: emptyToNil(s.Recurring.TimeZone),
+		}
+		if len(s.Recurring.Days) > 0 {
+			days := make([]apis.RecurrenceDays, 0, len(s.Recurring.Days))
+			for _, d := range s.Recurring.Days {
+				days = append(days, apis.RecurrenceDays(strings.ToLower(d.String())))
+			}
+			res.Recurring.Days = &days
+		}
+	}
+	return res
+}
+
+var weekdays = map[apis.RecurrenceDays]time.Weekday{
+	apis.Sunday:    time.Sunday,
+	apis.Monday:    time.Monday,
+	apis.Tuesday:   time.Tuesday,
+	apis.Wednesday: time.Wednesday,
+	apis.Thursday:  time.Thursday,
+	apis.Friday:    time.Friday,
+	apis.Saturday:  time.Saturday,
+}
+
+// destinationsFrom converts the optional API destinations to validated links.Destination.
+func destinationsFrom(destinations *[]apis.Destination) ([]links.Destination, error) {
+	if destinations == nil || len(*destinations) == 0 {
+		return nil, nil
+	}
+
+	result := make([]links.Destination, 0, len(*destinations))
+	for _, d := range *destinations {
+		result = append(result, links.Destination{
+			ID:     d.ID,
+			URL:    d.URL,
+			Weight: d.Weight,
+		})
+	}
+	if err := links.ValidateDestinations(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func destinationsResponse(destinations []links.Destination) *[]apis.Destination {
+	if len(destinations) == 0 {
+		return nil
+	}
+
+	result := make([]apis.Destination, 0, len(destinations))
+	for _, d := range destinations {
+		result = append(result, apis.Destination{
+			ID:     d.ID,
+			URL:    d.URL,
+			Weight: d.Weight,
+		})
+	}
+	return &result
+}
+
+func valuesOrNil[T any](values *[]T) []T {
+	if values == nil {
+		return nil
+	}
+	return *values
+}
+
+func nilIfEmpty[T any](values []T) *[]T {
+	if len(values) == 0 {
+		return nil
+	}
+	return &values
+}
+
+func valueOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func emptyToNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,191 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/asankov/shortener/internal/idempotency"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/users"
+)
+
+// statusClientClosedRequest is the non-standard status, introduced by nginx,
+// of the requests whose clients have gone away before the response was written.
+const statusClientClosedRequest = 499
+
+// storageErrorStatus returns the status of a response to a request that failed because of a storage error.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// deadlines are the maximum durations of the different kinds of calls to a storage.
+//
+// A zero duration means that the calls of this kind are limited only by the context of the caller.
+type deadlines struct {
+	read  time.Duration
+	write time.Duration
+	scan  time.Duration
+}
+
+// withTimeout returns a copy of ctx that is cancelled after timeout, unless timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// deadlineDatabase limits the duration of each call to a Database.
+type deadlineDatabase struct {
+	db Database
+	deadlines
+}
+
+func (d *deadlineDatabase) GetByID(ctx context.Context, id string) (*links.Link, error) {
+	ctx, cancel := withTimeout(ctx, d.read)
+	defer cancel()
+	return d.db.GetByID(ctx, id)
+}
+
+func (d *deadlineDatabase) GetAll(ctx context.Context) ([]*links.Link, error) {
+	ctx, cancel := withTimeout(ctx, d.scan)
+	defer cancel()
+	return d.db.GetAll(ctx)
+}
+
+func (d *deadlineDatabase) ForEach(ctx context.Context, fn func(link *links.Link) error) error {
+	ctx, cancel := withTimeout(ctx, d.scan)
+	defer cancel()
+	return d.db.ForEach(ctx, fn)
+}
+
+func (d *deadlineDatabase) GetByDestination(ctx context.Context, owner, url string) ([]*links.Link, error) {
+	ctx, cancel := withTimeout(ctx, d.read)
+	defer cancel()
+	return d.db.GetByDestination(ctx, owner, url)
+}
+
+func (d *deadlineDatabase) Create(ctx context.Context, link *links.Link) error {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.Create(ctx, link)
+}
+
+func (d *deadlineDatabase) CreateBatch(ctx context.Context, batch []*links.Link) []error {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.CreateBatch(ctx, batch)
+}
+
+func (d *deadlineDatabase) CreateAll(ctx context.Context, batch []*links.Link) error {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.CreateAll(ctx, batch)
+}
+
+func (d *deadlineDatabase) Update(ctx context.Context, link *links.Link) error {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.Update(ctx, link)
+}
+
+func (d *deadlineDatabase) Delete(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.Delete(ctx, id)
+}
+
+func (d *deadlineDatabase) IncrementClicks(ctx context.Context, id string, click links.Click) (int, error) {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.IncrementClicks(ctx, id, click)
+}
+
+func (d *deadlineDatabase) UpdateHealth(ctx context.Context, id string, health *links.Health) error {
+	ctx, cancel := withTimeout(ctx, d.write)
+	defer cancel()
+	return d.db.UpdateHealth(ctx, id, health)
+}
+
+// deadlineIDGenerator limits the duration of each call to an IDGenerator.
+//
+// Generating an ID can take several reads, so it is limited as a write.
+type deadlineIDGenerator struct {
+	idGenerator IDGenerator
+	deadlines
+}
+
+func (g *deadlineIDGenerator) GenerateID(ctx context.Context) (string, error) {
+	ctx, cancel := withTimeout(ctx, g.write)
+	defer cancel()
+	return g.idGenerator.GenerateID(ctx)
+}
+
+// deadlineUserService limits the duration of each call to a UserService.
+type deadlineUserService struct {
+	userService UserService
+	deadlines
+}
+
+func (s *deadlineUserService) GetUser(ctx context.Context, email, password string) (*users.User, error) {
+	ctx, cancel := withTimeout(ctx, s.read)
+	defer cancel()
+	return s.userService.GetUser(ctx, email, password)
+}
+
+func (s *deadlineUserService) CreateUser(ctx context.Context, email, password string, roles []users.Role) error {
+	ctx, cancel := withTimeout(ctx, s.write)
+	defer cancel()
+	return s.userService.CreateUser(ctx, email, password, roles)
+}
+
+// deadlineConfigService limits the duration of each call to a ConfigService.
+type deadlineConfigService struct {
+	configService ConfigService
+	deadlines
+}
+
+func (s *deadlineConfigService) ShouldCreateInitialUser(ctx context.Context) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.read)
+	defer cancel()
+	return s.configService.ShouldCreateInitialUser(ctx)
+}
+
+// deadlineIdempotencyStore limits the duration of each call to an IdempotencyStore.
+type deadlineIdempotencyStore struct {
+	store IdempotencyStore
+	deadlines
+}
+
+func (s *deadlineIdempotencyStore) GetIdempotencyRecord(ctx context.Context, key string) (*idempotency.Record, error) {
+	ctx, cancel := withTimeout(ctx, s.read)
+	defer cancel()
+	return s.store.GetIdempotencyRecord(ctx, key)
+}
+
+func (s *deadlineIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, record *idempotency.Record) error {
+	ctx, cancel := withTimeout(ctx, s.write)
+	defer cancel()
+	return s.store.ReserveIdempotencyKey(ctx, record)
+}
+
+func (s *deadlineIdempotencyStore) SaveIdempotencyRecord(ctx context.Context, record *idempotency.Record) error {
+	ctx, cancel := withTimeout(ctx, s.write)
+	defer cancel()
+	return s.store.SaveIdempotencyRecord(ctx, record)
+}
+
+func (s *deadlineIdempotencyStore) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	ctx, cancel := withTimeout(ctx, s.write)
+	defer cancel()
+	return s.store.DeleteIdempotencyRecord(ctx, key)
+}
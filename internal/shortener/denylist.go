@@ -0,0 +1,36 @@
+package shortener
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+// checkDenylist returns an error if the link can send its visitors to one of the denied hosts or their subdomains.
+//
+// The denied hosts are read from the active config on each call, so that the changes of the denylist
+// apply without a restart. The links that already exist are not affected by the changes.
+func (h *handler) checkDenylist(link *links.Link) error {
+	denied := h.settings.Active().DeniedDestinations
+	if len(denied) == 0 {
+		return nil
+	}
+
+	for _, rawURL := range link.URLs() {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			// The URLs are validated before they are checked against the denylist.
+			continue
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		for _, d := range denied {
+			d = strings.TrimSuffix(strings.ToLower(d), ".")
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return fmt.Errorf("%w: the host of %q is denied", links.ErrDeniedDestination, rawURL)
+			}
+		}
+	}
+	return nil
+}
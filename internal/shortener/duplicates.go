@@ -0,0 +1,69 @@
+package shortener
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/asankov/shortener/internal/apis"
+	"github.com/asankov/shortener/internal/links"
+)
+
+func (h *handler) ReportDuplicateLinks(w http.ResponseWriter, r *http.Request) {
+	var (
+		groups    = make(map[string]*apis.DuplicateLinkGroup)
+		createdAt = make(map[string]time.Time)
+	)
+	err := h.db.ForEach(r.Context(), func(link *links.Link) error {
+		key := link.DestinationKey()
+		group, ok := groups[key]
+		if !ok {
+			url, err := links.NormalizeURL(link.URL)
+			if err != nil {
+				url = link.URL
+			}
+			group = &apis.DuplicateLinkGroup{Owner: link.Owner, URL: url}
+			groups[key] = group
+		}
+		group.Links = append(group.Links, link.ID)
+		createdAt[link.ID] = link.CreatedAt
+		return nil
+	})
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting all links", "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	res := apis.DuplicateLinksResponse{Groups: make([]apis.DuplicateLinkGroup, 0)}
+	for _, group := range groups {
+		if len(group.Links) < 2 {
+			continue
+		}
+		ids := group.Links
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := createdAt[ids[i]], createdAt[ids[j]]
+			if !a.Equal(b) {
+				return a.Before(b)
+			}
+			return ids[i] < ids[j]
+		})
+		res.Groups = append(res.Groups, *group)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool {
+		if len(res.Groups[i].Links) != len(res.Groups[j].Links) {
+			return len(res.Groups[i].Links) > len(res.Groups[j].Links)
+		}
+		if res.Groups[i].Owner != res.Groups[j].Owner {
+			return res.Groups[i].Owner < res.Groups[j].Owner
+		}
+		return res.Groups[i].URL < res.Groups[j].URL
+	})
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,93 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asankov/shortener/internal/version"
+)
+
+// healthChecker is implemented by the storages that can check whether they are reachable.
+type healthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// readinessCheck runs a check of the dependencies of the service and reuses its result for ttl.
+type readinessCheck struct {
+	check   func(ctx context.Context) error
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// run returns the result of the last check, or runs a new one if it is older than ttl.
+//
+// The concurrent callers wait for the same check, so the probes cannot overload the dependencies.
+func (c *readinessCheck) run() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.ttl {
+		return c.err
+	}
+
+	// The check is not tied to the request of the probe, so that its result can be reused by the next probes.
+	ctx, cancel := withTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	c.err = c.check(ctx)
+	c.checkedAt = time.Now()
+	return c.err
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// serveHealth responds with 200 OK as long as the process is able to serve requests.
+func (s *Shortener) serveHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, r, http.StatusOK, "ok")
+}
+
+// serveReadiness responds with 503 Service Unavailable while the Shortener is not ready to serve requests,
+// e.g. during the drain period of a shutdown or when the storage cannot be reached,
+// so that the load balancers stop sending requests to it.
+func (s *Shortener) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		s.writeHealth(w, r, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+	if s.readiness != nil {
+		if err := s.readiness.run(); err != nil {
+			s.logger.WarnContext(r.Context(), "storage is not reachable", "error", err)
+			s.writeHealth(w, r, http.StatusServiceUnavailable, "storage unavailable")
+			return
+		}
+	}
+	s.writeHealth(w, r, http.StatusOK, "ok")
+}
+
+func (s *Shortener) writeHealth(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(healthResponse{Status: message}); err != nil {
+		s.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+	}
+}
+
+// serveVersion responds with the build information of the service.
+func (s *Shortener) serveVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version.Get()); err != nil {
+		s.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
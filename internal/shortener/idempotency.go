@@ -0,0 +1,182 @@
+package shortener
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/asankov/shortener/internal/idempotency"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on the responses that are replayed from a previous request.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// defaultIdempotencyLease is the lease of the reserved keys if the storage writes are not limited.
+	defaultIdempotencyLease = time.Minute
+)
+
+// idempotent makes the requests with an Idempotency-Key header safe to retry.
+//
+// The response of the first request with a key is stored and replayed for the retries with the same key and body.
+// Retries with a different body get 422 and retries while the first request is still being processed get 409.
+// The key is reserved for a short lease while the first request is processed and for the whole TTL once its response is stored.
+// Responses with a 5xx status code are not stored, so that the request can be retried.
+func (h *handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "Error while reading request body", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := &idempotency.Record{
+			Key:         h.idempotencyScope(r) + key,
+			RequestHash: requestHash(r, body),
+			ExpiresAt:   now.Add(h.idempotencyLease()),
+		}
+		err = h.idempotency.ReserveIdempotencyKey(r.Context(), record)
+		if errors.Is(err, idempotency.ErrKeyInUse) {
+			if !h.replay(w, r, record) {
+				return
+			}
+			// The first request with the key released it or its lease expired in the meantime.
+			err = h.idempotency.ReserveIdempotencyKey(r.Context(), record)
+		}
+		if err != nil {
+			if errors.Is(err, idempotency.ErrKeyInUse) {
+				writeKeyInProgress(w)
+				return
+			}
+			h.logger.ErrorContext(r.Context(), "Error while reserving idempotency key", "error", err)
+			w.WriteHeader(storageErrorStatus(err))
+			return
+		}
+
+		// The outcome is stored even if the client has gone away in the meantime,
+		// so that its retry gets the response instead of a conflict.
+		ctx := detachedContext{r.Context()}
+
+		// The reservation is released if the response is not stored, e.g. because next panicked,
+		// so that the request can be retried right away.
+		saved := false
+		defer func() {
+			if saved {
+				return
+			}
+			if err := h.idempotency.DeleteIdempotencyRecord(ctx, record.Key); err != nil {
+				h.logger.WarnContext(ctx, "Error while deleting idempotency key", "key", key, "error", err)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, body: &bytes.Buffer{}}
+		next(rec, r)
+
+		if rec.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		record.StatusCode = rec.Status()
+		record.ContentType = rec.Header().Get("Content-Type")
+		record.Body = rec.body.Bytes()
+		record.ExpiresAt = time.Now().Add(h.idempotencyTTL)
+		saved = true
+		if err := h.idempotency.SaveIdempotencyRecord(ctx, record); err != nil {
+			h.logger.WarnContext(ctx, "Error while saving idempotent response", "key", key, "error", err)
+		}
+	}
+}
+
+// idempotencyLease returns how long a key stays reserved while its first request is being processed.
+// It is short, so that the key becomes free soon if the replica processing the request goes away.
+func (h *handler) idempotencyLease() time.Duration {
+	lease := h.idempotencyLeaseTTL
+	if lease <= 0 {
+		lease = defaultIdempotencyLease
+	}
+	if lease > h.idempotencyTTL {
+		return h.idempotencyTTL
+	}
+	return lease
+}
+
+// replay writes the stored response of the request that first used the key of the given record.
+// It returns true without writing anything if the key is free again, i.e. its record was deleted
+// or the lease of the request that reserved it expired.
+func (h *handler) replay(w http.ResponseWriter, r *http.Request, record *idempotency.Record) bool {
+	stored, err := h.idempotency.GetIdempotencyRecord(r.Context(), record.Key)
+	if err != nil {
+		if errors.Is(err, idempotency.ErrNotFound) {
+			return true
+		}
+		h.logger.ErrorContext(r.Context(), "Error while getting idempotency key", "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return false
+	}
+	if !stored.IsCompleted() && stored.IsExpired(time.Now()) {
+		return true
+	}
+
+	if stored.RequestHash != record.RequestHash {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte("Idempotency-Key is already used for a different request"))
+		return false
+	}
+	if !stored.IsCompleted() {
+		writeKeyInProgress(w)
+		return false
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+	return false
+}
+
+// writeKeyInProgress writes the response to a request whose key is reserved by a request that is still being processed.
+func writeKeyInProgress(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusConflict)
+	w.Write([]byte("A request with this Idempotency-Key is still being processed"))
+}
+
+// idempotencyScope returns the prefix of the keys of the request, so that different users
+// and different endpoints cannot see the responses of each other.
+func (h *handler) idempotencyScope(r *http.Request) string {
+	var owner string
+	if user := userFrom(r.Context()); user != nil {
+		owner = user.Email
+	}
+	return owner + " " + r.Method + " " + r.URL.Path + " "
+}
+
+// requestHash identifies the request by its query and body.
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.URL.RawQuery))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,179 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/asankov/shortener/internal/idempotency"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/metrics"
+	"github.com/asankov/shortener/internal/users"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// storageObserver records the calls to a storage backend.
+type storageObserver struct {
+	metrics *metrics.Metrics
+	backend string
+}
+
+// observe records a call to the given method that started at start and returned err.
+func (o storageObserver) observe(method string, start time.Time, err *error) {
+	o.metrics.ObserveStorageCall(o.backend, method, time.Since(start), isStorageFailure(*err))
+}
+
+// isStorageFailure returns false for the errors that are an expected outcome of a call, e.g. a link that does not exist.
+func isStorageFailure(err error) bool {
+	var batchErr *links.BatchError
+	switch {
+	case err == nil,
+		errors.Is(err, links.ErrLinkNotFound),
+		errors.Is(err, links.ErrLinkAlreadyExists),
+		errors.Is(err, links.ErrClickLimitReached),
+		errors.Is(err, users.ErrUserNotFound),
+		errors.Is(err, bcrypt.ErrMismatchedHashAndPassword),
+		errors.Is(err, idempotency.ErrNotFound),
+		errors.Is(err, idempotency.ErrKeyInUse),
+		errors.As(err, &batchErr):
+		return false
+	default:
+		return true
+	}
+}
+
+// instrumentedDatabase records the latency and the errors of the calls to a Database.
+type instrumentedDatabase struct {
+	db Database
+	storageObserver
+}
+
+func (d *instrumentedDatabase) GetByID(ctx context.Context, id string) (_ *links.Link, err error) {
+	defer d.observe("GetByID", time.Now(), &err)
+	return d.db.GetByID(ctx, id)
+}
+
+func (d *instrumentedDatabase) GetAll(ctx context.Context) (_ []*links.Link, err error) {
+	defer d.observe("GetAll", time.Now(), &err)
+	return d.db.GetAll(ctx)
+}
+
+func (d *instrumentedDatabase) ForEach(ctx context.Context, fn func(link *links.Link) error) (err error) {
+	defer d.observe("ForEach", time.Now(), &err)
+	return d.db.ForEach(ctx, fn)
+}
+
+func (d *instrumentedDatabase) GetByDestination(ctx context.Context, owner, url string) (_ []*links.Link, err error) {
+	defer d.observe("GetByDestination", time.Now(), &err)
+	return d.db.GetByDestination(ctx, owner, url)
+}
+
+func (d *instrumentedDatabase) Create(ctx context.Context, link *links.Link) (err error) {
+	defer d.observe("Create", time.Now(), &err)
+	return d.db.Create(ctx, link)
+}
+
+func (d *instrumentedDatabase) CreateBatch(ctx context.Context, batch []*links.Link) []error {
+	start := time.Now()
+	errs := d.db.CreateBatch(ctx, batch)
+
+	// The call is recorded as failed if any of the links failed for a reason other than a conflict.
+	var err error
+	for _, e := range errs {
+		if isStorageFailure(e) {
+			err = e
+			break
+		}
+	}
+	d.observe("CreateBatch", start, &err)
+	return errs
+}
+
+func (d *instrumentedDatabase) CreateAll(ctx context.Context, batch []*links.Link) (err error) {
+	defer d.observe("CreateAll", time.Now(), &err)
+	return d.db.CreateAll(ctx, batch)
+}
+
+func (d *instrumentedDatabase) Update(ctx context.Context, link *links.Link) (err error) {
+	defer d.observe("Update", time.Now(), &err)
+	return d.db.Update(ctx, link)
+}
+
+func (d *instrumentedDatabase) Delete(ctx context.Context, id string) (err error) {
+	defer d.observe("Delete", time.Now(), &err)
+	return d.db.Delete(ctx, id)
+}
+
+func (d *instrumentedDatabase) IncrementClicks(ctx context.Context, id string, click links.Click) (_ int, err error) {
+	defer d.observe("IncrementClicks", time.Now(), &err)
+	return d.db.IncrementClicks(ctx, id, click)
+}
+
+func (d *instrumentedDatabase) UpdateHealth(ctx context.Context, id string, health *links.Health) (err error) {
+	defer d.observe("UpdateHealth", time.Now(), &err)
+	return d.db.UpdateHealth(ctx, id, health)
+}
+
+// instrumentedIDGenerator records the latency and the errors of the calls to an IDGenerator.
+type instrumentedIDGenerator struct {
+	idGenerator IDGenerator
+	storageObserver
+}
+
+func (g *instrumentedIDGenerator) GenerateID(ctx context.Context) (_ string, err error) {
+	defer g.observe("GenerateID", time.Now(), &err)
+	return g.idGenerator.GenerateID(ctx)
+}
+
+// instrumentedUserService records the latency and the errors of the calls to a UserService.
+type instrumentedUserService struct {
+	userService UserService
+	storageObserver
+}
+
+func (s *instrumentedUserService) GetUser(ctx context.Context, email, password string) (_ *users.User, err error) {
+	defer s.observe("GetUser", time.Now(), &err)
+	return s.userService.GetUser(ctx, email, password)
+}
+
+func (s *instrumentedUserService) CreateUser(ctx context.Context, email, password string, roles []users.Role) (err error) {
+	defer s.observe("CreateUser", time.Now(), &err)
+	return s.userService.CreateUser(ctx, email, password, roles)
+}
+
+// instrumentedConfigService records the latency and the errors of the calls to a ConfigService.
+type instrumentedConfigService struct {
+	configService ConfigService
+	storageObserver
+}
+
+func (s *instrumentedConfigService) ShouldCreateInitialUser(ctx context.Context) (_ bool, err error) {
+	defer s.observe("ShouldCreateInitialUser", time.Now(), &err)
+	return s.configService.ShouldCreateInitialUser(ctx)
+}
+
+// instrumentedIdempotencyStore records the latency and the errors of the calls to an IdempotencyStore.
+type instrumentedIdempotencyStore struct {
+	store IdempotencyStore
+	storageObserver
+}
+
+func (s *instrumentedIdempotencyStore) GetIdempotencyRecord(ctx context.Context, key string) (_ *idempotency.Record, err error) {
+	defer s.observe("GetIdempotencyRecord", time.Now(), &err)
+	return s.store.GetIdempotencyRecord(ctx, key)
+}
+
+func (s *instrumentedIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, record *idempotency.Record) (err error) {
+	defer s.observe("ReserveIdempotencyKey", time.Now(), &err)
+	return s.store.ReserveIdempotencyKey(ctx, record)
+}
+
+func (s *instrumentedIdempotencyStore) SaveIdempotencyRecord(ctx context.Context, record *idempotency.Record) (err error) {
+	defer s.observe("SaveIdempotencyRecord", time.Now(), &err)
+	return s.store.SaveIdempotencyRecord(ctx, record)
+}
+
+func (s *instrumentedIdempotencyStore) DeleteIdempotencyRecord(ctx context.Context, key string) (err error) {
+	defer s.observe("DeleteIdempotencyRecord", time.Now(), &err)
+	return s.store.DeleteIdempotencyRecord(ctx, key)
+}
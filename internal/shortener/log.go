@@ -0,0 +1,78 @@
+package shortener
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// redacted replaces the values of the sensitive attributes and query parameters in the logs.
+const redacted = "[REDACTED]"
+
+// sensitiveNames are the parts of the names of the attributes and the query parameters whose values are not logged.
+var sensitiveNames = []string{"authorization", "password", "secret", "token"}
+
+// isSensitive returns whether the value of an attribute or a query parameter with the given name must not be logged.
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// newLogHandler creates a handler that writes the records with at least the given level to w,
+// in the given format, which is either "text" or "json".
+func newLogHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: scrubAttr,
+	}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// scrubAttr redacts the values of the sensitive attributes.
+func scrubAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSensitive(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// scrubQuery encodes the query with the values of the sensitive parameters redacted.
+func scrubQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range query[key] {
+			if isSensitive(key) {
+				value = redacted
+			}
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(value))
+		}
+	}
+	return b.String()
+}
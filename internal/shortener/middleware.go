@@ -1,14 +1,35 @@
 package shortener
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/asankov/shortener/internal/apis"
 	"github.com/asankov/shortener/internal/auth"
+	"github.com/asankov/shortener/internal/metrics"
+	"github.com/asankov/shortener/internal/tracing"
 	"github.com/asankov/shortener/internal/users"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+type contextKey string
+
+// userContextKey is the key of the authenticated user in the context of the requests.
+const userContextKey contextKey = "user"
+
+// userFrom returns the authenticated user of the request or nil if it is not authenticated.
+func userFrom(ctx context.Context) *users.User {
+	user, _ := ctx.Value(userContextKey).(*users.User)
+	return user
+}
+
 func (h *handler) authenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -22,6 +43,7 @@ func (h *handler) authenticated(next http.Handler) http.Handler {
 
 		jwtToken := r.Header.Get("Authorization")
 		if jwtToken == "" {
+			h.metrics.ObserveAuthFailure(metrics.AuthMissingToken)
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write([]byte("Authorization header not provided"))
 			return
@@ -31,16 +53,18 @@ func (h *handler) authenticated(next http.Handler) http.Handler {
 		if err != nil {
 			if errors.Is(err, auth.ErrTokenExpired) {
 				// TODO: return body that indicates that the UI should try to get a new token
+				h.metrics.ObserveAuthFailure(metrics.AuthExpiredToken)
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
 			if errors.Is(err, auth.ErrInvalidSignature) || errors.Is(err, auth.ErrInvalidFormat) {
+				h.metrics.ObserveAuthFailure(metrics.AuthInvalidToken)
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
 
 			w.WriteHeader(http.StatusInternalServerError)
-			h.logger.Warn("unknown error while decoding token", "error", err)
+			h.logger.WarnContext(ctx, "unknown error while decoding token", "error", err)
 			return
 		}
 
@@ -52,12 +76,119 @@ func (h *handler) authenticated(next http.Handler) http.Handler {
 			}
 
 			if user.HasRole(role) {
-				next.ServeHTTP(w, r)
+				setAccessLogUser(ctx, user.Email)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userContextKey, user)))
 				return
 			}
 		}
 
+		h.metrics.ObserveAuthFailure(metrics.AuthInsufficientRole)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	})
 }
+
+// instrumented records the requests to the routes by operation, which is the method and the path template of the route,
+// e.g. GET /api/v1/links/{linkId}.
+func (h *handler) instrumented(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		h.metrics.ObserveRequest(operationOf(r), rec.Status(), time.Since(start))
+	})
+}
+
+// traced starts a span for each request, as a child of the span in its traceparent header, if there is one.
+func (h *handler) traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		operation := operationOf(r)
+		ctx, span := h.tracer.Start(ctx, operation,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+		setAccessLogSpan(ctx, span)
+		if route := routeOf(r); route != "" {
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// operationOf returns the method and the path template of the route that matched the request.
+func operationOf(r *http.Request) string {
+	route := routeOf(r)
+	if route == "" {
+		return "unknown"
+	}
+	return r.Method + " " + route
+}
+
+// routeOf returns the path template of the route that matched the request, or an empty string if none did.
+func routeOf(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return template
+}
+
+// responseRecorder passes the response through to the client and keeps its status code, its size and, optionally, a copy of its body.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int
+	// body keeps a copy of the body of the response, if it is not nil.
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	if r.body != nil {
+		r.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// Status returns the status code of the response, which is 200 if the handler did not write anything.
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Bytes returns the number of bytes of the body of the response that were written.
+func (r *responseRecorder) Bytes() int {
+	return r.bytes
+}
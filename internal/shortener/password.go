@@ -0,0 +1,220 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+// accessCookie is the name of the cookie that proves that the visitor entered the password of a link.
+// It is scoped to the path of the link, so each link has its own.
+const accessCookie = "shortener_access"
+
+type passwordPrompt struct {
+	LinkID string
+	Return string
+	Error  string
+}
+
+func (h *handler) UnlockLink(w http.ResponseWriter, r *http.Request, linkID string) {
+	link, err := h.db.GetByID(r.Context(), linkID)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.WarnContext(r.Context(), "unknown error while getting link by id", "link_id", linkID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	if !link.IsProtected() {
+		// There is nothing to unlock, so the request is a visit of the link, e.g. one that preserves the method with 307.
+		h.metrics.ObserveRedirect(true)
+		h.visit(w, r, link, "")
+		return
+	}
+
+	returnTo := r.PostFormValue("return")
+	// Only return to the link itself, so that the form cannot be used as an open redirect.
+	if returnTo != "/"+linkID && !strings.HasPrefix(returnTo, "/"+linkID+"/") && !strings.HasPrefix(returnTo, "/"+linkID+"?") {
+		returnTo = "/" + linkID
+	}
+
+	// The attempts are limited per client and per link, so that a client that changes its address
+	// cannot submit more wrong passwords than the limit of the link.
+	client := r.RemoteAddr
+	if ip, err := h.clientIP(r); err == nil {
+		client = ip.String()
+	}
+	attemptsKey := linkID + "|" + client
+	retryAfter := h.passwordAttempts.retryAfter(attemptsKey)
+	if linkRetryAfter := h.linkPasswordAttempts.retryAfter(linkID); linkRetryAfter > retryAfter {
+		retryAfter = linkRetryAfter
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		h.renderPasswordPrompt(w, r, http.StatusTooManyRequests, passwordPrompt{
+			LinkID: linkID,
+			Return: returnTo,
+			Error:  "Too many attempts. Please try again later.",
+		})
+		return
+	}
+
+	if !link.CheckPassword(r.PostFormValue("password")) {
+		h.passwordAttempts.fail(attemptsKey)
+		h.linkPasswordAttempts.fail(linkID)
+		h.renderPasswordPrompt(w, r, http.StatusUnauthorized, passwordPrompt{
+			LinkID: linkID,
+			Return: returnTo,
+			Error:  "Wrong password.",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(h.accessTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookie,
+		Value:    h.accessToken(link, expiresAt),
+		Path:     "/" + linkID,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+// hasAccess returns true if the visitor has a valid access cookie for the link.
+func (h *handler) hasAccess(r *http.Request, link *links.Link) bool {
+	cookie, err := r.Cookie(accessCookie)
+	if err != nil {
+		return false
+	}
+
+	expires, _, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return false
+	}
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+	if time.Now().After(expiresAt) {
+		return false
+	}
+
+	return hmac.Equal([]byte(cookie.Value), []byte(h.accessToken(link, expiresAt)))
+}
+
+// accessToken returns a token, that grants access to the link until expiresAt.
+//
+// The token is signed with the secret of the service and is bound to the current password of the link,
+// so changing the password revokes all tokens.
+func (h *handler) accessToken(link *links.Link, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	mac := hmac.New(sha256.New, h.secret)
+	fmt.Fprintf(mac, "%s|%s|", link.ID, expires)
+	mac.Write(link.PasswordHash)
+
+	return expires + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *handler) servePasswordPrompt(w http.ResponseWriter, r *http.Request, link *links.Link) {
+	h.renderPasswordPrompt(w, r, http.StatusUnauthorized, passwordPrompt{
+		LinkID: link.ID,
+		Return: r.URL.RequestURI(),
+	})
+}
+
+func (h *handler) renderPasswordPrompt(w http.ResponseWriter, r *http.Request, status int, prompt passwordPrompt) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "password.html", prompt); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while rendering password prompt", "link_id", prompt.LinkID, "error", err)
+	}
+}
+
+// attemptLimiter limits the number of failed attempts per key in a time window.
+type attemptLimiter struct {
+	max    int
+	window time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*attempts
+}
+
+type attempts struct {
+	count int
+	start time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		attempts: make(map[string]*attempts),
+	}
+}
+
+// setLimits changes the number of failed attempts that are allowed per key in the time window.
+func (l *attemptLimiter) setLimits(max int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.max = max
+	l.window = window
+}
+
+// retryAfter returns how long the given key has to wait before trying again, or 0 if it can try now.
+func (l *attemptLimiter) retryAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok {
+		return 0
+	}
+	if elapsed := time.Since(a.start); elapsed >= l.window {
+		delete(l.attempts, key)
+		return 0
+	} else if a.count >= l.max {
+		return l.window - elapsed
+	}
+	return 0
+}
+
+// fail records a failed attempt for the given key.
+func (l *attemptLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, a := range l.attempts {
+		if now.Sub(a.start) >= l.window {
+			delete(l.attempts, k)
+		}
+	}
+
+	a, ok := l.attempts[key]
+	if !ok {
+		a = &attempts{start: now}
+		l.attempts[key] = a
+	}
+	a.count++
+}
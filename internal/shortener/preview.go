@@ -0,0 +1,83 @@
+package shortener
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+type preview struct {
+	LinkID      string
+	Destination string
+	// Alternatives are the other destinations some of the visitors are sent to, by targeting rules or traffic split.
+	Alternatives []string
+	Owner        string
+	CreatedAt    time.Time
+	State        links.State
+	Health       *links.Health
+}
+
+type interstitial struct {
+	URL     string
+	Seconds int
+}
+
+// servePreview serves a page that shows where the link goes, without following it.
+func (h *handler) servePreview(w http.ResponseWriter, r *http.Request, linkID string) {
+	link, err := h.db.GetByID(r.Context(), linkID)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.WarnContext(r.Context(), "unknown error while getting link by id", "link_id", linkID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	// The destination of a protected link is not disclosed to visitors that do not know the password.
+	// The visitor returns to the preview with the query parameter, as the access cookie is not sent for /{linkId}+.
+	if link.IsProtected() && !h.hasAccess(r, link) {
+		h.renderPasswordPrompt(w, r, http.StatusUnauthorized, passwordPrompt{
+			LinkID: link.ID,
+			Return: "/" + link.ID + "?preview=1",
+		})
+		return
+	}
+
+	page := preview{
+		LinkID:      link.ID,
+		Destination: link.URL,
+		Owner:       link.Owner,
+		CreatedAt:   link.CreatedAt,
+		State:       link.State(time.Now()),
+		Health:      link.Health,
+	}
+	for _, rule := range link.Targeting {
+		page.Alternatives = append(page.Alternatives, rule.URL)
+	}
+	for _, d := range link.Destinations {
+		page.Alternatives = append(page.Alternatives, d.URL)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "preview.html", page); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while rendering preview page", "link_id", link.ID, "error", err)
+	}
+}
+
+// serveInterstitial serves a page that shows the destination and redirects to it after a countdown.
+func (h *handler) serveInterstitial(w http.ResponseWriter, r *http.Request, link *links.Link, destination string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "interstitial.html", interstitial{
+		URL:     destination,
+		Seconds: int(h.interstitialDelay.Seconds()),
+	}); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while rendering interstitial page", "link_id", link.ID, "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package shortener
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/asankov/shortener/internal/apis"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/qr"
+)
+
+// qrQueryParam marks the visits that come from scanning a tracked QR code.
+// It is removed from the query before it is passed to the destination.
+const qrQueryParam = "qr"
+
+func (h *handler) GetLinkQrCode(w http.ResponseWriter, r *http.Request, linkID string, params apis.GetLinkQrCodeParams) {
+	link, err := h.db.GetByID(r.Context(), linkID)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.WarnContext(r.Context(), "unknown error while getting link by id", "link_id", linkID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	options, err := h.qrOptionsFrom(params)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Invalid QR code options", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	content := h.shortURL(r, link.ID)
+	if params.Track != nil && *params.Track {
+		content += "?" + qrQueryParam + "=1"
+	}
+
+	code, err := qr.New(content, options)
+	if err != nil {
+		if errors.Is(err, qr.ErrInvalidOptions) {
+			h.logger.ErrorContext(r.Context(), "Invalid QR code options", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		h.logger.ErrorContext(r.Context(), "error while generating QR code", "link_id", linkID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		buf         bytes.Buffer
+		contentType string
+	)
+	format := apis.QRFormatPNG
+	if params.Format != nil {
+		format = *params.Format
+	}
+	switch format {
+	case apis.QRFormatPNG:
+		contentType = "image/png"
+		err = code.PNG(&buf)
+	case apis.QRFormatSVG:
+		contentType = "image/svg+xml"
+		err = code.SVG(&buf)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while rendering QR code", "link_id", linkID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := buf.WriteTo(w); err != nil {
+		h.logger.WarnContext(r.Context(), "error while writing QR code", "link_id", linkID, "error", err)
+	}
+}
+
+// qrOptionsFrom converts the API query parameters to qr.Options.
+func (h *handler) qrOptionsFrom(params apis.GetLinkQrCodeParams) (qr.Options, error) {
+	options := qr.Options{Margin: qr.DefaultMargin}
+	if params.Size != nil {
+		options.Size = *params.Size
+	}
+	if params.Margin != nil {
+		options.Margin = *params.Margin
+	}
+	if params.Level != nil {
+		level, err := qr.LevelFrom(string(*params.Level))
+		if err != nil {
+			return qr.Options{}, err
+		}
+		options.Level = level
+	}
+	if params.Foreground != nil {
+		foreground, err := qr.ParseColor(*params.Foreground)
+		if err != nil {
+			return qr.Options{}, err
+		}
+		options.Foreground = foreground
+	}
+	if params.Background != nil {
+		background, err := qr.ParseColor(*params.Background)
+		if err != nil {
+			return qr.Options{}, err
+		}
+		options.Background = background
+	}
+	if params.Logo != nil && *params.Logo {
+		if h.qrLogo == nil {
+			return qr.Options{}, fmt.Errorf("%w: no logo is configured", qr.ErrInvalidOptions)
+		}
+		options.Logo = h.qrLogo
+	}
+	return options, nil
+}
+
+// shortURL returns the absolute URL of the link with the given ID.
+func (h *handler) shortURL(r *http.Request, linkID string) string {
+	if h.publicURL != "" {
+		return strings.TrimSuffix(h.publicURL, "/") + "/" + linkID
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + linkID
+}
+
+// loadImage reads a PNG or JPEG image from the given path.
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
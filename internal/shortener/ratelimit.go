@@ -0,0 +1,109 @@
+package shortener
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asankov/shortener/internal/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// anyOperation is the operation of the rate limits that apply to the routes without limits of their own.
+const anyOperation = "*"
+
+// bucket identifies the token bucket that a request takes a token from, e.g. the one of its client IP address.
+type bucket struct {
+	// key is what the requests are counted by, e.g. ip.
+	key string
+	// id is the value of the key of the request, e.g. its client IP address.
+	id     string
+	limits map[string]ratelimit.Limit
+}
+
+// clientRateLimited rejects the requests whose client IP address or link have exceeded their rate limits.
+//
+// It runs before the requests are authenticated, so that the failed attempts to authenticate are limited as well.
+func (h *handler) clientRateLimited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := h.settings.Active()
+
+		// The requests whose remote address is not an IP address, e.g. of a Unix socket, are counted by it as it is.
+		client := r.RemoteAddr
+		if ip, err := h.clientIP(r); err == nil {
+			client = ip.String()
+		}
+		buckets := []bucket{{key: "ip", id: client, limits: settings.RateLimitsPerIP}}
+		if linkID := mux.Vars(r)["linkId"]; linkID != "" {
+			buckets = append(buckets, bucket{key: "link", id: linkID, limits: settings.RateLimitsPerLink})
+		}
+
+		if h.allow(w, r, buckets...) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// userRateLimited rejects the requests whose authenticated user has exceeded its rate limits.
+func (h *handler) userRateLimited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := userFrom(r.Context()); user != nil {
+			limits := h.settings.Active().RateLimitsPerUser
+			if !h.allow(w, r, bucket{key: "user", id: user.Email, limits: limits}) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from each of the given buckets that has a limit for the operation of the request.
+//
+// It returns false, after responding with 429 Too Many Requests, if one of the buckets is empty.
+// If the rate limiter fails, the request is allowed, so that the service keeps working without it.
+func (h *handler) allow(w http.ResponseWriter, r *http.Request, buckets ...bucket) bool {
+	operation := operationOf(r)
+	for _, b := range buckets {
+		limit, ok := b.limits[operation]
+		if !ok {
+			if limit, ok = b.limits[anyOperation]; !ok {
+				continue
+			}
+		}
+
+		result, err := h.rateLimiter.Allow(r.Context(), b.key+":"+operation+":"+b.id, limit)
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "error while checking rate limit, the request is allowed", "key", b.key, "error", err)
+			continue
+		}
+
+		setRateLimitHeaders(w.Header(), limit, result)
+		if !result.Allowed {
+			h.metrics.ObserveRateLimited(operation, b.key)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return false
+		}
+	}
+	return true
+}
+
+// setRateLimitHeaders sets the RateLimit headers of the IETF draft to the state of the given bucket,
+// unless they are already set to a bucket with fewer remaining requests.
+func setRateLimitHeaders(header http.Header, limit ratelimit.Limit, result ratelimit.Result) {
+	if remaining, err := strconv.Atoi(header.Get("RateLimit-Remaining")); err == nil && remaining <= result.Remaining {
+		return
+	}
+
+	header.Set("RateLimit-Limit", strconv.Itoa(limit.Count))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Count, seconds(limit.Period)))
+}
+
+// seconds returns d in whole seconds, rounded up, so that the clients that wait for it do not retry too early.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
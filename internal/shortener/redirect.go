@@ -0,0 +1,26 @@
+package shortener
+
+import (
+	"net/http"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+// redirect sends the visitor to the given destination in the way configured for the link.
+func (h *handler) redirect(w http.ResponseWriter, r *http.Request, link *links.Link, destination string) {
+	if link.Interstitial || h.alwaysInterstitial {
+		h.serveInterstitial(w, r, link, destination)
+		return
+	}
+
+	if link.RedirectType != links.RedirectMetaRefresh {
+		http.Redirect(w, r, destination, link.RedirectType.StatusCode())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := templates.ExecuteTemplate(w, "redirect.html", struct{ URL string }{URL: destination}); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while rendering redirect page", "link_id", link.ID, "error", err)
+	}
+}
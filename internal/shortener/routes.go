@@ -1,141 +1,514 @@
 package shortener
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/asankov/shortener/internal/apis"
 	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/metrics"
+	"github.com/asankov/shortener/internal/users"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (s *Shortener) routes() http.Handler {
-	return apis.HandlerWithOptions(s.handler, apis.GorillaServerOptions{
-		Middlewares: []apis.MiddlewareFunc{
-			s.handler.authenticated,
-		},
+	// The middlewares are applied in order, so the last one runs first.
+	middlewares := []apis.MiddlewareFunc{
+		s.handler.userRateLimited,
+		s.handler.authenticated,
+		s.handler.clientRateLimited,
+		s.handler.traced,
+	}
+
+	r := mux.NewRouter()
+	r.Use(s.handler.instrumented)
+	if s.config.AccessLogEnabled {
+		r.Use(s.handler.accessLogged)
+	}
+
+	// The operational routes are registered before the API routes, because /{linkId} would match them as well.
+	// Their paths are reserved, so that no link can be shadowed by them.
+	r.HandleFunc("/healthz", s.serveHealth).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", s.serveReadiness).Methods(http.MethodGet)
+	r.HandleFunc("/version", s.serveVersion).Methods(http.MethodGet)
+
+	// The preview route is registered before the API routes,
+	// because /{linkId} would match it as well.
+	r.Handle("/{linkId}"+links.PreviewSuffix, withMiddlewares(http.HandlerFunc(s.handler.PreviewLink), middlewares)).Methods(http.MethodGet)
+
+	apis.HandlerWithOptions(s.handler, apis.GorillaServerOptions{
+		BaseRouter:  r,
+		Middlewares: middlewares,
 	})
+
+	// The path passthrough route is not part of the OpenAPI spec,
+	// because path parameters there cannot contain slashes.
+	// It is registered last, so that it does not shadow any of the API routes.
+	r.Handle("/{linkId}/{path:.*}", withMiddlewares(http.HandlerFunc(s.handler.GetLinkByIdWithPath), middlewares)).Methods(http.MethodGet)
+
+	return r
+}
+
+// withMiddlewares wraps the handler in the middlewares, in the same way as the API routes are.
+func withMiddlewares(handler http.Handler, middlewares []apis.MiddlewareFunc) http.Handler {
+	for _, middleware := range middlewares {
+		handler = middleware(handler)
+	}
+	return handler
 }
 
 func (h *handler) GetLinkById(w http.ResponseWriter, r *http.Request, linkId string) {
-	link, err := h.db.GetByID(linkId)
+	if r.URL.Query().Get("preview") == "1" {
+		h.servePreview(w, r, linkId)
+		return
+	}
+
+	h.serveLink(w, r, linkId, "")
+}
+
+// GetLinkByIdWithPath serves /{linkId}/{path} for links with path passthrough.
+func (h *handler) GetLinkByIdWithPath(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.serveLink(w, r, vars["linkId"], vars["path"])
+}
+
+// PreviewLink serves /{linkId}+, the preview page of the link.
+func (h *handler) PreviewLink(w http.ResponseWriter, r *http.Request) {
+	h.servePreview(w, r, mux.Vars(r)["linkId"])
+}
+
+func (h *handler) serveLink(w http.ResponseWriter, r *http.Request, linkId, path string) {
+	link, err := h.db.GetByID(r.Context(), linkId)
 	if err != nil {
 		if errors.Is(err, links.ErrLinkNotFound) {
+			h.metrics.ObserveRedirect(false)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.WarnContext(r.Context(), "unknown error while getting link by id", "link_id", linkId, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+	h.metrics.ObserveRedirect(true)
+	h.visit(w, r, link, path)
+}
+
+// visit counts the visit of the link and redirects the visitor to its destination,
+// unless the link cannot be visited at this time, e.g. because it is protected with a password.
+func (h *handler) visit(w http.ResponseWriter, r *http.Request, link *links.Link, path string) {
+	if link.IsExhausted() {
+		h.exhausted(w, r, link)
+		return
+	}
+
+	if now := time.Now(); !link.Schedule.State(now).IsActive() {
+		h.serveInactive(w, r, link, now)
+		return
+	}
+
+	if link.IsProtected() && !h.hasAccess(r, link) {
+		h.servePasswordPrompt(w, r, link)
+		return
+	}
+
+	target, click := h.chooseDestination(w, r, link)
+
+	query := r.URL.Query()
+	if query.Get(qrQueryParam) == "1" {
+		click.QR = true
+		query.Del(qrQueryParam)
+	}
+
+	destination, err := link.Passthrough.Apply(target, path, query)
+	if err != nil {
+		if errors.Is(err, links.ErrPathNotAllowed) {
 			w.WriteHeader(http.StatusNotFound)
+			return
 		}
 
-		h.logger.Warn("unknown error while getting link by id", "link_id", linkId, "error", err)
+		h.logger.WarnContext(r.Context(), "error while building destination", "link_id", link.ID, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.db.IncrementClicks(linkId); err != nil {
-		h.logger.Warn("error while incrementing number of clicks", "link_id", linkId, "error", err)
+	clicks, err := h.db.IncrementClicks(r.Context(), link.ID, click)
+	switch {
+	case errors.Is(err, links.ErrClickLimitReached):
+		// Another visitor consumed the last click after the link was read.
+		h.exhausted(w, r, link)
+		return
+	case err != nil && link.MaxClicks > 0:
+		// The click of a limited link must be counted before the visitor is let through.
+		if errors.Is(err, links.ErrLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.WarnContext(r.Context(), "error while incrementing number of clicks", "link_id", link.ID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	case err != nil:
+		h.logger.WarnContext(r.Context(), "error while incrementing number of clicks", "link_id", link.ID, "error", err)
+	case link.MaxClicks > 0 && clicks >= link.MaxClicks && link.DeleteWhenExhausted:
+		h.deleteExhausted(r.Context(), link)
 	}
 
-	http.Redirect(w, r, link.URL, http.StatusFound)
+	h.redirect(w, r, link, destination)
+}
+
+// exhausted responds to a visit of a link that has reached its maximum number of clicks.
+func (h *handler) exhausted(w http.ResponseWriter, r *http.Request, link *links.Link) {
+	if link.DeleteWhenExhausted {
+		h.deleteExhausted(r.Context(), link)
+	}
+	w.WriteHeader(http.StatusGone)
+}
+
+func (h *handler) deleteExhausted(ctx context.Context, link *links.Link) {
+	if err := h.db.Delete(ctx, link.ID); err != nil {
+		h.logger.WarnContext(ctx, "error while deleting exhausted link", "link_id", link.ID, "error", err)
+	}
 }
 
 func (h *handler) LoginAdmin(w http.ResponseWriter, r *http.Request) {
 	var req apis.AdminLoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("error while decoding request body", "error", err)
+		h.logger.ErrorContext(r.Context(), "error while decoding request body", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	user, err := h.userService.GetUser(req.Username, req.Password)
+	user, err := h.userService.GetUser(r.Context(), req.Username, req.Password)
 	if err != nil {
-		h.logger.Error("error while getting user", "error", err, "username", req.Username)
-		w.WriteHeader(http.StatusInternalServerError)
+		if errors.Is(err, users.ErrUserNotFound) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			h.metrics.ObserveAuthFailure(metrics.AuthInvalidCredentials)
+		}
+		h.logger.ErrorContext(r.Context(), "error while getting user", "error", err, "username", req.Username)
+		w.WriteHeader(storageErrorStatus(err))
 		return
 	}
 
 	token, err := h.authenticator.NewTokenForUser(user)
 	if err != nil {
-		h.logger.Error("error while generating token for user", "error", err, "username", req.Username)
+		h.logger.ErrorContext(r.Context(), "error while generating token for user", "error", err, "username", req.Username)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 
 	}
 
 	if err := json.NewEncoder(w).Encode(apis.AdminLoginResponse{Token: token}); err != nil {
-		h.logger.Error("error while encoding response", "error", err, "email", req.Username)
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err, "email", req.Username)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
-func (h *handler) CreateNewLink(w http.ResponseWriter, r *http.Request) {
-	var link apis.CreateShortLinkRequest
-	if err := json.NewDecoder(r.Body).Decode(&link); err != nil {
-		h.logger.Error("Error while decoding request body", "error", err)
+func (h *handler) CreateNewLink(w http.ResponseWriter, r *http.Request, _ apis.CreateNewLinkParams) {
+	// The Idempotency-Key header is handled by idempotent.
+	h.idempotent(h.createNewLink)(w, r)
+}
+
+func (h *handler) createNewLink(w http.ResponseWriter, r *http.Request) {
+	var req apis.CreateShortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorContext(r.Context(), "Error while decoding request body", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	if link.ID == nil {
-		id, err := h.idGenerator.GenerateID()
+	var owner string
+	if user := userFrom(r.Context()); user != nil {
+		owner = user.Email
+	}
+
+	// An existing link is reused only with the ID of the request, if one is requested.
+	anyID := req.ID == nil
+	if req.ID == nil {
+		id, err := h.idGenerator.GenerateID(r.Context())
 		if err != nil {
-			h.logger.Error("Error while generating ID", "error", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			h.logger.ErrorContext(r.Context(), "Error while generating ID", "error", err)
+			w.WriteHeader(storageErrorStatus(err))
 			return
 		}
-		link.ID = &id
+		req.ID = &id
 	}
 
-	if err := h.db.Create(*link.ID, link.URL); err != nil {
+	link, err := linkFromCreateRequest(&req)
+	if err == nil {
+		err = h.checkDenylist(link)
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Invalid link", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.ReuseExisting != nil && *req.ReuseExisting {
+		// The destination is the one of the built link, as it includes the UTM parameters of the request.
+		existing, err := h.db.GetByDestination(r.Context(), owner, link.URL)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "Error while getting links by destination", "error", err)
+			w.WriteHeader(storageErrorStatus(err))
+			return
+		}
+		var password string
+		if req.Password != nil {
+			password = *req.Password
+		}
+		if reused := reusableLink(existing, link, password, anyID); reused != nil {
+			if err := json.NewEncoder(w).Encode(createLinkResponse(reused)); err != nil {
+				h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	link.CreatedAt = time.Now().UTC()
+	link.Owner = owner
+
+	if err := h.db.Create(r.Context(), link); err != nil {
 		if errors.Is(err, links.ErrLinkAlreadyExists) {
 			w.WriteHeader(http.StatusConflict)
 			return
 		}
 
-		h.logger.Error("Error while creating link", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		h.logger.ErrorContext(r.Context(), "Error while creating link", "error", err)
+		w.WriteHeader(storageErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(apis.CreateShortLinkResponse{
-		ID:  *link.ID,
-		URL: link.URL,
-	}); err != nil {
-		h.logger.Error("error while encoding response", "error", err)
+	if err := json.NewEncoder(w).Encode(createLinkResponse(link)); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// reusableLink returns the oldest of the existing links that has the same settings as the requested link,
+// or nil if there is none, so that a link with e.g. a different redirect type or password is not returned instead of a new one.
+func reusableLink(existing []*links.Link, link *links.Link, password string, anyID bool) *links.Link {
+	for _, candidate := range existing {
+		if !anyID && candidate.ID != link.ID {
+			continue
+		}
+		if candidate.IsProtected() != (password != "") || (password != "" && !candidate.CheckPassword(password)) {
+			continue
+		}
+		if candidate.SameSettings(link) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func (h *handler) UpdateShortLink(w http.ResponseWriter, r *http.Request, linkID string) {
+	var req apis.UpdateShortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.ErrorContext(r.Context(), "Error while decoding request body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.db.GetByID(uncached(r.Context()), linkID)
+	if err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.WarnContext(r.Context(), "unknown error while getting link by id", "link_id", linkID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	err = applyUpdateRequest(link, &req)
+	// Only the changes of the destinations are checked, so that the other settings of the existing links
+	// that lead to hosts that have been denied since they were created can still be changed, e.g. to disable them.
+	if err == nil && (req.URL != nil || req.Utm != nil || req.Targeting != nil || req.Destinations != nil || req.Schedule != nil) {
+		err = h.checkDenylist(link)
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Invalid link", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.Update(r.Context(), link); err != nil {
+		if errors.Is(err, links.ErrLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.logger.ErrorContext(r.Context(), "Error while updating link", "link_id", linkID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(apis.UpdateShortLinkResponse(createLinkResponse(link))); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
 func (h *handler) GetLinkMetrics(w http.ResponseWriter, r *http.Request, linkID string) {
-	link, err := h.db.GetByID(linkID)
+	link, err := h.db.GetByID(uncached(r.Context()), linkID)
 	if err != nil {
 		if errors.Is(err, links.ErrLinkNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
-		h.logger.Warn("unknown error while getting link by id", "link_id", linkID, "error", err)
+		h.logger.WarnContext(r.Context(), "unknown error while getting link by id", "link_id", linkID, "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(linkMetricsResponse(link)); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *handler) ListLinks(w http.ResponseWriter, r *http.Request, params apis.ListLinksParams) {
+	all, err := h.db.GetAll(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting all links", "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	onlyBroken := params.Broken != nil && *params.Broken
+
+	res := apis.ListLinksResponse{Links: make([]apis.GetLinkMetricsResponse, 0, len(all))}
+	for _, link := range all {
+		if onlyBroken && !link.Health.IsBroken() {
+			continue
+		}
+		if params.Campaign != nil && link.Campaign() != *params.Campaign {
+			continue
+		}
+		if params.Tag != nil && !link.HasTag(*params.Tag) {
+			continue
+		}
+		res.Links = append(res.Links, linkMetricsResponse(link))
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+}
+
+func (h *handler) AggregateLinkMetrics(w http.ResponseWriter, r *http.Request, params apis.AggregateLinkMetricsParams) {
+	var keysOf func(link *links.Link) []string
+	switch params.GroupBy {
+	case apis.GroupByCampaign:
+		keysOf = func(link *links.Link) []string {
+			if campaign := link.Campaign(); campaign != "" {
+				return []string{campaign}
+			}
+			return nil
+		}
+	case apis.GroupByTag:
+		keysOf = func(link *links.Link) []string {
+			return link.Tags
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-	if err := json.NewEncoder(w).Encode(apis.GetLinkMetricsResponse{
-		ID:  link.ID,
-		URL: link.URL,
-		Metrics: apis.LinkMetrics{
-			Clicks: link.Metrics.Clicks,
-		},
-	}); err != nil {
-		h.logger.Error("error while encoding response", "error", err)
+	all, err := h.db.GetAll(r.Context())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting all links", "error", err)
+		w.WriteHeader(storageErrorStatus(err))
+		return
+	}
+
+	groups := make(map[string]*apis.LinkMetricsGroup)
+	for _, link := range all {
+		for _, key := range keysOf(link) {
+			group, ok := groups[key]
+			if !ok {
+				group = &apis.LinkMetricsGroup{Key: key}
+				groups[key] = group
+			}
+			group.Links++
+			if link.Metrics != nil {
+				group.Metrics.Clicks += link.Metrics.Clicks
+				group.Metrics.QRScans += link.Metrics.QRScans
+			}
+		}
+	}
+
+	res := apis.AggregateLinkMetricsResponse{Groups: make([]apis.LinkMetricsGroup, 0, len(groups))}
+	for _, group := range groups {
+		res.Groups = append(res.Groups, *group)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool {
+		if res.Groups[i].Metrics.Clicks != res.Groups[j].Metrics.Clicks {
+			return res.Groups[i].Metrics.Clicks > res.Groups[j].Metrics.Clicks
+		}
+		return res.Groups[i].Key < res.Groups[j].Key
+	})
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+func linkMetricsResponse(link *links.Link) apis.GetLinkMetricsResponse {
+	res := apis.GetLinkMetricsResponse{
+		ID:    link.ID,
+		URL:   link.URL,
+		Utm:   utmResponse(link.UTM),
+		Tags:  tagsResponse(link.Tags),
+		State: apis.LinkState(link.State(time.Now())),
+	}
+	if link.Metrics != nil {
+		res.Metrics.Clicks = link.Metrics.Clicks
+		res.Metrics.QRScans = link.Metrics.QRScans
+		if len(link.Metrics.Variants) > 0 {
+			res.Metrics.Variants = &link.Metrics.Variants
+		}
+	}
+	if remaining := link.RemainingClicks(); remaining >= 0 {
+		res.Metrics.RemainingClicks = &remaining
+	}
+	if link.Health != nil {
+		res.Health = &apis.LinkHealth{
+			Broken:     link.Health.IsBroken(),
+			StatusCode: link.Health.StatusCode,
+			LatencyMs:  link.Health.Latency.Milliseconds(),
+			CheckedAt:  link.Health.CheckedAt,
+		}
+		if link.Health.Error != "" {
+			res.Health.Error = &link.Health.Error
+		}
+		if len(link.Health.RedirectChain) > 0 {
+			res.Health.RedirectChain = &link.Health.RedirectChain
+		}
+	}
+	return res
+}
+
 func (h *handler) DeleteShortLink(w http.ResponseWriter, r *http.Request, linkID string) {
-	if err := h.db.Delete(linkID); err != nil {
-		h.logger.Error("Error while deleting link", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := h.db.Delete(r.Context(), linkID); err != nil {
+		h.logger.ErrorContext(r.Context(), "Error while deleting link", "error", err)
+		w.WriteHeader(storageErrorStatus(err))
 		return
 	}
 
@@ -0,0 +1,1961 @@
+package shortener_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/asankov/shortener/internal/apis"
+	"github.com/asankov/shortener/internal/auth"
+	"github.com/asankov/shortener/internal/cache"
+	"github.com/asankov/shortener/internal/config"
+	"github.com/asankov/shortener/internal/idempotency"
+	"github.com/asankov/shortener/internal/inmemory"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/ratelimit"
+	"github.com/asankov/shortener/internal/shortener"
+	"github.com/asankov/shortener/internal/tracing"
+	"github.com/asankov/shortener/internal/users"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const secret = "abc123-secret"
+
+var admin = &users.User{
+	Email: "admin@asankov.dev",
+	Roles: []users.Role{users.RoleAdmin},
+}
+
+type testShortener struct {
+	shortener *shortener.Shortener
+	handler   http.Handler
+	admin     http.Handler
+	db        *inmemory.DB
+	token     string
+}
+
+func newTestShortener(t *testing.T, configure ...func(*config.Config)) *testShortener {
+	t.Helper()
+
+	t.Setenv("SHORTENER_SECRET", secret)
+	t.Setenv("SHORTENER_USE_IN_MEMORY_DB", "true")
+	config, err := config.NewFromEnv()
+	require.NoError(t, err)
+	for _, c := range configure {
+		c(config)
+	}
+
+	db := inmemory.NewDB()
+	authenticator := auth.NewAutheniticator(secret)
+	s, err := shortener.New(config, db, db, db, authenticator, db, db)
+	require.NoError(t, err)
+	s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	token, err := authenticator.NewTokenForUser(admin)
+	require.NoError(t, err)
+
+	return &testShortener{
+		shortener: s,
+		handler:   s.Handler(),
+		admin:     s.AdminHandler(),
+		db:        db,
+		token:     token,
+	}
+}
+
+func (ts *testShortener) do(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var b bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&b).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &b)
+	req.Header.Set("Authorization", ts.token)
+
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRedirectType(t *testing.T) {
+	ts := newTestShortener(t)
+
+	testCases := []struct {
+		redirectType string
+		statusCode   int
+	}{
+		{redirectType: "301", statusCode: http.StatusMovedPermanently},
+		{redirectType: "302", statusCode: http.StatusFound},
+		{redirectType: "307", statusCode: http.StatusTemporaryRedirect},
+		{redirectType: "308", statusCode: http.StatusPermanentRedirect},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.redirectType, func(t *testing.T) {
+			id := "link" + testCase.redirectType
+			rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+				"id":            id,
+				"url":           "https://asankov.dev",
+				"redirect_type": testCase.redirectType,
+			})
+			require.Equal(t, http.StatusCreated, rec.Code)
+
+			rec = ts.do(t, http.MethodGet, "/"+id, nil)
+			require.Equal(t, testCase.statusCode, rec.Code)
+			require.Equal(t, "https://asankov.dev", rec.Header().Get("Location"))
+		})
+	}
+
+	t.Run("TestPost", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/link307", nil)
+		require.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+		require.Equal(t, "https://asankov.dev", rec.Header().Get("Location"))
+
+		rec = ts.do(t, http.MethodPost, "/unknown", nil)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("TestMetaRefresh", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":            "meta",
+			"url":           "https://asankov.dev",
+			"redirect_type": "meta-refresh",
+		})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = ts.do(t, http.MethodGet, "/meta", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `http-equiv="refresh"`)
+		require.Contains(t, rec.Body.String(), "https://asankov.dev")
+	})
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"url":           "https://asankov.dev",
+			"redirect_type": "303",
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("TestUpdate", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPatch, "/api/v1/links/link302", map[string]any{
+			"redirect_type": "308",
+		})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		link, err := ts.db.GetByID(context.Background(), "link302")
+		require.NoError(t, err)
+		require.Equal(t, links.RedirectPermanent, link.RedirectType)
+		require.Equal(t, "https://asankov.dev", link.URL)
+
+		rec = ts.do(t, http.MethodPatch, "/api/v1/links/unknown", map[string]any{
+			"redirect_type": "308",
+		})
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("TestUnsafeURL", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":  "unsafe",
+			"url": "javascript://x/%0aalert(1)",
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = ts.do(t, http.MethodPatch, "/api/v1/links/link301", map[string]any{
+			"url": "javascript://x/%0aalert(1)",
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		link, err := ts.db.GetByID(context.Background(), "link301")
+		require.NoError(t, err)
+		require.Equal(t, "https://asankov.dev", link.URL)
+	})
+}
+
+func TestPassthrough(t *testing.T) {
+	ts := newTestShortener(t)
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "docs",
+		"url": "https://asankov.dev/docs?lang=en",
+		"passthrough": map[string]any{
+			"query": true,
+			"path":  true,
+		},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = ts.do(t, http.MethodGet, "/docs/getting-started/install?lang=bg&utm_source=x", nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Equal(t, "https://asankov.dev/docs/getting-started/install?lang=bg&utm_source=x", rec.Header().Get("Location"))
+
+	rec = ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "plain",
+		"url": "https://asankov.dev",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = ts.do(t, http.MethodGet, "/plain/extra", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = ts.do(t, http.MethodGet, "/plain?utm_source=x", nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Equal(t, "https://asankov.dev", rec.Header().Get("Location"))
+}
+
+func TestCampaigns(t *testing.T) {
+	ts := newTestShortener(t)
+
+	for _, link := range []map[string]any{
+		{"id": "a", "url": "https://asankov.dev/a", "utm": map[string]any{"source": "newsletter", "campaign": "spring"}, "tags": []string{"email"}},
+		{"id": "b", "url": "https://asankov.dev/b", "utm": map[string]any{"source": "twitter", "campaign": "spring"}, "tags": []string{"social"}},
+		{"id": "c", "url": "https://asankov.dev/c", "tags": []string{"email", "social"}},
+	} {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", link)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec := ts.do(t, http.MethodGet, "/a", nil)
+	require.Equal(t, "https://asankov.dev/a?utm_campaign=spring&utm_source=newsletter", rec.Header().Get("Location"))
+	ts.do(t, http.MethodGet, "/b", nil)
+	ts.do(t, http.MethodGet, "/c", nil)
+	ts.do(t, http.MethodGet, "/c", nil)
+
+	t.Run("TestList", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links?campaign=spring&tag=email", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.ListLinksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Len(t, res.Links, 1)
+		require.Equal(t, "a", res.Links[0].ID)
+	})
+
+	t.Run("TestAggregateByCampaign", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links:aggregate?group_by=campaign", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.AggregateLinkMetricsResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Equal(t, []apis.LinkMetricsGroup{
+			{Key: "spring", Links: 2, Metrics: apis.LinkMetrics{Clicks: 2}},
+		}, res.Groups)
+	})
+
+	t.Run("TestAggregateByTag", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links:aggregate?group_by=tag", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.AggregateLinkMetricsResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Equal(t, []apis.LinkMetricsGroup{
+			{Key: "email", Links: 2, Metrics: apis.LinkMetrics{Clicks: 3}},
+			{Key: "social", Links: 2, Metrics: apis.LinkMetrics{Clicks: 3}},
+		}, res.Groups)
+	})
+
+	t.Run("TestAggregateInvalid", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links:aggregate?group_by=owner", nil)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestTargeting(t *testing.T) {
+	geoIPDatabase := filepath.Join(t.TempDir(), "geoip.csv")
+	require.NoError(t, os.WriteFile(geoIPDatabase, []byte("5.53.32.0/19,BG\n"), 0o600))
+
+	ts := newTestShortener(t, func(c *config.Config) {
+		c.GeoIPDatabase = geoIPDatabase
+		c.TrustForwardedFor = true
+		c.TrustedProxyHops = 2
+	})
+
+	require.NoError(t, ts.db.Create(context.Background(), &links.Link{
+		ID:  "app",
+		URL: "https://asankov.dev",
+		Targeting: []links.TargetingRule{
+			{URL: "https://apps.apple.com/app", Platforms: []links.Platform{links.PlatformIOS}},
+			{URL: "https://play.google.com/app", Platforms: []links.Platform{links.PlatformAndroid}},
+			{URL: "https://asankov.dev/bg", Countries: []string{"BG"}},
+		},
+	}))
+
+	testCases := []struct {
+		name      string
+		userAgent string
+		ip        string
+		expected  string
+	}{
+		{
+			name:      "TestIOS",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)",
+			expected:  "https://apps.apple.com/app",
+		},
+		{
+			name:      "TestAndroid",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile",
+			expected:  "https://play.google.com/app",
+		},
+		{
+			name:      "TestCountry",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+			ip:        "5.53.40.10",
+			expected:  "https://asankov.dev/bg",
+		},
+		{
+			name:      "TestFallback",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+			ip:        "8.8.8.8",
+			expected:  "https://asankov.dev",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/app", nil)
+			req.Header.Set("User-Agent", testCase.userAgent)
+			if testCase.ip != "" {
+				req.Header.Set("X-Forwarded-For", testCase.ip+", 10.0.0.1")
+			}
+
+			rec := httptest.NewRecorder()
+			ts.handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusFound, rec.Code)
+			require.Equal(t, testCase.expected, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	ts := newTestShortener(t)
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "landing",
+		"url": "https://asankov.dev",
+		"destinations": []map[string]any{
+			{"id": "a", "url": "https://asankov.dev/a", "weight": 1},
+			{"id": "b", "url": "https://asankov.dev/b", "weight": 1},
+		},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = ts.do(t, http.MethodGet, "/landing", nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, "/landing", cookies[0].Path)
+	variant := cookies[0].Value
+	location := rec.Header().Get("Location")
+	require.Equal(t, "https://asankov.dev/"+variant, location)
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/landing", nil)
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+
+		require.Equal(t, location, rec.Header().Get("Location"))
+		require.Empty(t, rec.Result().Cookies())
+	}
+
+	rec = ts.do(t, http.MethodGet, "/api/v1/links/landing", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res apis.GetLinkMetricsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Equal(t, 6, res.Metrics.Clicks)
+	require.NotNil(t, res.Metrics.Variants)
+	require.Equal(t, map[string]int{variant: 6}, *res.Metrics.Variants)
+}
+
+func TestPasswordProtection(t *testing.T) {
+	ts := newTestShortener(t, func(c *config.Config) {
+		c.LinkPasswordAttempts = 2
+	})
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":       "secret",
+		"url":      "https://asankov.dev/internal",
+		"password": "open-sesame",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created apis.CreateShortLinkResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.True(t, created.PasswordProtected)
+
+	rec = ts.do(t, http.MethodGet, "/secret", nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), `<form method="post" action="/secret">`)
+
+	unlock := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}, "return": {"/secret"}}
+		req := httptest.NewRequest(http.MethodPost, "/secret", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = unlock("wrong")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "Wrong password")
+
+	rec = unlock("open-sesame")
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	require.Equal(t, "/secret", rec.Header().Get("Location"))
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Equal(t, "https://asankov.dev/internal", rec.Header().Get("Location"))
+
+	t.Run("TestTamperedCookie", func(t *testing.T) {
+		tampered := *cookies[0]
+		tampered.Value = "9999999999" + tampered.Value[strings.Index(tampered.Value, "."):]
+
+		req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+		req.AddCookie(&tampered)
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("TestPasswordChangeRevokesAccess", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPatch, "/api/v1/links/secret", map[string]any{
+			"password": "new-password",
+		})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+		req.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("TestRateLimit", func(t *testing.T) {
+		rec := unlock("wrong")
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = unlock("new-password")
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.NotEmpty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("TestRateLimitPerLink", func(t *testing.T) {
+		ts := newTestShortener(t, func(c *config.Config) {
+			c.LinkPasswordAttempts = 2
+			c.LinkPasswordAttemptsPerLink = 3
+			c.TrustForwardedFor = true
+		})
+		link := &links.Link{ID: "secret", URL: "https://asankov.dev/internal"}
+		require.NoError(t, link.SetPassword("open-sesame"))
+		require.NoError(t, ts.db.Create(context.Background(), link))
+
+		unlock := func(forwardedFor, password string) int {
+			form := url.Values{"password": {password}}
+			req := httptest.NewRequest(http.MethodPost, "/secret", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+
+			rec := httptest.NewRecorder()
+			ts.handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		// A client that rotates the entries it sets in X-Forwarded-For is still the same client.
+		require.Equal(t, http.StatusUnauthorized, unlock("198.51.100.1, 192.0.2.1", "wrong"))
+		require.Equal(t, http.StatusUnauthorized, unlock("198.51.100.2, 192.0.2.1", "wrong"))
+		require.Equal(t, http.StatusTooManyRequests, unlock("198.51.100.3, 192.0.2.1", "open-sesame"))
+
+		// A client that can change its address is limited by the attempts of the link.
+		require.Equal(t, http.StatusUnauthorized, unlock("192.0.2.2", "wrong"))
+		require.Equal(t, http.StatusTooManyRequests, unlock("192.0.2.3", "open-sesame"))
+	})
+}
+
+func TestClickLimit(t *testing.T) {
+	ts := newTestShortener(t)
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":         "invite",
+		"url":        "https://asankov.dev/invite",
+		"max_clicks": 2,
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created apis.CreateShortLinkResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotNil(t, created.MaxClicks)
+	require.Equal(t, 2, *created.MaxClicks)
+
+	for i := 0; i < 2; i++ {
+		rec = ts.do(t, http.MethodGet, "/invite", nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+	}
+
+	rec = ts.do(t, http.MethodGet, "/invite", nil)
+	require.Equal(t, http.StatusGone, rec.Code)
+
+	rec = ts.do(t, http.MethodGet, "/api/v1/links/invite", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res apis.GetLinkMetricsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Equal(t, 2, res.Metrics.Clicks)
+	require.NotNil(t, res.Metrics.RemainingClicks)
+	require.Zero(t, *res.Metrics.RemainingClicks)
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"url":        "https://asankov.dev",
+			"max_clicks": -1,
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("TestDeleteWhenExhausted", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":                    "one-time",
+			"url":                   "https://asankov.dev/invite",
+			"max_clicks":            1,
+			"delete_when_exhausted": true,
+		})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = ts.do(t, http.MethodGet, "/one-time", nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+
+		_, err := ts.db.GetByID(context.Background(), "one-time")
+		require.ErrorIs(t, err, links.ErrLinkNotFound)
+	})
+
+	t.Run("TestConcurrentVisitors", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":         "last-seat",
+			"url":        "https://asankov.dev/invite",
+			"max_clicks": 1,
+		})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		var (
+			wg    sync.WaitGroup
+			codes = make(chan int, 10)
+		)
+		for i := 0; i < cap(codes); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				ts.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/last-seat", nil))
+				codes <- rec.Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		var redirected int
+		for code := range codes {
+			if code == http.StatusFound {
+				redirected++
+				continue
+			}
+			require.Equal(t, http.StatusGone, code)
+		}
+		require.Equal(t, 1, redirected)
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	ts := newTestShortener(t)
+
+	future := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	past := time.Now().Add(-24 * time.Hour).UTC().Truncate(time.Second)
+
+	testCases := []struct {
+		name     string
+		schedule map[string]any
+		state    apis.LinkState
+		code     int
+		location string
+	}{
+		{
+			name:     "TestNotFound",
+			schedule: map[string]any{"active_from": future},
+			state:    apis.LinkStateScheduled,
+			code:     http.StatusNotFound,
+		},
+		{
+			name:     "TestHoldingPage",
+			schedule: map[string]any{"active_from": future, "inactive": "holding-page"},
+			state:    apis.LinkStateScheduled,
+			code:     http.StatusTooEarly,
+		},
+		{
+			name:     "TestHoldingPageExpired",
+			schedule: map[string]any{"active_until": past, "inactive": "holding-page"},
+			state:    apis.LinkStateExpired,
+			code:     http.StatusGone,
+		},
+		{
+			name:     "TestFallback",
+			schedule: map[string]any{"active_from": future, "inactive": "fallback", "fallback_url": "https://asankov.dev/soon"},
+			state:    apis.LinkStateScheduled,
+			code:     http.StatusFound,
+			location: "https://asankov.dev/soon",
+		},
+		{
+			name:     "TestActive",
+			schedule: map[string]any{"active_from": past, "active_until": future},
+			state:    apis.LinkStateActive,
+			code:     http.StatusFound,
+			location: "https://asankov.dev/launch",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+				"url":      "https://asankov.dev/launch",
+				"schedule": testCase.schedule,
+			})
+			require.Equal(t, http.StatusCreated, rec.Code)
+
+			var created apis.CreateShortLinkResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+			require.NotNil(t, created.Schedule)
+
+			rec = ts.do(t, http.MethodGet, "/"+created.ID, nil)
+			require.Equal(t, testCase.code, rec.Code)
+			require.Equal(t, testCase.location, rec.Header().Get("Location"))
+
+			rec = ts.do(t, http.MethodGet, "/api/v1/links/"+created.ID, nil)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var res apis.GetLinkMetricsResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+			require.Equal(t, testCase.state, res.State)
+		})
+	}
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"url":      "https://asankov.dev/launch",
+			"schedule": map[string]any{"active_from": future, "active_until": past},
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestPreview(t *testing.T) {
+	ts := newTestShortener(t)
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "docs",
+		"url": "https://asankov.dev/docs",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created apis.CreateShortLinkResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotNil(t, created.Owner)
+	require.Equal(t, admin.Email, *created.Owner)
+	require.False(t, created.CreatedAt.IsZero())
+
+	for _, path := range []string{"/docs+", "/docs?preview=1"} {
+		t.Run(path, func(t *testing.T) {
+			rec := ts.do(t, http.MethodGet, path, nil)
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Empty(t, rec.Header().Get("Location"))
+
+			body := rec.Body.String()
+			require.Contains(t, body, "https://asankov.dev/docs")
+			require.Contains(t, body, admin.Email)
+			require.Contains(t, body, "has not been checked yet")
+		})
+	}
+
+	link, err := ts.db.GetByID(context.Background(), "docs")
+	require.NoError(t, err)
+	require.Zero(t, link.Metrics.Clicks)
+
+	t.Run("TestNotFound", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/missing+", nil)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("TestPasswordProtected", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":       "hidden",
+			"url":      "https://asankov.dev/hidden",
+			"password": "open-sesame",
+		})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = ts.do(t, http.MethodGet, "/hidden+", nil)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.NotContains(t, rec.Body.String(), "https://asankov.dev/hidden")
+	})
+
+	t.Run("TestReservedID", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":  "docs+",
+			"url": "https://asankov.dev/docs",
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestInterstitial(t *testing.T) {
+	t.Run("TestPerLink", func(t *testing.T) {
+		ts := newTestShortener(t)
+
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":           "careful",
+			"url":          "https://asankov.dev/careful",
+			"interstitial": true,
+		})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = ts.do(t, http.MethodGet, "/careful", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `<meta http-equiv="refresh" content="5; url=https://asankov.dev/careful">`)
+
+		link, err := ts.db.GetByID(context.Background(), "careful")
+		require.NoError(t, err)
+		require.Equal(t, 1, link.Metrics.Clicks)
+	})
+
+	t.Run("TestAlways", func(t *testing.T) {
+		ts := newTestShortener(t, func(c *config.Config) {
+			c.AlwaysInterstitial = true
+			c.InterstitialDelay = 3 * time.Second
+		})
+
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":  "docs",
+			"url": "https://asankov.dev/docs",
+		})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = ts.do(t, http.MethodGet, "/docs", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `content="3; url=https://asankov.dev/docs"`)
+	})
+}
+
+func TestQRCode(t *testing.T) {
+	logo := filepath.Join(t.TempDir(), "logo.png")
+	f, err := os.Create(logo)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	require.NoError(t, f.Close())
+
+	ts := newTestShortener(t, func(c *config.Config) {
+		c.PublicURL = "https://sh.asankov.dev"
+		c.QRLogo = logo
+	})
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":          "poster",
+		"url":         "https://asankov.dev/event",
+		"passthrough": map[string]any{"query": true, "path": false},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	t.Run("TestPNG", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links/poster/qr?size=512&level=high&foreground=%23123456", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+
+		img, err := png.Decode(rec.Body)
+		require.NoError(t, err)
+		require.Equal(t, image.Rect(0, 0, 512, 512), img.Bounds())
+	})
+
+	t.Run("TestSVG", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links/poster/qr?format=svg&margin=0&logo=true", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+		require.True(t, strings.HasPrefix(rec.Body.String(), "<svg"))
+	})
+
+	t.Run("TestInvalidOptions", func(t *testing.T) {
+		for _, query := range []string{"size=4096", "margin=-1", "foreground=blue", "level=ultra", "format=gif"} {
+			rec := ts.do(t, http.MethodGet, "/api/v1/links/poster/qr?"+query, nil)
+			require.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	})
+
+	t.Run("TestNotFound", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/api/v1/links/missing/qr", nil)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("TestTrackScans", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/poster?qr=1&ref=print", nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+		require.Equal(t, "https://asankov.dev/event?ref=print", rec.Header().Get("Location"))
+
+		rec = ts.do(t, http.MethodGet, "/poster", nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+
+		link, err := ts.db.GetByID(context.Background(), "poster")
+		require.NoError(t, err)
+		require.Equal(t, 2, link.Metrics.Clicks)
+		require.Equal(t, 1, link.Metrics.QRScans)
+	})
+}
+
+func TestImportExport(t *testing.T) {
+	ts := newTestShortener(t)
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "taken",
+		"url": "https://asankov.dev/taken",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	importLinks := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/links:import", strings.NewReader(body))
+		req.Header.Set("Authorization", ts.token)
+		req.Header.Set("Content-Type", contentType)
+
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = importLinks("text/csv", `id,url,tags,expiry
+old-1,https://asankov.dev/1,"migrated, 2019",
+old-2,https://asankov.dev/2,,2099-01-01T00:00:00Z
+taken,https://asankov.dev/taken,,
+old-1,https://asankov.dev/duplicate,,
+old-3,not-a-url,,
+,https://asankov.dev/generated,,
+`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res apis.ImportLinksResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Equal(t, 3, res.Imported)
+	require.Equal(t, 3, res.Failed)
+	require.Len(t, res.Errors, 3)
+	require.Equal(t, 3, res.Errors[0].Row)
+	require.Equal(t, 4, res.Errors[1].Row)
+	require.Equal(t, 5, res.Errors[2].Row)
+
+	link, err := ts.db.GetByID(context.Background(), "old-1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"migrated", "2019"}, link.Tags)
+	require.Equal(t, admin.Email, link.Owner)
+
+	link, err = ts.db.GetByID(context.Background(), "old-2")
+	require.NoError(t, err)
+	require.NotNil(t, link.Schedule)
+	require.Equal(t, time.Date(2099, time.January, 1, 0, 0, 0, 0, time.UTC), *link.Schedule.ActiveUntil)
+
+	t.Run("TestNDJSON", func(t *testing.T) {
+		rec := importLinks("application/x-ndjson", `{"id":"old-4","url":"https://asankov.dev/4"}
+{"id":"old-5"
+`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.ImportLinksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Equal(t, 1, res.Imported)
+		require.Equal(t, 1, res.Failed)
+	})
+
+	t.Run("TestUnreadableRow", func(t *testing.T) {
+		rec := importLinks("application/x-ndjson", `{"id":"old-6","url":"https://asankov.dev/6"}
+{"id":"old-7","url":"not-a-url"}
+{"id":"old-8","url":"https://asankov.dev/`+strings.Repeat("8", 1<<20)+`"}
+{"id":"old-9","url":"https://asankov.dev/9"}
+`)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var res apis.ImportLinksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Equal(t, 1, res.Imported)
+		require.Equal(t, 2, res.Failed)
+		require.Len(t, res.Errors, 2)
+		require.Equal(t, 2, res.Errors[0].Row)
+		require.Equal(t, 3, res.Errors[1].Row)
+
+		_, err := ts.db.GetByID(context.Background(), "old-6")
+		require.NoError(t, err)
+		_, err = ts.db.GetByID(context.Background(), "old-9")
+		require.ErrorIs(t, err, links.ErrLinkNotFound)
+		require.NoError(t, ts.db.Delete(context.Background(), "old-6"))
+	})
+
+	t.Run("TestUnsupportedMediaType", func(t *testing.T) {
+		rec := importLinks("application/xml", "<links/>")
+		require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("TestExport", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/old-1", nil)
+		require.Equal(t, http.StatusFound, rec.Code)
+
+		rec = ts.do(t, http.MethodGet, "/api/v1/links:export?format=json", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var exported []struct {
+			ID     string `json:"id"`
+			Clicks int    `json:"clicks"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&exported))
+		require.Len(t, exported, 5)
+
+		clicks := make(map[string]int)
+		for _, e := range exported {
+			clicks[e.ID] = e.Clicks
+		}
+		require.Equal(t, 1, clicks["old-1"])
+
+		rec = ts.do(t, http.MethodGet, "/api/v1/links:export", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+		require.Len(t, strings.Split(strings.TrimSpace(rec.Body.String()), "\n"), 6)
+
+		rec = ts.do(t, http.MethodGet, "/api/v1/links:export?format=xml", nil)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestBatchCreate(t *testing.T) {
+	ts := newTestShortener(t, func(c *config.Config) {
+		c.BatchMaxLinks = 5
+	})
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "taken",
+		"url": "https://asankov.dev/taken",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	batch := []map[string]any{
+		{"id": "email-1", "url": "https://asankov.dev/1"},
+		{"url": "https://asankov.dev/generated"},
+		{"id": "taken", "url": "https://asankov.dev/taken"},
+		{"id": "email-2", "url": "https://asankov.dev/2", "redirect_type": "303"},
+	}
+	statuses := func(rec *httptest.ResponseRecorder) []apis.BatchCreateLinkResultStatus {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.BatchCreateLinksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+
+		statuses := make([]apis.BatchCreateLinkResultStatus, 0, len(res.Results))
+		for _, result := range res.Results {
+			require.NotNil(t, result.ID)
+			statuses = append(statuses, result.Status)
+		}
+		return statuses
+	}
+
+	t.Run("TestAtomic", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links:batch", map[string]any{
+			"links":  batch,
+			"atomic": true,
+		})
+		require.Equal(t, []apis.BatchCreateLinkResultStatus{
+			apis.BatchStatusAborted,
+			apis.BatchStatusAborted,
+			apis.BatchStatusAborted,
+			apis.BatchStatusInvalid,
+		}, statuses(rec))
+
+		_, err := ts.db.GetByID(context.Background(), "email-1")
+		require.ErrorIs(t, err, links.ErrLinkNotFound)
+	})
+
+	t.Run("TestAtomicConflict", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links:batch", map[string]any{
+			"links":  batch[:3],
+			"atomic": true,
+		})
+		require.Equal(t, []apis.BatchCreateLinkResultStatus{
+			apis.BatchStatusAborted,
+			apis.BatchStatusAborted,
+			apis.BatchStatusConflict,
+		}, statuses(rec))
+
+		_, err := ts.db.GetByID(context.Background(), "email-1")
+		require.ErrorIs(t, err, links.ErrLinkNotFound)
+	})
+
+	t.Run("TestNotAtomic", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links:batch", map[string]any{
+			"links": batch,
+		})
+		require.Equal(t, []apis.BatchCreateLinkResultStatus{
+			apis.BatchStatusCreated,
+			apis.BatchStatusCreated,
+			apis.BatchStatusConflict,
+			apis.BatchStatusInvalid,
+		}, statuses(rec))
+
+		link, err := ts.db.GetByID(context.Background(), "email-1")
+		require.NoError(t, err)
+		require.Equal(t, admin.Email, link.Owner)
+	})
+
+	t.Run("TestAtomicCreated", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links:batch", map[string]any{
+			"links": []map[string]any{
+				{"id": "email-3", "url": "https://asankov.dev/3"},
+				{"id": "email-4", "url": "https://asankov.dev/4"},
+			},
+			"atomic": true,
+		})
+		require.Equal(t, []apis.BatchCreateLinkResultStatus{
+			apis.BatchStatusCreated,
+			apis.BatchStatusCreated,
+		}, statuses(rec))
+	})
+
+	t.Run("TestTooLarge", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links:batch", map[string]any{
+			"links": append(batch, batch...),
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	ts := newTestShortener(t)
+
+	create := func(ts *testShortener, key string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		require.NoError(t, json.NewEncoder(&b).Encode(body))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/links", &b)
+		req.Header.Set("Authorization", ts.token)
+		req.Header.Set("Idempotency-Key", key)
+
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := map[string]any{"url": "https://asankov.dev"}
+
+	first := create(ts, "key-1", body)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	t.Run("TestReplay", func(t *testing.T) {
+		rec := create(ts, "key-1", body)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+		require.Equal(t, first.Body.String(), rec.Body.String())
+
+		all, err := ts.db.GetAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, all, 1)
+	})
+
+	t.Run("TestDifferentBody", func(t *testing.T) {
+		rec := create(ts, "key-1", map[string]any{"url": "https://asankov.dev/other"})
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("TestDifferentKey", func(t *testing.T) {
+		rec := create(ts, "key-2", body)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.NotEqual(t, first.Body.String(), rec.Body.String())
+	})
+
+	t.Run("TestClientErrorIsReplayed", func(t *testing.T) {
+		invalid := map[string]any{"url": "https://asankov.dev", "redirect_type": "303"}
+		require.Equal(t, http.StatusBadRequest, create(ts, "key-3", invalid).Code)
+
+		rec := create(ts, "key-3", invalid)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("TestAbandonedReservation", func(t *testing.T) {
+		// The reservation of a request whose replica went away before storing the response.
+		var b bytes.Buffer
+		require.NoError(t, json.NewEncoder(&b).Encode(body))
+		hash := sha256.Sum256(append([]byte{0}, b.Bytes()...))
+		require.NoError(t, ts.db.ReserveIdempotencyKey(context.Background(), &idempotency.Record{
+			Key:         admin.Email + " POST /api/v1/links key-4",
+			RequestHash: hex.EncodeToString(hash[:]),
+			ExpiresAt:   time.Now().Add(10 * time.Millisecond),
+		}))
+		require.Equal(t, http.StatusConflict, create(ts, "key-4", body).Code)
+
+		time.Sleep(20 * time.Millisecond)
+		rec := create(ts, "key-4", body)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+		rec = create(ts, "key-4", body)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("TestExpired", func(t *testing.T) {
+		ts := newTestShortener(t, func(c *config.Config) {
+			c.IdempotencyKeyTTL = time.Millisecond
+		})
+
+		require.Equal(t, http.StatusCreated, create(ts, "key", body).Code)
+		time.Sleep(5 * time.Millisecond)
+		rec := create(ts, "key", body)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+		all, err := ts.db.GetAll(context.Background())
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+	})
+}
+
+func TestReuseExisting(t *testing.T) {
+	ts := newTestShortener(t)
+
+	create := func(body map[string]any) (int, apis.CreateShortLinkResponse) {
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", body)
+		var res apis.CreateShortLinkResponse
+		if rec.Code == http.StatusOK || rec.Code == http.StatusCreated {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		}
+		return rec.Code, res
+	}
+
+	code, first := create(map[string]any{"id": "first", "url": "https://asankov.dev/blog?b=2&a=1"})
+	require.Equal(t, http.StatusCreated, code)
+
+	t.Run("TestReused", func(t *testing.T) {
+		code, res := create(map[string]any{"url": "HTTPS://Asankov.dev:443/blog?a=1&b=2#top", "reuse_existing": true})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, first.ID, res.ID)
+		require.Equal(t, "https://asankov.dev/blog?b=2&a=1", res.URL)
+	})
+
+	t.Run("TestNotReusedWithoutFlag", func(t *testing.T) {
+		code, res := create(map[string]any{"id": "second", "url": "https://asankov.dev/blog?a=1&b=2"})
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, "second", res.ID)
+	})
+
+	t.Run("TestNoExistingLink", func(t *testing.T) {
+		code, res := create(map[string]any{"url": "https://asankov.dev/other", "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.NotEqual(t, first.ID, res.ID)
+	})
+
+	t.Run("TestUpdatedURL", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPatch, "/api/v1/links/second", map[string]any{"url": "https://asankov.dev/moved"})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		code, res := create(map[string]any{"url": "https://asankov.dev/moved", "reuse_existing": true})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "second", res.ID)
+	})
+
+	t.Run("TestInvalidURL", func(t *testing.T) {
+		code, _ := create(map[string]any{"url": "asankov.dev", "reuse_existing": true})
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("TestDuplicatesReport", func(t *testing.T) {
+		code, _ := create(map[string]any{"id": "third", "url": "https://asankov.dev/blog?a=1&b=2"})
+		require.Equal(t, http.StatusCreated, code)
+		code, _ = create(map[string]any{"id": "fourth", "url": "https://asankov.dev/moved/"})
+		require.Equal(t, http.StatusCreated, code)
+
+		rec := ts.do(t, http.MethodGet, "/api/v1/links:duplicates", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.DuplicateLinksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Len(t, res.Groups, 1)
+		require.Equal(t, "https://asankov.dev/blog?a=1&b=2", res.Groups[0].URL)
+		require.Equal(t, admin.Email, res.Groups[0].Owner)
+		require.Equal(t, []string{"first", "third"}, res.Groups[0].Links)
+	})
+
+	t.Run("TestDifferentSettings", func(t *testing.T) {
+		code, res := create(map[string]any{"url": "https://asankov.dev/blog?a=1&b=2", "redirect_type": "307", "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.NotEqual(t, first.ID, res.ID)
+
+		code, res = create(map[string]any{"url": "https://asankov.dev/blog?a=1&b=2", "max_clicks": 10, "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.NotEqual(t, first.ID, res.ID)
+
+		code, res = create(map[string]any{"id": "fifth", "url": "https://asankov.dev/blog?a=1&b=2", "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, "fifth", res.ID)
+	})
+
+	t.Run("TestPassword", func(t *testing.T) {
+		code, protected := create(map[string]any{"url": "https://asankov.dev/secret", "password": "hunter2"})
+		require.Equal(t, http.StatusCreated, code)
+
+		code, res := create(map[string]any{"url": "https://asankov.dev/secret", "password": "hunter2", "reuse_existing": true})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, protected.ID, res.ID)
+
+		code, res = create(map[string]any{"url": "https://asankov.dev/secret", "password": "other", "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.NotEqual(t, protected.ID, res.ID)
+
+		code, res = create(map[string]any{"url": "https://asankov.dev/secret", "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.NotEqual(t, protected.ID, res.ID)
+	})
+
+	t.Run("TestUTM", func(t *testing.T) {
+		utm := map[string]any{"source": "newsletter"}
+		code, tagged := create(map[string]any{"url": "https://asankov.dev/utm", "utm": utm})
+		require.Equal(t, http.StatusCreated, code)
+
+		code, res := create(map[string]any{"url": "https://asankov.dev/utm", "utm": utm, "reuse_existing": true})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, tagged.ID, res.ID)
+
+		code, res = create(map[string]any{"url": "https://asankov.dev/utm", "reuse_existing": true})
+		require.Equal(t, http.StatusCreated, code)
+		require.NotEqual(t, tagged.ID, res.ID)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestShortener(t)
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "metrics",
+		"url": "https://asankov.dev",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusFound, ts.do(t, http.MethodGet, "/metrics", nil).Code)
+	require.Equal(t, http.StatusNotFound, ts.do(t, http.MethodGet, "/missing", nil).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links", nil)
+	rec = httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	ts.admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		`shortener_http_requests_total{code="201",operation="POST /api/v1/links"} 1`,
+		`shortener_http_requests_total{code="302",operation="GET /{linkId}"} 1`,
+		`shortener_http_requests_total{code="404",operation="GET /{linkId}"} 1`,
+		`shortener_http_request_duration_seconds_count{operation="GET /{linkId}"} 2`,
+		`shortener_redirects_total{result="hit"} 1`,
+		`shortener_redirects_total{result="miss"} 1`,
+		`shortener_storage_call_duration_seconds_count{backend="inmemory",method="GetByID"} 2`,
+		`shortener_storage_call_duration_seconds_count{backend="inmemory",method="Create"} 1`,
+		`shortener_auth_failures_total{reason="missing_token"} 1`,
+		`shortener_id_conflicts_total 0`,
+	} {
+		require.Contains(t, body, line)
+	}
+	require.NotContains(t, body, "shortener_storage_errors_total{")
+}
+
+func TestTracing(t *testing.T) {
+	ts := newTestShortener(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	ts.shortener.SetTracerProvider(tracing.NewProvider(sdktrace.WithSyncer(exporter)))
+	var logs bytes.Buffer
+	ts.shortener.SetLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "traced",
+		"url": "https://asankov.dev",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	exporter.Reset()
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/traced", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	rec = httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	server, ok := byName["GET /{linkId}"]
+	require.True(t, ok)
+	require.Equal(t, traceID, server.SpanContext.TraceID().String())
+	require.Equal(t, spanID, server.Parent.SpanID().String())
+	require.Equal(t, trace.SpanKindServer, server.SpanKind)
+
+	for _, name := range []string{"Database.GetByID", "Database.IncrementClicks"} {
+		child, ok := byName[name]
+		require.True(t, ok, name)
+		require.Equal(t, traceID, child.SpanContext.TraceID().String())
+		require.Equal(t, server.SpanContext.SpanID(), child.Parent.SpanID())
+	}
+
+	t.Run("TestLogs", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/links", strings.NewReader("{"))
+		req.Header.Set("Authorization", ts.token)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		require.Contains(t, logs.String(), `"trace_id":"`+traceID+`"`)
+	})
+}
+
+// blockingDB is a database whose lookups wait until their context is done.
+type blockingDB struct {
+	*inmemory.DB
+}
+
+func (d *blockingDB) GetByID(ctx context.Context, id string) (*links.Link, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestStorageDeadlines(t *testing.T) {
+	t.Setenv("SHORTENER_SECRET", secret)
+	t.Setenv("SHORTENER_USE_IN_MEMORY_DB", "true")
+	config, err := config.NewFromEnv()
+	require.NoError(t, err)
+	config.StorageReadTimeout = 10 * time.Millisecond
+
+	db := inmemory.NewDB()
+	s, err := shortener.New(config, &blockingDB{DB: db}, db, db, auth.NewAutheniticator(secret), db, db)
+	require.NoError(t, err)
+	s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	t.Run("timeout", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/link", nil))
+		require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	})
+
+	t.Run("client gone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/link", nil).WithContext(ctx))
+		require.Equal(t, 499, rec.Code)
+	})
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	ts := newTestShortener(t, func(c *config.Config) {
+		c.Port = 0
+		c.AdminPort = 0
+		c.ShutdownDrainPeriod = 200 * time.Millisecond
+		c.ShutdownTimeout = time.Second
+	})
+	ready := func() int {
+		return ts.do(t, http.MethodGet, "/readyz", nil).Code
+	}
+	require.Equal(t, http.StatusServiceUnavailable, ready())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- ts.shortener.Start(ctx)
+	}()
+	require.Eventually(t, func() bool { return ready() == http.StatusOK }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.Eventually(t, func() bool { return ready() == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond)
+
+	// The requests are still served during the drain period.
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":  "draining",
+		"url": "https://asankov.dev",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the shortener was not shut down")
+	}
+}
+
+// unhealthyDB is a database whose health check returns err.
+type unhealthyDB struct {
+	*inmemory.DB
+
+	mu  sync.Mutex
+	err error
+}
+
+func (d *unhealthyDB) CheckHealth(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *unhealthyDB) setErr(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+}
+
+func TestHealth(t *testing.T) {
+	t.Setenv("SHORTENER_SECRET", secret)
+	t.Setenv("SHORTENER_USE_IN_MEMORY_DB", "true")
+	config, err := config.NewFromEnv()
+	require.NoError(t, err)
+	config.Port = 0
+	config.AdminPort = 0
+	config.ShutdownDrainPeriod = 0
+	config.ReadinessCacheTTL = 0
+
+	db := &unhealthyDB{DB: inmemory.NewDB()}
+	authenticator := auth.NewAutheniticator(secret)
+	s, err := shortener.New(config, db, db, db, authenticator, db, db)
+	require.NoError(t, err)
+	s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	token, err := authenticator.NewTokenForUser(admin)
+	require.NoError(t, err)
+	ts := &testShortener{shortener: s, handler: s.Handler(), db: db.DB, token: token}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-stopped)
+	})
+
+	require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/healthz", nil).Code)
+	require.Eventually(t, func() bool {
+		return ts.do(t, http.MethodGet, "/readyz", nil).Code == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("TestStorageUnavailable", func(t *testing.T) {
+		db.setErr(errors.New("table not found"))
+		rec := ts.do(t, http.MethodGet, "/readyz", nil)
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.JSONEq(t, `{"status": "storage unavailable"}`, rec.Body.String())
+		// The process is still alive.
+		require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/healthz", nil).Code)
+
+		db.setErr(nil)
+		require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/readyz", nil).Code)
+	})
+
+	t.Run("TestVersion", func(t *testing.T) {
+		rec := ts.do(t, http.MethodGet, "/version", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res struct {
+			Version   string `json:"version"`
+			GoVersion string `json:"go_version"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Equal(t, "dev", res.Version)
+		require.NotEmpty(t, res.GoVersion)
+	})
+
+	t.Run("TestReservedIDs", func(t *testing.T) {
+		for _, id := range []string{"healthz", "readyz", "version"} {
+			rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+				"id":  id,
+				"url": "https://asankov.dev",
+			})
+			require.Equal(t, http.StatusBadRequest, rec.Code, id)
+		}
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	ts := newTestShortener(t)
+	var logs bytes.Buffer
+	ts.shortener.SetLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+		"id":       "logged",
+		"url":      "https://asankov.dev",
+		"password": "s3cret",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusUnauthorized, ts.do(t, http.MethodGet, "/logged?password=s3cret&utm_source=test", nil).Code)
+	require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/healthz", nil).Code)
+
+	type record struct {
+		Level  string `json:"level"`
+		Msg    string `json:"msg"`
+		Method string `json:"method"`
+		Route  string `json:"route"`
+		Status int    `json:"status"`
+		Bytes  int    `json:"bytes"`
+		LinkID string `json:"link_id"`
+		User   string `json:"user"`
+		Query  string `json:"query"`
+	}
+	var records []record
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var r record
+		require.NoError(t, decoder.Decode(&r))
+		if r.Msg == "request" {
+			records = append(records, r)
+		}
+	}
+
+	require.Len(t, records, 2, "the requests to /healthz are not sampled by default")
+	require.Equal(t, "INFO", records[0].Level)
+	require.Equal(t, http.MethodPost, records[0].Method)
+	require.Equal(t, "/api/v1/links", records[0].Route)
+	require.Equal(t, http.StatusCreated, records[0].Status)
+	require.Equal(t, admin.Email, records[0].User)
+	require.Positive(t, records[0].Bytes)
+
+	require.Equal(t, "WARN", records[1].Level)
+	require.Equal(t, "/{linkId}", records[1].Route)
+	require.Equal(t, "logged", records[1].LinkID)
+	require.Equal(t, "password=%5BREDACTED%5D&utm_source=test", records[1].Query)
+	require.NotContains(t, logs.String(), "s3cret")
+	require.NotContains(t, logs.String(), ts.token)
+}
+
+func TestReloadConfig(t *testing.T) {
+	ts := newTestShortener(t)
+	var logs bytes.Buffer
+	ts.shortener.SetLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	reloaded := make(chan *config.Config, 1)
+	ts.shortener.WatchConfig("", func() (*config.Config, error) {
+		select {
+		case c := <-reloaded:
+			return c, nil
+		default:
+			return nil, errors.New("invalid config")
+		}
+	})
+
+	status := func(t *testing.T) config.ReloadStatus {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		ts.admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var status config.ReloadStatus
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+		return status
+	}
+	initial := status(t)
+	require.Equal(t, 1, initial.Version)
+	require.NotEmpty(t, initial.Checksum)
+
+	t.Run("TestValid", func(t *testing.T) {
+		t.Setenv("SHORTENER_ACCESS_LOG_SAMPLE_RATES", "GET /readyz:0")
+		t.Setenv("SHORTENER_PORT", "8000")
+		c, err := config.NewFromEnv()
+		require.NoError(t, err)
+		reloaded <- c
+
+		require.NoError(t, ts.shortener.ReloadConfig())
+
+		require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/healthz", nil).Code)
+		require.Contains(t, logs.String(), `"route":"/healthz"`, "the requests to /healthz are sampled after the reload")
+
+		current := status(t)
+		require.Equal(t, 2, current.Version)
+		require.NotEqual(t, initial.Checksum, current.Checksum)
+		require.Equal(t, []string{"port"}, current.RestartRequired)
+	})
+	t.Run("TestInvalid", func(t *testing.T) {
+		require.Error(t, ts.shortener.ReloadConfig())
+
+		current := status(t)
+		require.Equal(t, 2, current.Version, "the active config is kept")
+		require.Equal(t, "invalid config", current.LastReloadError)
+		require.NotNil(t, current.LastReloadAt)
+	})
+}
+
+func TestDenylist(t *testing.T) {
+	ts := newTestShortener(t, func(c *config.Config) {
+		c.DeniedDestinations = []string{"evil.example"}
+	})
+
+	t.Run("TestCreate", func(t *testing.T) {
+		for _, url := range []string{"https://evil.example/login", "https://www.EVIL.example/login"} {
+			rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{"url": url})
+			require.Equal(t, http.StatusBadRequest, rec.Code, url)
+		}
+
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{
+			"id":  "good",
+			"url": "https://notevil.example",
+			"targeting": []map[string]any{
+				{"url": "https://evil.example/mobile", "devices": []string{"mobile"}},
+			},
+		})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{"id": "good", "url": "https://notevil.example"})
+		require.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("TestUpdate", func(t *testing.T) {
+		rec := ts.do(t, http.MethodPatch, "/api/v1/links/good", map[string]any{"url": "https://evil.example"})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		link, err := ts.db.GetByID(context.Background(), "good")
+		require.NoError(t, err)
+		require.Equal(t, "https://notevil.example", link.URL)
+	})
+
+	t.Run("TestImport", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/links:import", strings.NewReader(`{"id":"imported","url":"https://evil.example"}
+`))
+		req.Header.Set("Authorization", ts.token)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res apis.ImportLinksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Equal(t, 0, res.Imported)
+		require.Len(t, res.Errors, 1)
+		require.Contains(t, res.Errors[0].Error, "destination is denied")
+	})
+
+	t.Run("TestReload", func(t *testing.T) {
+		ts.shortener.WatchConfig("", func() (*config.Config, error) {
+			t.Setenv("SHORTENER_DENIED_DESTINATIONS", "notevil.example")
+			return config.NewFromEnv()
+		})
+		require.NoError(t, ts.shortener.ReloadConfig())
+
+		rec := ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{"url": "https://evil.example"})
+		require.Equal(t, http.StatusCreated, rec.Code)
+		rec = ts.do(t, http.MethodPost, "/api/v1/links", map[string]any{"url": "https://notevil.example/other"})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = ts.do(t, http.MethodPatch, "/api/v1/links/good", map[string]any{"tags": []string{"legacy"}})
+		require.Equal(t, http.StatusOK, rec.Code, "the links that lead to the denied hosts can still be changed")
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	limits := func(c *config.Config) {
+		c.RateLimitsPerIP = map[string]ratelimit.Limit{"GET /{linkId}": {Count: 2, Period: time.Minute}}
+		c.RateLimitsPerUser = map[string]ratelimit.Limit{"*": {Count: 3, Period: time.Minute}}
+		c.RateLimitsPerLink = map[string]ratelimit.Limit{"GET /{linkId}": {Count: 3, Period: time.Minute}}
+	}
+	visit := func(t *testing.T, handler http.Handler, linkID, remoteAddr string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/"+linkID, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("TestPerIP", func(t *testing.T) {
+		ts := newTestShortener(t, limits)
+		require.NoError(t, ts.db.Create(context.Background(), &links.Link{ID: "limited", URL: "https://asankov.dev"}))
+
+		rec := visit(t, ts.handler, "limited", "192.0.2.1:1234")
+		require.Equal(t, http.StatusFound, rec.Code)
+		require.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+		require.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+		require.Equal(t, http.StatusFound, visit(t, ts.handler, "limited", "192.0.2.1:1234").Code)
+
+		rec = visit(t, ts.handler, "limited", "192.0.2.1:1234")
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusFound, visit(t, ts.handler, "limited", "192.0.2.2:1234").Code, "other clients are not limited")
+		require.Equal(t, http.StatusTooManyRequests, visit(t, ts.handler, "limited", "192.0.2.3:1234").Code, "the link is limited for all clients")
+		require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/healthz", nil).Code, "the probes are not limited")
+	})
+	t.Run("TestPerUser", func(t *testing.T) {
+		ts := newTestShortener(t, limits)
+
+		for i := 0; i < 3; i++ {
+			require.Equal(t, http.StatusOK, ts.do(t, http.MethodGet, "/api/v1/links", nil).Code)
+		}
+		rec := ts.do(t, http.MethodGet, "/api/v1/links", nil)
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+		require.Equal(t, "20", rec.Header().Get("Retry-After"))
+	})
+	t.Run("TestSharedStore", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() {
+			require.NoError(t, client.Close())
+		})
+
+		// Two replicas of the service, which share the buckets.
+		replicas := []*testShortener{newTestShortener(t, limits), newTestShortener(t, limits)}
+		for _, replica := range replicas {
+			replica.shortener.SetRateLimiter(ratelimit.NewRedis(client))
+			require.NoError(t, replica.db.Create(context.Background(), &links.Link{ID: "shared", URL: "https://asankov.dev"}))
+		}
+
+		require.Equal(t, http.StatusFound, visit(t, replicas[0].handler, "shared", "192.0.2.1:1234").Code)
+		require.Equal(t, http.StatusFound, visit(t, replicas[1].handler, "shared", "192.0.2.1:1234").Code)
+		require.Equal(t, http.StatusTooManyRequests, visit(t, replicas[0].handler, "shared", "192.0.2.1:1234").Code)
+		require.Equal(t, http.StatusTooManyRequests, visit(t, replicas[1].handler, "shared", "192.0.2.1:1234").Code)
+
+		server.Close()
+		require.Equal(t, http.StatusFound, visit(t, replicas[0].handler, "shared", "192.0.2.1:1234").Code, "the requests are allowed when the store fails")
+	})
+	t.Run("TestForwardedFor", func(t *testing.T) {
+		ts := newTestShortener(t, func(c *config.Config) {
+			c.RateLimitsPerIP = map[string]ratelimit.Limit{"GET /{linkId}": {Count: 2, Period: time.Minute}}
+			c.TrustForwardedFor = true
+		})
+		require.NoError(t, ts.db.Create(context.Background(), &links.Link{ID: "limited", URL: "https://asankov.dev"}))
+
+		visit := func(forwardedFor string) int {
+			req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			rec := httptest.NewRecorder()
+			ts.handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		// The proxy appends the address of the client to the entries set by the client.
+		require.Equal(t, http.StatusFound, visit("198.51.100.1, 192.0.2.1"))
+		require.Equal(t, http.StatusFound, visit("198.51.100.2, 192.0.2.1"))
+		require.Equal(t, http.StatusTooManyRequests, visit("198.51.100.3, 192.0.2.1"), "the entries set by the client are not used")
+		require.Equal(t, http.StatusFound, visit("192.0.2.2"))
+
+		// The invalid entries are counted by the address of the proxy.
+		require.Equal(t, http.StatusFound, visit("x"))
+		require.Equal(t, http.StatusFound, visit("192.0.2.3, y"))
+		require.Equal(t, http.StatusTooManyRequests, visit("x"))
+	})
+	t.Run("TestTrustedProxyHops", func(t *testing.T) {
+		ts := newTestShortener(t, func(c *config.Config) {
+			c.RateLimitsPerIP = map[string]ratelimit.Limit{"GET /{linkId}": {Count: 1, Period: time.Minute}}
+			c.TrustForwardedFor = true
+			c.TrustedProxyHops = 2
+		})
+		require.NoError(t, ts.db.Create(context.Background(), &links.Link{ID: "limited", URL: "https://asankov.dev"}))
+
+		visit := func(forwardedFor string) int {
+			req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			rec := httptest.NewRecorder()
+			ts.handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		require.Equal(t, http.StatusFound, visit("198.51.100.1, 192.0.2.1, 10.0.0.2"))
+		require.Equal(t, http.StatusTooManyRequests, visit("198.51.100.2, 192.0.2.1, 10.0.0.2"))
+		require.Equal(t, http.StatusFound, visit("192.0.2.2, 10.0.0.2"))
+	})
+}
+
+// countingDB is a database that counts its lookups of links and can slow them down.
+type countingDB struct {
+	*inmemory.DB
+
+	delay   time.Duration
+	lookups atomic.Int64
+}
+
+func (d *countingDB) GetByID(ctx context.Context, id string) (*links.Link, error) {
+	d.lookups.Add(1)
+	time.Sleep(d.delay)
+	return d.DB.GetByID(ctx, id)
+}
+
+func TestLinkCache(t *testing.T) {
+	newReplica := func(t *testing.T, db *inmemory.DB, configure ...func(*config.Config)) (*shortener.Shortener, *countingDB) {
+		t.Helper()
+
+		t.Setenv("SHORTENER_SECRET", secret)
+		t.Setenv("SHORTENER_USE_IN_MEMORY_DB", "true")
+		config, err := config.NewFromEnv()
+		require.NoError(t, err)
+		for _, c := range configure {
+			c(config)
+		}
+
+		counting := &countingDB{DB: db}
+		s, err := shortener.New(config, counting, db, db, auth.NewAutheniticator(secret), db, db)
+		require.NoError(t, err)
+		s.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		return s, counting
+	}
+	visit := func(t *testing.T, s *shortener.Shortener, linkID string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+linkID, nil))
+		return rec
+	}
+
+	t.Run("TestHit", func(t *testing.T) {
+		db := inmemory.NewDB()
+		require.NoError(t, db.Create(context.Background(), &links.Link{ID: "hot", URL: "https://asankov.dev"}))
+		s, counting := newReplica(t, db)
+
+		for i := 0; i < 5; i++ {
+			rec := visit(t, s, "hot")
+			require.Equal(t, http.StatusFound, rec.Code)
+			require.Equal(t, "https://asankov.dev", rec.Header().Get("Location"))
+		}
+		require.EqualValues(t, 1, counting.lookups.Load())
+	})
+	t.Run("TestInvalidation", func(t *testing.T) {
+		db := inmemory.NewDB()
+		s, counting := newReplica(t, db)
+		token, err := auth.NewAutheniticator(secret).NewTokenForUser(admin)
+		require.NoError(t, err)
+		api := func(method, path string, body any) int {
+			var b bytes.Buffer
+			require.NoError(t, json.NewEncoder(&b).Encode(body))
+			req := httptest.NewRequest(method, path, &b)
+			req.Header.Set("Authorization", token)
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		require.Equal(t, http.StatusNotFound, visit(t, s, "new").Code)
+		require.Equal(t, http.StatusNotFound, visit(t, s, "new").Code)
+		require.EqualValues(t, 1, counting.lookups.Load(), "the links that do not exist are cached")
+
+		require.Equal(t, http.StatusCreated, api(http.MethodPost, "/api/v1/links", map[string]any{"id": "new", "url": "https://asankov.dev"}))
+		require.Equal(t, "https://asankov.dev", visit(t, s, "new").Header().Get("Location"))
+
+		require.Equal(t, http.StatusOK, api(http.MethodPatch, "/api/v1/links/new", map[string]any{"url": "https://asankov.dev/updated"}))
+		require.Equal(t, "https://asankov.dev/updated", visit(t, s, "new").Header().Get("Location"))
+
+		require.Equal(t, http.StatusNoContent, api(http.MethodDelete, "/api/v1/links/new", nil))
+		require.Equal(t, http.StatusNotFound, visit(t, s, "new").Code)
+	})
+	t.Run("TestCoalescing", func(t *testing.T) {
+		db := inmemory.NewDB()
+		require.NoError(t, db.Create(context.Background(), &links.Link{ID: "popular", URL: "https://asankov.dev"}))
+		s, counting := newReplica(t, db)
+		counting.delay = 50 * time.Millisecond
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/popular", nil))
+				require.Equal(t, http.StatusFound, rec.Code)
+			}()
+		}
+		wg.Wait()
+		require.EqualValues(t, 1, counting.lookups.Load(), "the concurrent lookups share a single read")
+	})
+	t.Run("TestShared", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() {
+			require.NoError(t, client.Close())
+		})
+
+		db := inmemory.NewDB()
+		require.NoError(t, db.Create(context.Background(), &links.Link{ID: "shared", URL: "https://asankov.dev"}))
+		first, firstDB := newReplica(t, db)
+		second, secondDB := newReplica(t, db)
+		first.SetSharedCache(cache.NewRedis(client, "shortener:links:"))
+		second.SetSharedCache(cache.NewRedis(client, "shortener:links:"))
+
+		require.Equal(t, http.StatusFound, visit(t, first, "shared").Code)
+		require.Equal(t, http.StatusFound, visit(t, second, "shared").Code)
+		require.EqualValues(t, 1, firstDB.lookups.Load())
+		require.EqualValues(t, 0, secondDB.lookups.Load(), "the link is read from the shared cache")
+		require.True(t, server.Exists("shortener:links:shared"))
+
+		server.Close()
+		require.Equal(t, http.StatusFound, visit(t, second, "shared").Code, "the link is served from memory")
+		require.Equal(t, http.StatusNotFound, visit(t, second, "missing").Code, "the storage is read when the shared cache fails")
+		require.EqualValues(t, 1, secondDB.lookups.Load())
+	})
+	t.Run("TestZeroTTL", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() {
+			require.NoError(t, client.Close())
+		})
+
+		db := inmemory.NewDB()
+		require.NoError(t, db.Create(context.Background(), &links.Link{ID: "uncached", URL: "https://asankov.dev"}))
+		s, counting := newReplica(t, db, func(c *config.Config) {
+			c.LinkCacheTTL = 0
+			c.LinkCacheNegativeTTL = 0
+		})
+		s.SetSharedCache(cache.NewRedis(client, "shortener:links:"))
+
+		for i := 0; i < 2; i++ {
+			require.Equal(t, http.StatusFound, visit(t, s, "uncached").Code)
+			require.Equal(t, http.StatusNotFound, visit(t, s, "missing").Code)
+		}
+		require.EqualValues(t, 4, counting.lookups.Load())
+		require.Empty(t, server.Keys(), "nothing is stored without an expiry")
+	})
+}
@@ -0,0 +1,40 @@
+package shortener
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+type holdingPage struct {
+	// ActiveAt is the time the link becomes active, or zero if it will not be active again.
+	ActiveAt time.Time
+}
+
+// serveInactive responds to a visit of a link that is outside of its schedule,
+// according to the inactive behavior of the schedule.
+func (h *handler) serveInactive(w http.ResponseWriter, r *http.Request, link *links.Link, now time.Time) {
+	switch link.Schedule.Inactive {
+	case links.InactiveFallback:
+		http.Redirect(w, r, link.Schedule.FallbackURL, http.StatusFound)
+	case links.InactiveHoldingPage:
+		page := holdingPage{}
+		status := http.StatusGone
+		if activeAt, ok := link.Schedule.NextActive(now); ok {
+			page.ActiveAt = activeAt
+			status = http.StatusTooEarly
+			w.Header().Set("Retry-After", strconv.Itoa(int(activeAt.Sub(now).Seconds())))
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if err := templates.ExecuteTemplate(w, "holding.html", page); err != nil {
+			h.logger.ErrorContext(r.Context(), "error while rendering holding page", "link_id", link.ID, "error", err)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,51 @@
+package shortener
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/asankov/shortener/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+// newSettings creates the holder of the active config of a Shortener.
+func newSettings(c *config.Config, logger *slog.Logger) *config.Reloader {
+	return config.NewReloader(c).SetLogger(logger)
+}
+
+// WatchConfig makes the Shortener reload the config with load each time the file changes
+// or the process receives SIGHUP, once it is started.
+//
+// Only the options tagged as reloadable take effect, the changes of the others require a restart.
+// If the file is empty, the config is reloaded only on SIGHUP.
+func (s *Shortener) WatchConfig(file string, load func() (*config.Config, error)) *Shortener {
+	s.settings.SetLoader(load)
+	s.configFile = file
+	s.watchConfig = true
+	return s
+}
+
+// ReloadConfig reloads the config, as if the config file has changed.
+//
+// If the new config is not valid, the active config is kept and the error is returned.
+func (s *Shortener) ReloadConfig() error {
+	return s.settings.Reload()
+}
+
+// applySettings applies the reloadable options of the config that are not read from it on each request.
+func (s *Shortener) applySettings(c *config.Config) {
+	s.logLevel.Set(c.LogLevel)
+	s.handler.passwordAttempts.setLimits(c.LinkPasswordAttempts, c.LinkPasswordAttemptsWindow)
+	s.handler.linkPasswordAttempts.setLimits(c.LinkPasswordAttemptsPerLink, c.LinkPasswordAttemptsWindow)
+}
+
+// serveConfigStatus responds with the version and the checksum of the active config and the result of the last reload.
+func (s *Shortener) serveConfigStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(s.settings.Status()); err != nil {
+		s.logger.ErrorContext(r.Context(), "error while encoding response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,26 +1,62 @@
 package shortener
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/asankov/shortener/internal/cache"
 	"github.com/asankov/shortener/internal/config"
+	"github.com/asankov/shortener/internal/geoip"
+	"github.com/asankov/shortener/internal/idempotency"
+	"github.com/asankov/shortener/internal/linkcheck"
 	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/metrics"
 	"github.com/asankov/shortener/internal/random"
+	"github.com/asankov/shortener/internal/ratelimit"
+	"github.com/asankov/shortener/internal/tracing"
 	"github.com/asankov/shortener/internal/users"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"golang.org/x/exp/slog"
 )
 
 type Shortener struct {
 	server http.Server
+	// adminServer serves the operational endpoints, e.g. /metrics, on a port that is not exposed publicly.
+	adminServer http.Server
 
 	logger *slog.Logger
 
 	handler *handler
 
+	linkChecker *linkcheck.Checker
+	// linkCache serves the lookups of the links from the caches, before the storage.
+	linkCache *cachedDatabase
+
 	configService ConfigService
 	config        *config.Config
+
+	// settings holds the active config, whose reloadable options can change while the Shortener is running.
+	settings *config.Reloader
+	// logLevel is the level of the default logger, which is changed when the config is reloaded.
+	logLevel *slog.LevelVar
+	// configFile is the file that is watched for changes of the config, if watchConfig is set.
+	configFile  string
+	watchConfig bool
+
+	tracerProvider trace.TracerProvider
+
+	// ready reports whether the server is started and is not shutting down.
+	ready atomic.Bool
+	// readiness checks whether the storage can be reached. It is nil if the storage cannot be checked.
+	readiness *readinessCheck
 }
 
 type handler struct {
@@ -28,26 +64,64 @@ type handler struct {
 	userService   UserService
 	authenticator Authenticator
 	idGenerator   IDGenerator
+	locator       geoip.Locator
+
+	trustForwardedFor bool
+	trustedProxyHops  int
+
+	secret           []byte
+	accessTTL        time.Duration
+	passwordAttempts *attemptLimiter
+	// linkPasswordAttempts limits the failed attempts of all clients together per link.
+	linkPasswordAttempts *attemptLimiter
+
+	alwaysInterstitial bool
+	interstitialDelay  time.Duration
+
+	publicURL string
+	qrLogo    image.Image
+
+	batchMaxLinks int
+
+	idempotency    IdempotencyStore
+	idempotencyTTL time.Duration
+	// idempotencyLeaseTTL is how long a key stays reserved while its first request is being processed.
+	idempotencyLeaseTTL time.Duration
+
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+
+	rateLimiter RateLimiter
+
+	// settings holds the active config, e.g. the shares of the requests that are logged, by operation.
+	settings *config.Reloader
 
 	logger *slog.Logger
 }
 
 type Database interface {
-	GetByID(id string) (*links.Link, error)
-	GetAll() ([]*links.Link, error)
+	GetByID(ctx context.Context, id string) (*links.Link, error)
+	GetAll(ctx context.Context) ([]*links.Link, error)
+	ForEach(ctx context.Context, fn func(link *links.Link) error) error
+	// GetByDestination returns the links of the owner whose URLs lead to the same destination as url, oldest first.
+	GetByDestination(ctx context.Context, owner, url string) ([]*links.Link, error)
 
-	Create(id string, url string) error
-	Delete(id string) error
-	IncrementClicks(id string) error
+	Create(ctx context.Context, link *links.Link) error
+	CreateBatch(ctx context.Context, batch []*links.Link) []error
+	CreateAll(ctx context.Context, batch []*links.Link) error
+	Update(ctx context.Context, link *links.Link) error
+	Delete(ctx context.Context, id string) error
+	IncrementClicks(ctx context.Context, id string, click links.Click) (int, error)
+	UpdateHealth(ctx context.Context, id string, health *links.Health) error
 }
 
 type IDGenerator interface {
-	GenerateID() (string, error)
+	GenerateID(ctx context.Context) (string, error)
 }
 
 type UserService interface {
-	GetUser(email, password string) (*users.User, error)
-	CreateUser(email, password string, roles []users.Role) error
+	GetUser(ctx context.Context, email, password string) (*users.User, error)
+	CreateUser(ctx context.Context, email, password string, roles []users.Role) error
 }
 
 type Authenticator interface {
@@ -56,14 +130,143 @@ type Authenticator interface {
 }
 
 type ConfigService interface {
-	ShouldCreateInitialUser() (bool, error)
+	ShouldCreateInitialUser(ctx context.Context) (bool, error)
 }
 
-func New(config *config.Config, db Database, idGenerator IDGenerator, userService UserService, authenticator Authenticator, configService ConfigService) (*Shortener, error) {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+// idConflictReporter is implemented by the ID generators that report the generated IDs that are already in use.
+type idConflictReporter interface {
+	OnIDConflict(fn func())
+}
+
+// Cache holds the encoded links by ID for a limited time, e.g. in memory or in Redis.
+type Cache interface {
+	// Get returns the value of the given key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// RateLimiter takes tokens from the buckets of the rate limits, e.g. of the client IP addresses.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error)
+}
+
+type IdempotencyStore interface {
+	GetIdempotencyRecord(ctx context.Context, key string) (*idempotency.Record, error)
+	// ReserveIdempotencyKey stores the record, or returns idempotency.ErrKeyInUse
+	// if there is a record with the same key that has not expired.
+	ReserveIdempotencyKey(ctx context.Context, record *idempotency.Record) error
+	SaveIdempotencyRecord(ctx context.Context, record *idempotency.Record) error
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+}
+
+func New(config *config.Config, db Database, idGenerator IDGenerator, userService UserService, authenticator Authenticator, configService ConfigService, idempotencyStore IdempotencyStore) (*Shortener, error) {
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(config.LogLevel)
+	logHandler, err := newLogHandler(os.Stdout, config.LogFormat, logLevel)
+	if err != nil {
+		return nil, err
+	}
+	logger := slog.New(tracing.NewLogHandler(logHandler))
+	settings := newSettings(config, logger)
+
+	var tracerProvider trace.TracerProvider = noop.NewTracerProvider()
+	if config.TracingEnabled {
+		provider, err := tracing.NewOTLPProvider(context.Background(), config.TracingSampleRatio)
+		if err != nil {
+			return nil, fmt.Errorf("error while setting up tracing: %w", err)
+		}
+		tracerProvider = provider
+	}
+
+	var locator geoip.Locator
+	if config.GeoIPDatabase != "" {
+		db, err := geoip.Open(config.GeoIPDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading GeoIP database: %w", err)
+		}
+		locator = db
+	}
+
+	var qrLogo image.Image
+	if config.QRLogo != "" {
+		logo, err := loadImage(config.QRLogo)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading QR code logo: %w", err)
+		}
+		qrLogo = logo
+	}
+
+	var readiness *readinessCheck
+	if checker, ok := db.(healthChecker); ok {
+		readiness = &readinessCheck{
+			check:   checker.CheckHealth,
+			ttl:     config.ReadinessCacheTTL,
+			timeout: config.ReadinessCheckTimeout,
+		}
+	}
+
+	m := metrics.New()
+	if reporter, ok := idGenerator.(idConflictReporter); ok {
+		reporter.OnIDConflict(m.ObserveIDConflict)
+	}
+
+	backend := "dynamodb"
+	if config.UseInMemoryDB {
+		backend = "inmemory"
+	}
+	observer := storageObserver{metrics: m, backend: backend}
+	db = &instrumentedDatabase{db: db, storageObserver: observer}
+	idGenerator = &instrumentedIDGenerator{idGenerator: idGenerator, storageObserver: observer}
+	userService = &instrumentedUserService{userService: userService, storageObserver: observer}
+	configService = &instrumentedConfigService{configService: configService, storageObserver: observer}
+	idempotencyStore = &instrumentedIdempotencyStore{store: idempotencyStore, storageObserver: observer}
+
+	limits := deadlines{
+		read:  config.StorageReadTimeout,
+		write: config.StorageWriteTimeout,
+		scan:  config.StorageScanTimeout,
+	}
+	db = &deadlineDatabase{db: db, deadlines: limits}
+	idGenerator = &deadlineIDGenerator{idGenerator: idGenerator, deadlines: limits}
+	userService = &deadlineUserService{userService: userService, deadlines: limits}
+	configService = &deadlineConfigService{configService: configService, deadlines: limits}
+	idempotencyStore = &deadlineIdempotencyStore{store: idempotencyStore, deadlines: limits}
+
+	linkCache := &cachedDatabase{
+		db:          db,
+		ttl:         config.LinkCacheTTL,
+		negativeTTL: config.LinkCacheNegativeTTL,
+		metrics:     m,
+		logger:      logger,
+	}
+	if config.LinkCacheSize > 0 {
+		local, err := cache.NewLRU(config.LinkCacheSize)
+		if err != nil {
+			return nil, fmt.Errorf("error while creating link cache: %w", err)
+		}
+		linkCache.tiers = append(linkCache.tiers, cacheTier{name: "local", cache: local})
+	}
+	db = linkCache
+
+	db = &tracedDatabase{db: db, spanStarter: spanStarter{prefix: "Database"}}
+	userService = &tracedUserService{userService: userService, spanStarter: spanStarter{prefix: "UserService"}}
+
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/metrics", m.Handler())
+
 	s := &Shortener{
 		server: http.Server{
-			Addr: fmt.Sprintf(":%d", config.Port),
+			Addr:              fmt.Sprintf(":%d", config.Port),
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			ReadTimeout:       config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		},
+		adminServer: http.Server{
+			Addr:              fmt.Sprintf(":%d", config.AdminPort),
+			Handler:           adminMux,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
 		},
 		logger: logger,
 		handler: &handler{
@@ -71,27 +274,109 @@ func New(config *config.Config, db Database, idGenerator IDGenerator, userServic
 			userService:   userService,
 			authenticator: authenticator,
 			idGenerator:   idGenerator,
-			logger:        logger,
+			locator:       locator,
+
+			trustForwardedFor: config.TrustForwardedFor,
+			trustedProxyHops:  config.TrustedProxyHops,
+
+			secret:               []byte(config.Secret),
+			accessTTL:            config.LinkAccessTTL,
+			passwordAttempts:     newAttemptLimiter(config.LinkPasswordAttempts, config.LinkPasswordAttemptsWindow),
+			linkPasswordAttempts: newAttemptLimiter(config.LinkPasswordAttemptsPerLink, config.LinkPasswordAttemptsWindow),
+
+			alwaysInterstitial: config.AlwaysInterstitial,
+			interstitialDelay:  config.InterstitialDelay,
+
+			publicURL: config.PublicURL,
+			qrLogo:    qrLogo,
+
+			batchMaxLinks: config.BatchMaxLinks,
+
+			idempotency:    idempotencyStore,
+			idempotencyTTL: config.IdempotencyKeyTTL,
+			// The lease covers the write of the link, so that a key of a request whose replica
+			// went away is not blocked for the whole TTL.
+			idempotencyLeaseTTL: config.StorageWriteTimeout,
+
+			metrics: m,
+			tracer:  tracerProvider.Tracer(tracing.InstrumentationName),
+
+			rateLimiter: ratelimit.NewMemory(),
+
+			settings: settings,
+
+			logger: logger,
 		},
+		linkChecker: linkcheck.New(db, linkcheck.Options{
+			Interval:    config.LinkCheckInterval,
+			Concurrency: config.LinkCheckConcurrency,
+			HostDelay:   config.LinkCheckHostDelay,
+			Timeout:     config.LinkCheckTimeout,
+		}).SetLogger(logger),
 		config:        config,
 		configService: configService,
+
+		settings: settings,
+		logLevel: logLevel,
+
+		tracerProvider: tracerProvider,
+		readiness:      readiness,
+		linkCache:      linkCache,
 	}
 
 	s.server.Handler = s.routes()
+	adminMux.HandleFunc("/config", s.serveConfigStatus)
+	settings.OnReload(s.applySettings)
 
 	return s, nil
 }
 
+// SetLogger sets the logger of the Shortener.
+// The IDs of the trace and the span of the requests are added to the records that are logged with a context.
 func (s *Shortener) SetLogger(l *slog.Logger) *Shortener {
+	l = slog.New(tracing.NewLogHandler(l.Handler()))
 	s.logger = l
 	s.handler.logger = l
+	s.linkChecker.SetLogger(l)
+	s.settings.SetLogger(l)
+	s.linkCache.logger = l
 	return s
 }
 
-func (s *Shortener) init() error {
-	if s.shouldCreateInitialUser() {
+// SetTracerProvider sets the provider of the tracer that traces the requests and the calls to the storage.
+func (s *Shortener) SetTracerProvider(tp trace.TracerProvider) *Shortener {
+	s.tracerProvider = tp
+	s.handler.tracer = tp.Tracer(tracing.InstrumentationName)
+	return s
+}
+
+// SetRateLimiter sets the store of the buckets of the rate limits, e.g. one that is shared by all the replicas.
+func (s *Shortener) SetRateLimiter(l RateLimiter) *Shortener {
+	s.handler.rateLimiter = l
+	return s
+}
+
+// SetSharedCache sets a cache of the links that is shared by all the replicas, e.g. Redis.
+// It is used after the cache in memory, if there is one.
+func (s *Shortener) SetSharedCache(c Cache) *Shortener {
+	s.linkCache.tiers = append(s.linkCache.tiers, cacheTier{name: "shared", cache: c})
+	return s
+}
+
+// Handler returns the HTTP handler that serves the Shortener routes.
+func (s *Shortener) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// AdminHandler returns the HTTP handler that serves the operational endpoints, e.g. /metrics.
+func (s *Shortener) AdminHandler() http.Handler {
+	return s.adminServer.Handler
+}
+
+func (s *Shortener) init(ctx context.Context) error {
+	if s.shouldCreateInitialUser(ctx) {
 		email, password := "admin@asankov.dev", random.Password(30)
-		if err := s.handler.userService.CreateUser(email, password, []users.Role{users.RoleAdmin}); err != nil {
+		if err := s.handler.userService.CreateUser(ctx, email, password, []users.Role{users.RoleAdmin}); err != nil {
 			return err
 		}
 
@@ -101,22 +386,107 @@ func (s *Shortener) init() error {
 	return nil
 }
 
-func (s *Shortener) shouldCreateInitialUser() bool {
+func (s *Shortener) shouldCreateInitialUser(ctx context.Context) bool {
 	if s.config.ForceGenerateAdminUser {
 		return true
 	}
-	shouldCreateInitialUser, err := s.configService.ShouldCreateInitialUser()
+	shouldCreateInitialUser, err := s.configService.ShouldCreateInitialUser(ctx)
 	if err != nil {
-		s.logger.Warn("error while checking whether to create initial user", "error", err)
+		s.logger.WarnContext(ctx, "error while checking whether to create initial user", "error", err)
 	}
 	return shouldCreateInitialUser
 }
 
-func (s *Shortener) Start() error {
-	if err := s.init(); err != nil {
+// flushTimeout limits each of the steps of the shutdown after the server is shut down, i.e. flushing the traces
+// and shutting down the admin server, so that they are not skipped when the server used up ShutdownTimeout.
+const flushTimeout = 5 * time.Second
+
+// Start serves the requests until ctx is done and then shuts the Shortener down gracefully.
+//
+// It returns nil if the Shortener was shut down because ctx was done.
+func (s *Shortener) Start(ctx context.Context) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+
+	// The background work is not tied to ctx, so that it can be stopped after the in-flight requests.
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	var background sync.WaitGroup
+	if s.config.LinkCheckEnabled {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			s.linkChecker.Run(backgroundCtx)
+		}()
+	}
+	if s.watchConfig {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			if err := s.settings.Watch(backgroundCtx, s.configFile); err != nil {
+				s.logger.Error("error while watching config, it will not be reloaded", "file", s.configFile, "error", err)
+			}
+		}()
+	}
+
+	go func() {
+		s.logger.Info(fmt.Sprintf("Starting admin server on address [%s]", s.adminServer.Addr))
+		if err := s.adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("error while running admin server", "error", err)
+		}
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		s.logger.Info(fmt.Sprintf("Starting server on address [%s]", s.server.Addr))
+		serverErr <- s.server.ListenAndServe()
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err := <-serverErr:
+		s.ready.Store(false)
 		return err
+	case <-ctx.Done():
 	}
 
-	s.logger.Info(fmt.Sprintf("Starting server on address [%s]\n", s.server.Addr))
-	return s.server.ListenAndServe()
+	s.ready.Store(false)
+	s.logger.Info(fmt.Sprintf("Shutting down, draining requests for [%s]", s.config.ShutdownDrainPeriod))
+	time.Sleep(s.config.ShutdownDrainPeriod)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	var err error
+	if shutdownErr := s.server.Shutdown(shutdownCtx); shutdownErr != nil {
+		err = fmt.Errorf("error while shutting down server: %w", shutdownErr)
+	}
+
+	stopBackground()
+	background.Wait()
+
+	if provider, ok := s.tracerProvider.(interface{ Shutdown(context.Context) error }); ok {
+		flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if shutdownErr := provider.Shutdown(flushCtx); shutdownErr != nil {
+			s.logger.Warn("error while flushing traces", "error", shutdownErr)
+		}
+	}
+
+	// The admin server is shut down last, so that the metrics of the drain period can still be collected.
+	adminCtx, cancelAdmin := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelAdmin()
+	if shutdownErr := s.adminServer.Shutdown(adminCtx); shutdownErr != nil {
+		s.logger.Warn("error while shutting down admin server", "error", shutdownErr)
+	}
+
+	s.logger.Info("Shut down")
+	return err
+}
+
+// Ready returns whether the Shortener is serving requests and is not shutting down.
+func (s *Shortener) Ready() bool {
+	return s.ready.Load()
 }
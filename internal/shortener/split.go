@@ -0,0 +1,57 @@
+package shortener
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+const (
+	// variantCookie is the name of the cookie that holds the destination a visitor was assigned to.
+	// It is scoped to the path of the link, so each link has its own.
+	variantCookie = "shortener_variant"
+
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// chooseDestination returns the URL the visitor should be sent to and the click that should be recorded.
+//
+// The targeting rules are evaluated first. If none of them matches and the link splits its traffic,
+// the visitor is assigned to one of its destinations.
+func (h *handler) chooseDestination(w http.ResponseWriter, r *http.Request, link *links.Link) (string, links.Click) {
+	if rule := link.MatchTargeting(h.visitor(r, link)); rule != nil {
+		return rule.URL, links.Click{}
+	}
+
+	if len(link.Destinations) == 0 {
+		return link.URL, links.Click{}
+	}
+
+	destination := h.variant(w, r, link)
+	return destination.URL, links.Click{Variant: destination.ID}
+}
+
+// variant returns the destination the visitor is assigned to.
+//
+// Returning visitors are sent to the same destination, as long as it still exists.
+// New visitors are assigned to a random destination, according to the weights.
+func (h *handler) variant(w http.ResponseWriter, r *http.Request, link *links.Link) *links.Destination {
+	if cookie, err := r.Cookie(variantCookie); err == nil {
+		if destination := link.Destination(cookie.Value); destination != nil {
+			return destination
+		}
+	}
+
+	destination := link.DestinationAt(rand.Intn(link.TotalWeight()))
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookie,
+		Value:    destination.ID,
+		Path:     "/" + link.ID,
+		MaxAge:   int(variantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return destination
+}
@@ -0,0 +1,120 @@
+package shortener
+
+import (
+	"context"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/tracing"
+	"github.com/asankov/shortener/internal/users"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanStarter starts the spans of the calls to a storage, as children of the span in the context of the call.
+//
+// The spans are started with the tracer provider of the parent span,
+// so the calls are traced only as part of a traced request.
+type spanStarter struct {
+	prefix string
+}
+
+// start starts the span of a call to the given method and returns the function that ends it,
+// once the call has returned err.
+func (s spanStarter) start(ctx context.Context, method string, err *error) func() {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracing.InstrumentationName)
+	_, span := tracer.Start(ctx, s.prefix+"."+method, trace.WithSpanKind(trace.SpanKindClient))
+	return func() {
+		if isStorageFailure(*err) {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+// tracedDatabase starts a span for each call to a Database.
+type tracedDatabase struct {
+	db Database
+	spanStarter
+}
+
+func (d *tracedDatabase) GetByID(ctx context.Context, id string) (_ *links.Link, err error) {
+	defer d.start(ctx, "GetByID", &err)()
+	return d.db.GetByID(ctx, id)
+}
+
+func (d *tracedDatabase) GetAll(ctx context.Context) (_ []*links.Link, err error) {
+	defer d.start(ctx, "GetAll", &err)()
+	return d.db.GetAll(ctx)
+}
+
+func (d *tracedDatabase) ForEach(ctx context.Context, fn func(link *links.Link) error) (err error) {
+	defer d.start(ctx, "ForEach", &err)()
+	return d.db.ForEach(ctx, fn)
+}
+
+func (d *tracedDatabase) GetByDestination(ctx context.Context, owner, url string) (_ []*links.Link, err error) {
+	defer d.start(ctx, "GetByDestination", &err)()
+	return d.db.GetByDestination(ctx, owner, url)
+}
+
+func (d *tracedDatabase) Create(ctx context.Context, link *links.Link) (err error) {
+	defer d.start(ctx, "Create", &err)()
+	return d.db.Create(ctx, link)
+}
+
+func (d *tracedDatabase) CreateBatch(ctx context.Context, batch []*links.Link) []error {
+	var err error
+	end := d.start(ctx, "CreateBatch", &err)
+
+	errs := d.db.CreateBatch(ctx, batch)
+	for _, e := range errs {
+		if isStorageFailure(e) {
+			err = e
+			break
+		}
+	}
+	end()
+	return errs
+}
+
+func (d *tracedDatabase) CreateAll(ctx context.Context, batch []*links.Link) (err error) {
+	defer d.start(ctx, "CreateAll", &err)()
+	return d.db.CreateAll(ctx, batch)
+}
+
+func (d *tracedDatabase) Update(ctx context.Context, link *links.Link) (err error) {
+	defer d.start(ctx, "Update", &err)()
+	return d.db.Update(ctx, link)
+}
+
+func (d *tracedDatabase) Delete(ctx context.Context, id string) (err error) {
+	defer d.start(ctx, "Delete", &err)()
+	return d.db.Delete(ctx, id)
+}
+
+func (d *tracedDatabase) IncrementClicks(ctx context.Context, id string, click links.Click) (_ int, err error) {
+	defer d.start(ctx, "IncrementClicks", &err)()
+	return d.db.IncrementClicks(ctx, id, click)
+}
+
+func (d *tracedDatabase) UpdateHealth(ctx context.Context, id string, health *links.Health) (err error) {
+	defer d.start(ctx, "UpdateHealth", &err)()
+	return d.db.UpdateHealth(ctx, id, health)
+}
+
+// tracedUserService starts a span for each call to a UserService.
+type tracedUserService struct {
+	userService UserService
+	spanStarter
+}
+
+func (s *tracedUserService) GetUser(ctx context.Context, email, password string) (_ *users.User, err error) {
+	defer s.start(ctx, "GetUser", &err)()
+	return s.userService.GetUser(ctx, email, password)
+}
+
+func (s *tracedUserService) CreateUser(ctx context.Context, email, password string, roles []users.Role) (err error) {
+	defer s.start(ctx, "CreateUser", &err)()
+	return s.userService.CreateUser(ctx, email, password, roles)
+}
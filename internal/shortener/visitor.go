@@ -0,0 +1,118 @@
+package shortener
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asankov/shortener/internal/geoip"
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/useragent"
+)
+
+// visitor collects the properties of the visitor of the link needed to evaluate its targeting rules.
+func (h *handler) visitor(r *http.Request, link *links.Link) *links.Visitor {
+	v := &links.Visitor{
+		Language: preferredLanguage(r.Header.Get("Accept-Language")),
+	}
+	v.Platform, v.Device = useragent.Parse(r.Header.Get("User-Agent"))
+
+	// Looking up the country is only done if it is needed.
+	if h.locator != nil && links.NeedsCountry(link.Targeting) {
+		ip, err := h.clientIP(r)
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "error while getting client IP", "link_id", link.ID, "error", err)
+			return v
+		}
+
+		country, err := h.locator.Country(ip)
+		if err != nil && !errors.Is(err, geoip.ErrNotFound) {
+			h.logger.WarnContext(r.Context(), "error while looking up country", "link_id", link.ID, "error", err)
+		}
+		v.Country = country
+	}
+
+	return v
+}
+
+// clientIP returns the IP address of the client that sent the request.
+//
+// If trustForwardedFor is true, the address in the X-Forwarded-For header appended by the outermost trusted proxy is used,
+// i.e. the one trustedProxyHops entries from the right. The entries to the left of it are set by the client, so they cannot be trusted.
+// If the header does not have a valid address there, the address of the connection is used.
+func (h *handler) clientIP(r *http.Request) (netip.Addr, error) {
+	if h.trustForwardedFor {
+		if ip, ok := forwardedFor(r.Header.Values("X-Forwarded-For"), h.trustedProxyHops); ok {
+			return ip, nil
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return netip.ParseAddr(host)
+}
+
+// forwardedFor returns the address hops entries from the right of the given X-Forwarded-For headers.
+// If there are fewer entries, all of them are appended by trusted proxies and the leftmost one is returned.
+func forwardedFor(headers []string, hops int) (netip.Addr, bool) {
+	var entries []string
+	for _, header := range headers {
+		entries = append(entries, strings.Split(header, ",")...)
+	}
+	if len(entries) == 0 {
+		return netip.Addr{}, false
+	}
+
+	i := len(entries) - hops
+	if i < 0 {
+		i = 0
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip, true
+}
+
+// preferredLanguage returns the language with the highest quality from the given Accept-Language header.
+func preferredLanguage(acceptLanguage string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		languages = append(languages, language{tag: tag, quality: quality})
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
@@ -0,0 +1,80 @@
+// Package tracing sets up the OpenTelemetry tracing of the service.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// InstrumentationName is the name of the tracers of the service.
+	InstrumentationName = "github.com/asankov/shortener"
+
+	serviceName = "shortener"
+)
+
+// Propagator extracts the trace context of the incoming requests from their W3C traceparent and tracestate headers.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// NewOTLPProvider returns a tracer provider that exports the spans with OTLP over HTTP.
+//
+// The exporter is configured with the standard OTEL_EXPORTER_OTLP_* environment variables,
+// e.g. OTEL_EXPORTER_OTLP_ENDPOINT.
+func NewOTLPProvider(ctx context.Context, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewProvider(sdktrace.WithBatcher(exporter), sdktrace.WithSampler(
+		sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio)),
+	)), nil
+}
+
+// NewProvider returns a tracer provider with the resource of the service and the given options,
+// e.g. sdktrace.WithSyncer with an in-memory exporter in tests.
+func NewProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...)
+}
+
+// LogHandler adds the IDs of the trace and the span in the context of the log records to them.
+type LogHandler struct {
+	handler slog.Handler
+}
+
+// NewLogHandler wraps the given handler in a LogHandler.
+func NewLogHandler(handler slog.Handler) *LogHandler {
+	if h, ok := handler.(*LogHandler); ok {
+		return h
+	}
+	return &LogHandler{handler: handler}
+}
+
+func (h *LogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{handler: h.handler.WithGroup(name)}
+}
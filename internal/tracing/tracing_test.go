@@ -0,0 +1,32 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/asankov/shortener/internal/tracing"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/exp/slog"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(tracing.NewLogHandler(slog.NewTextHandler(&buf, nil))).With("component", "test")
+
+	logger.Info("without span")
+	require.NotContains(t, buf.String(), "trace_id")
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(sdktrace.WithSyncer(exporter))
+	ctx, span := provider.Tracer(tracing.InstrumentationName).Start(context.Background(), "test")
+	defer span.End()
+
+	buf.Reset()
+	logger.InfoContext(ctx, "with span")
+	require.Contains(t, buf.String(), "component=test")
+	require.Contains(t, buf.String(), "trace_id="+span.SpanContext().TraceID().String())
+	require.Contains(t, buf.String(), "span_id="+span.SpanContext().SpanID().String())
+}
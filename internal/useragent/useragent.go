@@ -0,0 +1,38 @@
+package useragent
+
+import (
+	"strings"
+
+	"github.com/asankov/shortener/internal/links"
+)
+
+// Parse detects the platform and the device type from the given User-Agent header.
+//
+// If the platform cannot be detected, an empty platform is returned.
+// If the device type cannot be detected, links.DeviceDesktop is assumed.
+func Parse(ua string) (links.Platform, links.Device) {
+	switch {
+	case strings.Contains(ua, "iPad"):
+		return links.PlatformIOS, links.DeviceTablet
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		return links.PlatformIOS, links.DeviceMobile
+	case strings.Contains(ua, "Android"):
+		// Android tablets do not include "Mobile" in their User-Agent.
+		if strings.Contains(ua, "Mobile") {
+			return links.PlatformAndroid, links.DeviceMobile
+		}
+		return links.PlatformAndroid, links.DeviceTablet
+	case strings.Contains(ua, "Windows Phone"):
+		return links.PlatformWindows, links.DeviceMobile
+	case strings.Contains(ua, "Windows"):
+		return links.PlatformWindows, links.DeviceDesktop
+	case strings.Contains(ua, "Macintosh") || strings.Contains(ua, "Mac OS X"):
+		return links.PlatformMacOS, links.DeviceDesktop
+	case strings.Contains(ua, "Linux") || strings.Contains(ua, "X11"):
+		return links.PlatformLinux, links.DeviceDesktop
+	case strings.Contains(ua, "Mobi"):
+		return "", links.DeviceMobile
+	default:
+		return "", links.DeviceDesktop
+	}
+}
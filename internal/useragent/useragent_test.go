@@ -0,0 +1,75 @@
+package useragent_test
+
+import (
+	"testing"
+
+	"github.com/asankov/shortener/internal/links"
+	"github.com/asankov/shortener/internal/useragent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ua       string
+		platform links.Platform
+		device   links.Device
+	}{
+		{
+			name:     "iPhone",
+			ua:       "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			platform: links.PlatformIOS,
+			device:   links.DeviceMobile,
+		},
+		{
+			name:     "iPad",
+			ua:       "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			platform: links.PlatformIOS,
+			device:   links.DeviceTablet,
+		},
+		{
+			name:     "AndroidPhone",
+			ua:       "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36",
+			platform: links.PlatformAndroid,
+			device:   links.DeviceMobile,
+		},
+		{
+			name:     "AndroidTablet",
+			ua:       "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
+			platform: links.PlatformAndroid,
+			device:   links.DeviceTablet,
+		},
+		{
+			name:     "Windows",
+			ua:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
+			platform: links.PlatformWindows,
+			device:   links.DeviceDesktop,
+		},
+		{
+			name:     "MacOS",
+			ua:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+			platform: links.PlatformMacOS,
+			device:   links.DeviceDesktop,
+		},
+		{
+			name:     "Linux",
+			ua:       "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0",
+			platform: links.PlatformLinux,
+			device:   links.DeviceDesktop,
+		},
+		{
+			name:   "Unknown",
+			ua:     "curl/8.1.2",
+			device: links.DeviceDesktop,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			platform, device := useragent.Parse(testCase.ua)
+
+			require.Equal(t, testCase.platform, platform)
+			require.Equal(t, testCase.device, device)
+		})
+	}
+}
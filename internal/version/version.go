@@ -0,0 +1,48 @@
+// Package version provides the build information of the service.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is the version of the service.
+//
+// It is set at build time, e.g. with -ldflags "-X github.com/asankov/shortener/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// Info is the build information of the service.
+type Info struct {
+	Version string `json:"version"`
+	// Commit is the VCS revision the service was built from, if known.
+	Commit string `json:"commit,omitempty"`
+	// CommitTime is the time of the commit, in RFC 3339 format, if known.
+	CommitTime string `json:"commit_time,omitempty"`
+	// Modified reports whether the working tree had uncommitted changes when the service was built.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}